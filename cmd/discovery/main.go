@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
 
 	"github.com/bilibili/discovery/conf"
 	"github.com/bilibili/discovery/discovery"
+	"github.com/bilibili/discovery/dns"
 	"github.com/bilibili/discovery/http"
+	"github.com/bilibili/discovery/sink"
 	log "github.com/go-kratos/kratos/pkg/log"
 )
 
@@ -20,8 +24,10 @@ func main() {
 		panic(err)
 	}
 	log.Init(conf.Conf.Log)
-	dis, cancel := discovery.New(conf.Conf)
+	dis, _ := discovery.New(conf.Conf)
 	http.Init(conf.Conf, dis)
+	dns.Init(conf.Conf, dis)
+	sink.Init(conf.Conf, dis)
 	// init signal
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
@@ -30,13 +36,44 @@ func main() {
 		log.Info("discovery get a signal %s", s.String())
 		switch s {
 		case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.Conf.ShutdownTimeout))
+			if err := dis.Shutdown(ctx); err != nil {
+				log.Error("dis.Shutdown() error(%v)", err)
+			}
+			if err := http.Shutdown(ctx); err != nil {
+				log.Error("http.Shutdown() error(%v)", err)
+			}
+			if err := dns.Shutdown(ctx); err != nil {
+				log.Error("dns.Shutdown() error(%v)", err)
+			}
+			if err := sink.Shutdown(ctx); err != nil {
+				log.Error("sink.Shutdown() error(%v)", err)
+			}
 			cancel()
-			time.Sleep(time.Second)
 			log.Info("discovery quit !!!")
 			return
 		case syscall.SIGHUP:
+			reload(dis)
 		default:
 			return
 		}
 	}
 }
+
+// reload applies the config file to the running discovery.
+func reload(dis *discovery.Discovery) {
+	nc, err := conf.Load()
+	if err != nil {
+		log.Error("conf.Load() error(%v), config not reloaded", err)
+		return
+	}
+	logChanged := !reflect.DeepEqual(nc.Log, conf.Conf.Log)
+	if restarts := dis.Reload(nc); len(restarts) > 0 {
+		log.Warn("discovery reload: %v changed, take effect after restart", restarts)
+	}
+	conf.Conf = nc
+	if logChanged {
+		log.Init(nc.Log)
+	}
+	log.Info("discovery reload config success")
+}
@@ -0,0 +1,150 @@
+package conf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+)
+
+const (
+	_authAlg = "HS256"
+)
+
+// AuthConfig authorization of write operations, register/renew/cancel/set are open to everyone if nil.
+type AuthConfig struct {
+	// Tokens are the static tokens of apps, keyed by "appid" for all envs or "appid/env".
+	Tokens map[string][]string
+	// Key verifies signed tokens, which are JWT signed by HS256 with claims appid, env and exp.
+	Key string
+	// AdminTokens are allowed to write any app and call operator apis,
+	// the first one is presented to peers by replication.
+	AdminTokens []string
+}
+
+type authHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type authClaims struct {
+	AppID string `json:"appid"`
+	Env   string `json:"env,omitempty"`
+	Exp   int64  `json:"exp,omitempty"`
+}
+
+// Enabled returns whether authorization is enabled.
+func (a *AuthConfig) Enabled() bool {
+	return a != nil && (len(a.Tokens) > 0 || a.Key != "" || len(a.AdminTokens) > 0)
+}
+
+// fix requires an admin token if authorization is enabled, otherwise replications to peers are rejected.
+func (a *AuthConfig) fix() (err error) {
+	if a.Enabled() && len(a.AdminTokens) == 0 {
+		err = errors.New("auth requires adminTokens, the first one is presented to peers by replication")
+	}
+	return
+}
+
+// PeerToken returns the token presented to peers.
+func (a *AuthConfig) PeerToken() string {
+	if a == nil || len(a.AdminTokens) == 0 {
+		return ""
+	}
+	return a.AdminTokens[0]
+}
+
+// Verify checks whether token is allowed to write the instances of appid in env.
+func (a *AuthConfig) Verify(token, appid, env string) (err error) {
+	if !a.Enabled() {
+		return
+	}
+	if token == "" {
+		return ecode.Unauthorized
+	}
+	if a.admin(token) || match(a.Tokens[appid], token) || match(a.Tokens[appid+"/"+env], token) {
+		return
+	}
+	if claims, ok := a.verifySigned(token); ok && claims.AppID == appid && (claims.Env == "" || claims.Env == env) {
+		return
+	}
+	return ecode.AccessDenied
+}
+
+// VerifyAdmin checks whether token is allowed to call operator apis.
+func (a *AuthConfig) VerifyAdmin(token string) (err error) {
+	if !a.Enabled() {
+		return
+	}
+	if token == "" {
+		return ecode.Unauthorized
+	}
+	if !a.admin(token) {
+		return ecode.AccessDenied
+	}
+	return
+}
+
+// Sign returns a signed token of appid in env, env is empty for all envs and exp zero for never expired.
+func (a *AuthConfig) Sign(appid, env string, exp time.Time) (token string) {
+	claims := &authClaims{AppID: appid, Env: env}
+	if !exp.IsZero() {
+		claims.Exp = exp.Unix()
+	}
+	header, _ := json.Marshal(&authHeader{Alg: _authAlg, Typ: "JWT"})
+	payload, _ := json.Marshal(claims)
+	token = base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return token + "." + base64.RawURLEncoding.EncodeToString(a.sign(token))
+}
+
+func (a *AuthConfig) admin(token string) bool {
+	return match(a.AdminTokens, token)
+}
+
+func (a *AuthConfig) sign(content string) []byte {
+	mac := hmac.New(sha256.New, []byte(a.Key))
+	mac.Write([]byte(content))
+	return mac.Sum(nil)
+}
+
+func (a *AuthConfig) verifySigned(token string) (claims *authClaims, ok bool) {
+	if a.Key == "" {
+		return
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, a.sign(parts[0]+"."+parts[1])) {
+		return
+	}
+	var header authHeader
+	if bs, err := base64.RawURLEncoding.DecodeString(parts[0]); err != nil || json.Unmarshal(bs, &header) != nil || header.Alg != _authAlg {
+		return
+	}
+	bs, err := base64.RawURLEncoding.DecodeString(parts[1])
+	claims = new(authClaims)
+	if err != nil || json.Unmarshal(bs, claims) != nil {
+		return
+	}
+	if claims.Exp != 0 && time.Now().Unix() >= claims.Exp {
+		return
+	}
+	return claims, true
+}
+
+func match(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package conf
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthFix(t *testing.T) {
+	Convey("test auth requires admin tokens for replication", t, func() {
+		var a *AuthConfig
+		So(a.fix(), ShouldBeNil)
+		a = &AuthConfig{Tokens: map[string][]string{"main.arch.test": {"app"}}}
+		So(a.fix(), ShouldNotBeNil)
+		a = &AuthConfig{Key: "secret"}
+		So(a.fix(), ShouldNotBeNil)
+		a.AdminTokens = []string{"admin"}
+		So(a.fix(), ShouldBeNil)
+		So(a.PeerToken(), ShouldEqual, "admin")
+	})
+}
+
+// forge returns a token of header and payload signed by the key of a, whatever the alg in header.
+func forge(a *AuthConfig, header, payload string) string {
+	token := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return token + "." + base64.RawURLEncoding.EncodeToString(a.sign(token))
+}
+
+func TestAuthVerify(t *testing.T) {
+	a := &AuthConfig{
+		Tokens:      map[string][]string{"main.arch.test": {"app"}, "main.arch.env/pre": {"env"}},
+		Key:         "secret",
+		AdminTokens: []string{"admin"},
+	}
+	other := &AuthConfig{Key: "other"}
+	now := time.Now()
+	cases := []struct {
+		name  string
+		token string
+		appid string
+		env   string
+		err   error
+	}{
+		{"no token", "", "main.arch.test", "pre", ecode.Unauthorized},
+		{"static token", "app", "main.arch.test", "pre", nil},
+		{"static token of other app", "app", "main.arch.other", "pre", ecode.AccessDenied},
+		{"static token of env", "env", "main.arch.env", "pre", nil},
+		{"static token of other env", "env", "main.arch.env", "prod", ecode.AccessDenied},
+		{"admin token", "admin", "main.arch.other", "prod", nil},
+		{"signed", a.Sign("main.arch.test", "", time.Time{}), "main.arch.test", "prod", nil},
+		{"signed in env", a.Sign("main.arch.test", "pre", now.Add(time.Hour)), "main.arch.test", "pre", nil},
+		{"signed of other env", a.Sign("main.arch.test", "pre", time.Time{}), "main.arch.test", "prod", ecode.AccessDenied},
+		{"signed of other app", a.Sign("main.arch.test", "", time.Time{}), "main.arch.other", "pre", ecode.AccessDenied},
+		{"signed expired", a.Sign("main.arch.test", "", now.Add(-time.Second)), "main.arch.test", "pre", ecode.AccessDenied},
+		{"bad signature", other.Sign("main.arch.test", "", time.Time{}), "main.arch.test", "pre", ecode.AccessDenied},
+		{"alg none", forge(a, `{"alg":"none"}`, `{"appid":"main.arch.test"}`), "main.arch.test", "pre", ecode.AccessDenied},
+		{"alg HS512", forge(a, `{"alg":"HS512"}`, `{"appid":"main.arch.test"}`), "main.arch.test", "pre", ecode.AccessDenied},
+		{"alg HS256", forge(a, `{"alg":"HS256"}`, `{"appid":"main.arch.test"}`), "main.arch.test", "pre", nil},
+		{"malformed", "a.b", "main.arch.test", "pre", ecode.AccessDenied},
+	}
+	Convey("test verify tokens of apps", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				So(a.Verify(c.token, c.appid, c.env), ShouldEqual, c.err)
+			})
+		}
+		Convey("disabled", func() {
+			var disabled *AuthConfig
+			So(disabled.Verify("", "main.arch.test", "pre"), ShouldBeNil)
+		})
+	})
+}
+
+func TestAuthVerifyAdmin(t *testing.T) {
+	a := &AuthConfig{
+		Tokens:      map[string][]string{"main.arch.test": {"app"}},
+		Key:         "secret",
+		AdminTokens: []string{"admin", "admin2"},
+	}
+	cases := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"no token", "", ecode.Unauthorized},
+		{"admin token", "admin", nil},
+		{"second admin token", "admin2", nil},
+		{"app token", "app", ecode.AccessDenied},
+		{"signed token", a.Sign("main.arch.test", "", time.Time{}), ecode.AccessDenied},
+	}
+	Convey("test verify admin tokens", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				So(a.VerifyAdmin(c.token), ShouldEqual, c.err)
+			})
+		}
+		Convey("disabled", func() {
+			So((&AuthConfig{}).VerifyAdmin(""), ShouldBeNil)
+		})
+	})
+}
@@ -1,11 +1,22 @@
 package conf
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/BurntSushi/toml"
 	"github.com/go-kratos/kratos/pkg/conf/env"
 	"github.com/go-kratos/kratos/pkg/conf/paladin"
 	log "github.com/go-kratos/kratos/pkg/log"
 	http "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+	xtime "github.com/go-kratos/kratos/pkg/time"
+)
+
+const (
+	_shutdownTimeout  = 10 * time.Second
+	_protectThreshold = 0.85
+	_metadataKeys     = 64
+	_metadataSize     = 4096
 )
 
 var (
@@ -24,14 +35,35 @@ type Env struct {
 
 // Config config.
 type Config struct {
-	Nodes         []string
-	Zones         map[string][]string
-	HTTPServer    *http.ServerConfig
+	Nodes      []string
+	Zones      map[string][]string
+	LBZones    []string
+	HTTPServer *http.ServerConfig
+	// AdminServer if not nil, management apis are only served on it instead of HTTPServer.
+	AdminServer   *http.ServerConfig
 	HTTPClient    *http.ClientConfig
+	TLS           *TLSConfig
+	Auth          *AuthConfig
+	DNS           *DNSConfig
+	Sinks         []*SinkConfig
 	Env           *Env
 	Log           *log.Config
 	Scheduler     []byte
 	EnableProtect bool
+	// ProtectThreshold is the percent of expected renews below which eviction stops, 0.85 by default.
+	ProtectThreshold float64
+	// StaleRead serves reads in protect mode with what the node holds, marked as stale.
+	StaleRead bool
+	// ShutdownTimeout is the deadline of graceful shutdown, 10s by default.
+	ShutdownTimeout xtime.Duration
+	// MetadataKeys and MetadataSize limit the number of keys and total bytes of the metadata of an instance,
+	// 64 keys and 4096 bytes by default.
+	MetadataKeys int
+	MetadataSize int
+	// FeedSize is the number of registry changes kept for the change feed, 10000 by default.
+	FeedSize int
+	// MemberFile persists the members added or removed by admin api, not persisted if empty.
+	MemberFile string
 }
 
 func (c *Config) fix() (err error) {
@@ -50,6 +82,31 @@ func (c *Config) fix() (err error) {
 	if c.Env.DeployEnv == "" {
 		c.Env.DeployEnv = env.DeployEnv
 	}
+	if c.ProtectThreshold < 0 || c.ProtectThreshold > 1 {
+		return fmt.Errorf("protectThreshold(%v) must be in [0, 1]", c.ProtectThreshold)
+	}
+	if c.ProtectThreshold == 0 {
+		c.ProtectThreshold = _protectThreshold
+	}
+	if c.MetadataKeys <= 0 {
+		c.MetadataKeys = _metadataKeys
+	}
+	if c.MetadataSize <= 0 {
+		c.MetadataSize = _metadataSize
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = xtime.Duration(_shutdownTimeout)
+	}
+	if err = c.TLS.fix(); err != nil {
+		return
+	}
+	if err = c.DNS.fix(); err != nil {
+		return
+	}
+	if err = c.Auth.fix(); err != nil {
+		return
+	}
+	err = fixSinks(c.Sinks)
 	return
 }
 
@@ -61,7 +118,8 @@ func Init() (err error) {
 	return paladin.Watch(configKey, Conf)
 }
 
-// Set config setter.
+// Set config setter of paladin watch. Only the first content is applied, changes of config file
+// after that are validated and logged but ignored until SIGHUP, which applies them by Load and Reload.
 func (c *Config) Set(content string) (err error) {
 	var tmpConf *Config
 	if _, err = toml.Decode(content, &tmpConf); err != nil {
@@ -71,6 +129,11 @@ func (c *Config) Set(content string) (err error) {
 	if err = tmpConf.fix(); err != nil {
 		return
 	}
+	if Conf.Env != nil {
+		// NOTE: the running config is replaced by Reload on SIGHUP.
+		log.Info("config %s changed, send SIGHUP to reload", configKey)
+		return nil
+	}
 	*Conf = *tmpConf
 	return nil
 }
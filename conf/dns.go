@@ -0,0 +1,47 @@
+package conf
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	xtime "github.com/go-kratos/kratos/pkg/time"
+)
+
+const (
+	_dnsDomain = "discovery."
+	_dnsTTL    = 5 * time.Second
+)
+
+// DNSConfig dns listener answering names like "<appid>.<env>.<zone>.discovery." over udp and tcp.
+type DNSConfig struct {
+	Addr string
+	// Domain is the suffix of names, "discovery." by default.
+	Domain string
+	// TTL of records, 5s by default.
+	TTL xtime.Duration
+}
+
+// Enabled returns whether the dns listener is enabled.
+func (d *DNSConfig) Enabled() bool {
+	return d != nil && d.Addr != ""
+}
+
+func (d *DNSConfig) fix() (err error) {
+	if !d.Enabled() {
+		return
+	}
+	d.Domain = strings.ToLower(strings.Trim(d.Domain, "."))
+	if d.Domain == "" {
+		d.Domain = _dnsDomain
+	} else {
+		d.Domain += "."
+	}
+	if strings.Contains(d.Domain, "..") {
+		return errors.New("dns domain contains empty label")
+	}
+	if d.TTL <= 0 {
+		d.TTL = xtime.Duration(_dnsTTL)
+	}
+	return
+}
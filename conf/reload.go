@@ -0,0 +1,63 @@
+package conf
+
+import (
+	"reflect"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-kratos/kratos/pkg/conf/paladin"
+)
+
+// Load decodes and validates the current content of config file, without replacing Conf.
+func Load() (c *Config, err error) {
+	content, err := paladin.Get(configKey).String()
+	if err != nil {
+		return
+	}
+	if _, err = toml.Decode(content, &c); err != nil {
+		return
+	}
+	err = c.fix()
+	return
+}
+
+// Reload compares c with the running config old, the settings which only take effect
+// after restart keep the running values, and their names are returned.
+func (c *Config) Reload(old *Config) (restarts []string) {
+	if !reflect.DeepEqual(c.Env, old.Env) {
+		restarts = append(restarts, "env")
+	}
+	c.Env = old.Env
+	if !reflect.DeepEqual(c.HTTPServer, old.HTTPServer) {
+		restarts = append(restarts, "httpServer")
+	}
+	c.HTTPServer = old.HTTPServer
+	if !reflect.DeepEqual(c.AdminServer, old.AdminServer) {
+		restarts = append(restarts, "adminServer")
+	}
+	c.AdminServer = old.AdminServer
+	if !reflect.DeepEqual(c.TLS, old.TLS) {
+		restarts = append(restarts, "tls")
+	}
+	c.TLS = old.TLS
+	if !reflect.DeepEqual(c.DNS, old.DNS) {
+		restarts = append(restarts, "dns")
+	}
+	c.DNS = old.DNS
+	if !reflect.DeepEqual(c.Sinks, old.Sinks) {
+		restarts = append(restarts, "sinks")
+	}
+	c.Sinks = old.Sinks
+	if c.EnableProtect != old.EnableProtect {
+		restarts = append(restarts, "enableProtect")
+	}
+	c.EnableProtect = old.EnableProtect
+	if c.FeedSize != old.FeedSize {
+		restarts = append(restarts, "feedSize")
+	}
+	c.FeedSize = old.FeedSize
+	if c.MemberFile != old.MemberFile {
+		restarts = append(restarts, "memberFile")
+	}
+	c.MemberFile = old.MemberFile
+	return
+}
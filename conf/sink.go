@@ -0,0 +1,68 @@
+package conf
+
+import (
+	"fmt"
+	"time"
+
+	xtime "github.com/go-kratos/kratos/pkg/time"
+)
+
+const (
+	_sinkBuffer  = 1024
+	_sinkBatch   = 100
+	_sinkTimeout = 3 * time.Second
+	_sinkRetry   = 3
+)
+
+// SinkConfig a sink exporting registry changes, like a json lines file or a http endpoint.
+type SinkConfig struct {
+	Name string
+	// Type is the registered type of sink, "file" and "http" are built in.
+	Type string
+	// Path of file sink.
+	Path string
+	// URL and Header of http sink, changes are posted as a json array.
+	URL    string
+	Header map[string]string
+	// Timeout of a write, 3s by default.
+	Timeout xtime.Duration
+	// Buffer is the number of changes queued for the sink, changes are dropped if full, 1024 by default.
+	Buffer int
+	// Batch is the max number of changes of a write, 100 by default.
+	Batch int
+	// Retry is the number of retries of a failed write, 3 by default and none if negative.
+	Retry int
+	// AppID, Env and Action filter the changes, all changes are exported if empty.
+	AppID  []string
+	Env    []string
+	Action []string
+}
+
+func fixSinks(ss []*SinkConfig) (err error) {
+	names := make(map[string]struct{}, len(ss))
+	for _, s := range ss {
+		if s.Name == "" {
+			s.Name = s.Type
+		}
+		if s.Type == "" {
+			return fmt.Errorf("sink(%s) type is empty", s.Name)
+		}
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("sink(%s) is duplicated", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		if s.Timeout <= 0 {
+			s.Timeout = xtime.Duration(_sinkTimeout)
+		}
+		if s.Buffer <= 0 {
+			s.Buffer = _sinkBuffer
+		}
+		if s.Batch <= 0 {
+			s.Batch = _sinkBatch
+		}
+		if s.Retry == 0 {
+			s.Retry = _sinkRetry
+		}
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package conf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	_schemeHTTP  = "http"
+	_schemeHTTPS = "https"
+)
+
+// TLSConfig tls config of discovery listener and peers.
+type TLSConfig struct {
+	// CertFile and KeyFile are the certificate presented by the listener,
+	// and also by replication requests when peers require client certs.
+	CertFile string
+	KeyFile  string
+	// CAFile is the PEM bundle used to verify peers and, if ClientAuth is set, clients.
+	CAFile string
+	// ServerName overrides the name used to verify peer certificates.
+	ServerName string
+	// ClientAuth requires and verifies client certificates against CAFile.
+	ClientAuth bool
+}
+
+// Enabled returns whether tls is enabled.
+func (t *TLSConfig) Enabled() bool {
+	return t != nil && t.CertFile != "" && t.KeyFile != ""
+}
+
+func (t *TLSConfig) fix() (err error) {
+	if t == nil {
+		return
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("tls certFile and keyFile must be both set")
+	}
+	if t.ClientAuth && t.CAFile == "" {
+		return errors.New("tls clientAuth requires caFile")
+	}
+	return
+}
+
+func (t *TLSConfig) certPool() (pool *x509.CertPool, err error) {
+	if t.CAFile == "" {
+		return
+	}
+	pem, err := ioutil.ReadFile(t.CAFile)
+	if err != nil {
+		return
+	}
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		err = fmt.Errorf("tls caFile(%s) contains no certificate", t.CAFile)
+	}
+	return
+}
+
+// Server returns the tls config of discovery listener.
+func (t *TLSConfig) Server() (c *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return
+	}
+	c = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if t.ClientAuth {
+		if c.ClientCAs, err = t.certPool(); err != nil {
+			return
+		}
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return
+}
+
+// Client returns the tls config used to call peers.
+func (t *TLSConfig) Client() (c *tls.Config, err error) {
+	c = &tls.Config{ServerName: t.ServerName}
+	if c.RootCAs, err = t.certPool(); err != nil {
+		return
+	}
+	if t.Enabled() {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			return
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return
+}
+
+// Scheme returns the scheme of discovery listener.
+func (c *Config) Scheme() string {
+	if c.TLS.Enabled() {
+		return _schemeHTTPS
+	}
+	return _schemeHTTP
+}
+
+// SplitAddr splits a peer address like "https://10.0.0.1:7171" into scheme and host.
+// If addr has no scheme, the scheme of discovery listener is used.
+func (c *Config) SplitAddr(addr string) (scheme, host string) {
+	if i := strings.Index(addr, "://"); i > 0 {
+		return addr[:i], addr[i+3:]
+	}
+	return c.Scheme(), addr
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/bilibili/discovery/model"
+	"github.com/bilibili/discovery/registry"
+)
+
+// Dashboard returns the view of dashboard, apps are filtered by env and zone, and appid containing appid.
+func (d *Discovery) Dashboard(c context.Context, env, zone, appid string) (db *model.Dashboard) {
+	db = &model.Dashboard{
+		Health:     d.Health(c),
+		Nodes:      d.nodes.Load().(*registry.Nodes).AllNodes(),
+		Schedulers: d.registry.Schedulers(),
+		Env:        env,
+		Zone:       zone,
+		AppID:      appid,
+	}
+	apps := make(map[string]*model.DashboardApp)
+	zones := make(map[string]*model.DashboardZone)
+	for _, is := range d.registry.FetchAll() {
+		for _, i := range is {
+			if (env != "" && i.Env != env) || (zone != "" && i.Zone != zone) || !strings.Contains(i.AppID, appid) {
+				continue
+			}
+			key := i.AppID + "/" + i.Env
+			app, ok := apps[key]
+			if !ok {
+				app = &model.DashboardApp{AppID: i.AppID, Env: i.Env}
+				apps[key] = app
+				db.Apps = append(db.Apps, app)
+			}
+			z, ok := zones[key+"/"+i.Zone]
+			if !ok {
+				z = &model.DashboardZone{Zone: i.Zone}
+				zones[key+"/"+i.Zone] = z
+				app.Zones = append(app.Zones, z)
+			}
+			z.Instances = append(z.Instances, i)
+		}
+	}
+	sort.Slice(db.Apps, func(i, j int) bool {
+		if db.Apps[i].Env != db.Apps[j].Env {
+			return db.Apps[i].Env < db.Apps[j].Env
+		}
+		return db.Apps[i].AppID < db.Apps[j].AppID
+	})
+	for _, app := range db.Apps {
+		sort.Slice(app.Zones, func(i, j int) bool { return app.Zones[i].Zone < app.Zones[j].Zone })
+		for _, z := range app.Zones {
+			sort.Slice(z.Instances, func(i, j int) bool {
+				if z.Instances[i].Hostname != z.Instances[j].Hostname {
+					return z.Instances[i].Hostname < z.Instances[j].Hostname
+				}
+				return z.Instances[i].ID() < z.Instances[j].ID()
+			})
+		}
+	}
+	return
+}
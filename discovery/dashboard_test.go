@@ -0,0 +1,29 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bilibili/discovery/model"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboard(t *testing.T) {
+	Convey("test dashboard filter apps", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171"}
+		svr, cancel := New(c)
+		defer cancel()
+		svr.Register(context.TODO(), model.NewInstance(&model.ArgRegister{AppID: "main.arch.test", Hostname: "h1", Zone: "sh001", Env: "pre", Status: 1}), 0, true, false)
+		svr.Register(context.TODO(), model.NewInstance(&model.ArgRegister{AppID: "main.arch.test", Hostname: "h2", Zone: "sh002", Env: "pre", Status: 1}), 0, true, false)
+		db := svr.Dashboard(context.TODO(), "pre", "", "arch.test")
+		So(len(db.Apps), ShouldEqual, 1)
+		So(len(db.Apps[0].Zones), ShouldEqual, 2)
+		So(db.Apps[0].Zones[0].Zone, ShouldEqual, "sh001")
+		So(len(db.Nodes), ShouldEqual, 1)
+		db = svr.Dashboard(context.TODO(), "", "sh002", "")
+		So(len(db.Apps), ShouldEqual, 1)
+		So(db.Apps[0].Zones[0].Instances[0].Hostname, ShouldEqual, "h2")
+	})
+}
@@ -2,34 +2,56 @@ package discovery
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/bilibili/discovery/conf"
 	"github.com/bilibili/discovery/registry"
+
+	log "github.com/go-kratos/kratos/pkg/log"
 	http "github.com/go-kratos/kratos/pkg/net/http/blademaster"
 )
 
+const (
+	_flushWait = 10 * time.Millisecond
+)
+
 // Discovery discovery.
 type Discovery struct {
-	c         *conf.Config
-	protected bool
-	client    *http.Client
+	c         atomic.Value // *conf.Config, replaced by Reload
+	protected int32        // 1 in init protect mode, accessed atomically
+	synced    int32        // 1 once synced from peers, accessed atomically
+	client    atomic.Value // *http.Client, replaced by Reload
 	registry  *registry.Registry
 	nodes     atomic.Value
+	members   *members
+
+	// graceful shutdown
+	goaway     chan struct{}
+	goawayOnce sync.Once
+	inflight   int64 // replications in flight
+	selfCancel context.CancelFunc
+	selfDone   chan struct{}
 }
 
 // New get a discovery.
 func New(c *conf.Config) (d *Discovery, cancel context.CancelFunc) {
 	d = &Discovery{
-		protected: c.EnableProtect,
-		c:         c,
-		client:    http.NewClient(c.HTTPClient),
-		registry:  registry.NewRegistry(c),
+		registry: registry.NewRegistry(c),
+		members:  newMembers(c.MemberFile),
+		goaway:   make(chan struct{}),
+		selfDone: make(chan struct{}),
 	}
-	d.nodes.Store(registry.NewNodes(c))
+	d.c.Store(c)
+	d.client.Store(registry.NewClient(c))
+	if c.EnableProtect {
+		d.protected = 1
+	}
+	d.nodes.Store(registry.NewNodes(d.members.config(c)))
 	d.syncUp()
 	cancel = d.regSelf()
+	d.selfCancel = cancel
 	go d.nodesproc()
 	go d.exitProtect()
 	return
@@ -38,5 +60,80 @@ func New(c *conf.Config) (d *Discovery, cancel context.CancelFunc) {
 func (d *Discovery) exitProtect() {
 	// exist protect mode after two renew cycle
 	time.Sleep(time.Second * 60)
-	d.protected = false
+	atomic.StoreInt32(&d.protected, 0)
+}
+
+// GoAway returns a channel closed on shutdown, hanging polls should be answered so that clients switch node.
+func (d *Discovery) GoAway() <-chan struct{} {
+	return d.goaway
+}
+
+// Closing returns whether discovery is shutting down.
+func (d *Discovery) Closing() bool {
+	select {
+	case <-d.goaway:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown stops polls, flushes replications in flight and then cancels self registration,
+// which is canceled even if the flush is not done before the deadline of c. It is safe to call more than once.
+// The listener should be closed after that.
+func (d *Discovery) Shutdown(c context.Context) (err error) {
+	d.goawayOnce.Do(func() { close(d.goaway) })
+	log.Info("discovery shutdown: polls go away")
+flush:
+	for atomic.LoadInt64(&d.inflight) > 0 {
+		select {
+		case <-c.Done():
+			log.Error("discovery shutdown: %d replications in flight error(%v)", atomic.LoadInt64(&d.inflight), c.Err())
+			err = c.Err()
+			break flush
+		case <-time.After(_flushWait):
+		}
+	}
+	if err == nil {
+		log.Info("discovery shutdown: replications flushed")
+	}
+	d.selfCancel()
+	select {
+	case <-d.selfDone:
+		log.Info("discovery shutdown: self registration canceled")
+	case <-c.Done():
+		err = c.Err()
+	}
+	return
+}
+
+// config returns the running config.
+func (d *Discovery) config() *conf.Config {
+	return d.c.Load().(*conf.Config)
+}
+
+// httpClient returns the http client of syncup from peers.
+func (d *Discovery) httpClient() *http.Client {
+	return d.client.Load().(*http.Client)
+}
+
+// replicating tracks a replication in flight until the returned func is called.
+func (d *Discovery) replicating() func() {
+	atomic.AddInt64(&d.inflight, 1)
+	return func() { atomic.AddInt64(&d.inflight, -1) }
+}
+
+// Reload applies nc to the running discovery: nodes and zones, http client of replication and
+// protect threshold and metadata limit. It returns the settings which only take effect after restart.
+func (d *Discovery) Reload(nc *conf.Config) (restarts []string) {
+	m := d.members
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	restarts = nc.Reload(d.config())
+	d.c.Store(nc)
+	d.client.Store(registry.NewClient(nc))
+	d.registry.SetProtectThreshold(nc.ProtectThreshold)
+	d.registry.SetMetadataLimit(nc.MetadataKeys, nc.MetadataSize)
+	d.storeNodes()
+	return
 }
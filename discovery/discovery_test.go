@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/model"
+	"github.com/go-kratos/kratos/pkg/ecode"
+	http "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShutdown(t *testing.T) {
+	Convey("test shutdown flush replications and cancel self", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171"}
+		svr, _ := New(c)
+		So(svr.Closing(), ShouldBeFalse)
+		done := svr.replicating()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		So(svr.Shutdown(ctx), ShouldResemble, context.DeadlineExceeded)
+		So(svr.Closing(), ShouldBeTrue)
+		// NOTE: self registration is canceled even if replications are not flushed.
+		select {
+		case <-svr.selfDone:
+		case <-time.After(time.Second):
+		}
+		_, err := svr.Fetch(context.TODO(), &model.ArgFetch{Zone: "sh001", Env: "pre", AppID: model.AppID, Status: 3})
+		So(err, ShouldResemble, ecode.NothingFound)
+		done()
+		So(svr.Shutdown(context.Background()), ShouldBeNil)
+	})
+}
+
+func TestReload(t *testing.T) {
+	Convey("test reload nodes and report restarts", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171"}
+		svr, cancel := New(c)
+		defer cancel()
+		nc := newConfig()
+		nc.HTTPServer = &http.ServerConfig{Addr: "127.0.0.1:7173"}
+		nc.ProtectThreshold = 0.5
+		restarts := svr.Reload(nc)
+		So(restarts, ShouldResemble, []string{"httpServer"})
+		So(svr.config().HTTPServer.Addr, ShouldEqual, "127.0.0.1:7171")
+		So(svr.config().Nodes, ShouldResemble, []string{"127.0.0.1:7171", "127.0.0.1:7172"})
+		So(svr.config().ProtectThreshold, ShouldEqual, 0.5)
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	Convey("test authorize write operations", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171"}
+		c.Auth = &conf.AuthConfig{
+			Tokens:      map[string][]string{"main.arch.test": {"app"}, "main.arch.test2/pre": {"app2"}},
+			Key:         "secret",
+			AdminTokens: []string{"admin"},
+		}
+		svr, cancel := New(c)
+		defer cancel()
+		So(svr.Authorize("", "main.arch.test", "pre"), ShouldResemble, ecode.Unauthorized)
+		So(svr.Authorize("app", "main.arch.test", "pre"), ShouldBeNil)
+		So(svr.Authorize("app", "main.arch.test2", "pre"), ShouldResemble, ecode.AccessDenied)
+		So(svr.Authorize("app2", "main.arch.test2", "pre"), ShouldBeNil)
+		So(svr.Authorize("app2", "main.arch.test2", "prod"), ShouldResemble, ecode.AccessDenied)
+		So(svr.Authorize("admin", "main.arch.test2", "prod"), ShouldBeNil)
+		signed := c.Auth.Sign("main.arch.test3", "pre", time.Now().Add(time.Minute))
+		So(svr.Authorize(signed, "main.arch.test3", "pre"), ShouldBeNil)
+		So(svr.Authorize(signed, "main.arch.test3", "prod"), ShouldResemble, ecode.AccessDenied)
+		expired := c.Auth.Sign("main.arch.test3", "", time.Now().Add(-time.Minute))
+		So(svr.Authorize(expired, "main.arch.test3", "pre"), ShouldResemble, ecode.AccessDenied)
+		forged := (&conf.AuthConfig{Key: "forged"}).Sign("main.arch.test3", "", time.Time{})
+		So(svr.Authorize(forged, "main.arch.test3", "pre"), ShouldResemble, ecode.AccessDenied)
+		So(svr.AuthorizeAdmin("app"), ShouldResemble, ecode.AccessDenied)
+		So(svr.AuthorizeAdmin("admin"), ShouldBeNil)
+	})
+}
+
+func TestAuthorizePeer(t *testing.T) {
+	Convey("test authorize peers by host or admin token", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171", "localhost:7172"}
+		c.Zones = map[string][]string{"sh002": {"10.0.0.2:7171"}}
+		svr, cancel := New(c)
+		defer cancel()
+		So(svr.AuthorizePeer("", "127.0.0.1:52000"), ShouldBeNil)
+		So(svr.AuthorizePeer("", "10.0.0.2:52000"), ShouldBeNil)
+		So(svr.AuthorizePeer("", "10.0.0.3:52000"), ShouldResemble, ecode.AccessDenied)
+		c.Auth = &conf.AuthConfig{AdminTokens: []string{"admin"}}
+		So(svr.AuthorizePeer("", "127.0.0.1:52000"), ShouldResemble, ecode.Unauthorized)
+		So(svr.AuthorizePeer("admin", "10.0.0.3:52000"), ShouldBeNil)
+	})
+}
@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/bilibili/discovery/model"
+	"github.com/bilibili/discovery/registry"
+)
+
+// Live returns the status of discovery node without peers and size of registry, cheap enough for liveness probes.
+// It is UP as long as the node serves, protect mode is reported by Health only.
+func (d *Discovery) Live(c context.Context) (h *model.Health) {
+	h = &model.Health{
+		Status:           model.HealthUP,
+		Synced:           atomic.LoadInt32(&d.synced) == 1,
+		Protected:        d.Protected(),
+		SelfPreservation: d.registry.SelfPreservation(),
+	}
+	return
+}
+
+// Health returns the health of discovery node, it is UP once reads are served.
+func (d *Discovery) Health(c context.Context) (h *model.Health) {
+	h = d.Live(c)
+	if h.Protected {
+		h.Status = model.HealthDown
+	}
+	h.Peers = []*model.Node{}
+	nodes := d.nodes.Load().(*registry.Nodes)
+	for _, node := range nodes.AllNodes() {
+		if nodes.Myself(node.Addr) {
+			continue
+		}
+		h.Peers = append(h.Peers, node)
+		if node.Status == model.NodeStatusUP {
+			h.PeersUP++
+		}
+	}
+	h.Apps, h.Instances = d.registry.Size()
+	return
+}
@@ -0,0 +1,50 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bilibili/discovery/model"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHealth(t *testing.T) {
+	Convey("test health of single node", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171"}
+		c.EnableProtect = true
+		svr, cancel := New(c)
+		defer cancel()
+		h := svr.Health(context.TODO())
+		So(h.Synced, ShouldBeTrue)
+		So(h.Protected, ShouldBeTrue)
+		So(h.Status, ShouldEqual, model.HealthDown)
+		So(len(h.Peers), ShouldEqual, 0)
+		So(h.Apps, ShouldEqual, 1)
+		So(h.Instances, ShouldEqual, 1)
+		So(svr.Live(context.TODO()).Status, ShouldEqual, model.HealthUP)
+		So(svr.Live(context.TODO()).Protected, ShouldBeTrue)
+		svr.protected = 0
+		So(svr.Health(context.TODO()).Status, ShouldEqual, model.HealthUP)
+	})
+}
+
+func TestStaleRead(t *testing.T) {
+	Convey("test stale read in protect mode", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171"}
+		c.EnableProtect = true
+		c.StaleRead = true
+		svr, cancel := New(c)
+		defer cancel()
+		So(svr.Protected(), ShouldBeTrue)
+		info, err := svr.Fetch(context.TODO(), &model.ArgFetch{Zone: "sh001", Env: "pre", AppID: model.AppID, Status: 3})
+		So(err, ShouldBeNil)
+		So(info.Stale, ShouldBeTrue)
+		arg := &model.ArgPolls{Zone: "sh001", Env: "pre", AppID: []string{model.AppID}, LatestTimestamp: []int64{info.LatestTimestamp}, Hostname: "test"}
+		ch, _, _, err := svr.Polls(context.TODO(), arg)
+		So(err, ShouldBeNil)
+		So((<-ch)[model.AppID].Stale, ShouldBeTrue)
+	})
+}
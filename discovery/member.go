@@ -0,0 +1,278 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/model"
+	"github.com/bilibili/discovery/registry"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+	log "github.com/go-kratos/kratos/pkg/log"
+)
+
+// members is the membership of discovery cluster.
+// The peers configured, or discovered by self registration if any, are overlaid with the peers
+// added or removed by admin api, which are persisted into conf.MemberFile.
+type members struct {
+	lock       sync.Mutex
+	file       string
+	discovered map[string][]string      // zone -> addrs, nil if nothing discovered
+	admin      map[string]*model.Member // zone/host -> member
+}
+
+func newMembers(file string) (m *members) {
+	m = &members{
+		file:  file,
+		admin: make(map[string]*model.Member),
+	}
+	if file == "" {
+		return
+	}
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("members read file(%s) error(%v)", file, err)
+		}
+		return
+	}
+	var ms []*model.Member
+	if err = json.Unmarshal(bs, &ms); err != nil {
+		log.Error("members unmarshal file(%s) error(%v)", file, err)
+		return
+	}
+	for _, mb := range ms {
+		m.admin[memberKey(mb.Zone, mb.Addr)] = mb
+	}
+	log.Info("members load %d admin members from file(%s)", len(ms), file)
+	return
+}
+
+// memberKey ignores the scheme of addr, so that configured and discovered addrs of a node match.
+func memberKey(zone, addr string) string {
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		addr = u.Host
+	}
+	return zone + "/" + addr
+}
+
+func (m *members) save() (err error) {
+	if m.file == "" {
+		return
+	}
+	ms := make([]*model.Member, 0, len(m.admin))
+	for _, mb := range m.admin {
+		ms = append(ms, mb)
+	}
+	bs, err := json.Marshal(ms)
+	if err != nil {
+		return
+	}
+	tmp := m.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, bs, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, m.file)
+}
+
+// list returns all members ordered by zone and addr, including the ones removed by admin.
+func (m *members) list(c *conf.Config) (ms []*model.Member) {
+	var (
+		keys = make(map[string]struct{})
+		add  = func(zone, addr, source string) {
+			key := memberKey(zone, addr)
+			if _, ok := keys[key]; ok {
+				return
+			}
+			keys[key] = struct{}{}
+			mb := &model.Member{Zone: zone, Addr: addr, Source: source, State: model.MemberActive}
+			if am, ok := m.admin[key]; ok && am.State != model.MemberActive {
+				mb.Source = model.MemberSourceAdmin
+				mb.State = am.State
+			}
+			ms = append(ms, mb)
+		}
+		lbZones = make(map[string]bool, len(c.LBZones))
+	)
+	for _, zone := range c.LBZones {
+		lbZones[zone] = true
+	}
+	if m.discovered != nil {
+		for zone, addrs := range m.discovered {
+			if lbZones[zone] {
+				continue
+			}
+			for _, addr := range addrs {
+				add(zone, addr, model.MemberSourceDiscovered)
+			}
+		}
+		// NOTE: zones configured as load balancer keep the configured address.
+		for zone := range lbZones {
+			for _, addr := range c.Zones[zone] {
+				add(zone, addr, model.MemberSourceConfig)
+			}
+		}
+	} else {
+		for _, addr := range c.Nodes {
+			add(c.Env.Zone, addr, model.MemberSourceConfig)
+		}
+		for zone, addrs := range c.Zones {
+			for _, addr := range addrs {
+				add(zone, addr, model.MemberSourceConfig)
+			}
+		}
+	}
+	for _, am := range m.admin {
+		add(am.Zone, am.Addr, model.MemberSourceAdmin)
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Zone != ms[j].Zone {
+			return ms[i].Zone < ms[j].Zone
+		}
+		return ms[i].Addr < ms[j].Addr
+	})
+	return
+}
+
+// config returns a copy of c whose nodes and zones are the active members.
+func (m *members) config(c *conf.Config) (nc *conf.Config) {
+	nc = new(conf.Config)
+	*nc = *c
+	nc.Nodes = nil
+	nc.Zones = make(map[string][]string)
+	for _, mb := range m.list(c) {
+		if mb.State != model.MemberActive {
+			continue
+		}
+		if mb.Zone == c.Env.Zone {
+			nc.Nodes = append(nc.Nodes, mb.Addr)
+		} else {
+			nc.Zones[mb.Zone] = append(nc.Zones[mb.Zone], mb.Addr)
+		}
+	}
+	return
+}
+
+// Members returns the membership of discovery cluster and where each member comes from.
+func (d *Discovery) Members(c context.Context) []*model.Member {
+	d.members.lock.Lock()
+	defer d.members.lock.Unlock()
+	return d.members.list(d.config())
+}
+
+// AddMember adds a peer into discovery cluster.
+func (d *Discovery) AddMember(c context.Context, arg *model.ArgMember) (err error) {
+	return d.setMember(c, arg, model.MemberActive)
+}
+
+// RemoveMember removes a peer from discovery cluster, even if it is configured or discovered.
+func (d *Discovery) RemoveMember(c context.Context, arg *model.ArgMember) (err error) {
+	return d.setMember(c, arg, model.MemberRemoved)
+}
+
+// DecommissionMember removes a peer from discovery cluster and cancels its self registration,
+// so that clients stop using it. The peer stops its self registration once replicated, and should be stopped after that.
+func (d *Discovery) DecommissionMember(c context.Context, arg *model.ArgMember) (err error) {
+	if err = d.setMember(c, arg, model.MemberDecommissioned); err != nil {
+		return
+	}
+	if arg.Replication || arg.FromZone {
+		// NOTE: the node called cancels and replicates it.
+		return
+	}
+	info, err := d.registry.Fetch(arg.Zone, d.config().Env.DeployEnv, model.AppID, 0, model.InstanceStatusUP|model.InstancestatusWating)
+	if err != nil {
+		// NOTE: not registered, nothing to cancel.
+		return nil
+	}
+	key := memberKey(arg.Zone, arg.Addr)
+	for _, is := range info.Instances {
+		for _, i := range is {
+			for _, addr := range i.Addrs {
+				if memberKey(i.Zone, addr) != key {
+					continue
+				}
+				arg := &model.ArgCancel{
+					AppID:      model.AppID,
+					Zone:       i.Zone,
+					Env:        i.Env,
+					Hostname:   i.Hostname,
+					InstanceID: i.ID(),
+				}
+				if err := d.Cancel(c, arg); err != nil {
+					log.Error("d.Cancel(%+v) error(%v)", arg, err)
+				}
+				break
+			}
+		}
+	}
+	return
+}
+
+// setMember changes the member and replicates it to peers, including the member itself,
+// which stops its self registration if decommissioned.
+func (d *Discovery) setMember(c context.Context, arg *model.ArgMember, state string) (err error) {
+	if arg.Zone == "" {
+		arg.Zone = d.config().Env.Zone
+	}
+	_, addr := d.config().SplitAddr(arg.Addr)
+	myself := arg.Zone == d.config().Env.Zone && addr == d.config().HTTPServer.Addr
+	if myself && !arg.Replication && !arg.FromZone {
+		log.Error("member(%s) is myself, can not be %s", arg.Addr, state)
+		return ecode.RequestErr
+	}
+	// NOTE: replicate to the nodes before removed, so that the member removed knows it.
+	ns := d.nodes.Load().(*registry.Nodes)
+	if myself {
+		if state == model.MemberDecommissioned {
+			log.Warn("member(%s) is myself and decommissioned, cancel self registration", arg.Addr)
+			d.selfCancel()
+		}
+	} else if err = d.storeMember(arg, state); err != nil {
+		return
+	}
+	if state == model.MemberActive {
+		ns = d.nodes.Load().(*registry.Nodes)
+	}
+	if !arg.Replication {
+		defer d.replicating()()
+		_ = ns.ReplicateMember(c, arg, state, arg.FromZone)
+	}
+	return
+}
+
+func (d *Discovery) storeMember(arg *model.ArgMember, state string) (err error) {
+	m := d.members
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.admin[memberKey(arg.Zone, arg.Addr)] = &model.Member{
+		Zone:   arg.Zone,
+		Addr:   arg.Addr,
+		Source: model.MemberSourceAdmin,
+		State:  state,
+	}
+	if err = m.save(); err != nil {
+		log.Error("members save file(%s) error(%v)", m.file, err)
+		return ecode.ServerErr
+	}
+	d.storeNodes()
+	log.Info("member zone(%s) addr(%s) changed to %s", arg.Zone, arg.Addr, state)
+	return
+}
+
+// storeNodes rebuilds nodes from the active members, members lock must be held.
+func (d *Discovery) storeNodes() {
+	c := d.members.config(d.config())
+	ns := registry.NewNodes(c)
+	old, _ := d.nodes.Load().(*registry.Nodes)
+	ns.Inherit(old)
+	ns.UP()
+	d.nodes.Store(ns)
+	log.Info("discovery changed nodes:%v zones:%v", c.Nodes, c.Zones)
+}
@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bilibili/discovery/model"
+	"github.com/go-kratos/kratos/pkg/ecode"
+
+	. "github.com/smartystreets/goconvey/convey"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestMembers(t *testing.T) {
+	Convey("test members", t, func() {
+		dir, err := ioutil.TempDir("", "discovery")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		c := newConfig()
+		c.MemberFile = filepath.Join(dir, "members.json")
+		svr, cancel := New(c)
+		defer cancel()
+		svr.httpClient().SetTransport(gock.DefaultTransport)
+		err = svr.RemoveMember(context.TODO(), &model.ArgMember{Addr: "127.0.0.1:7172"})
+		So(err, ShouldBeNil)
+		for _, n := range svr.Nodes(context.TODO()) {
+			So(n.Addr, ShouldNotEqual, "127.0.0.1:7172")
+		}
+		err = svr.AddMember(context.TODO(), &model.ArgMember{Zone: "sh002", Addr: "127.0.0.1:7181"})
+		So(err, ShouldBeNil)
+		err = svr.RemoveMember(context.TODO(), &model.ArgMember{Addr: "127.0.0.1:7171"})
+		So(err, ShouldResemble, ecode.RequestErr)
+		ms := make(map[string]*model.Member)
+		for _, m := range svr.Members(context.TODO()) {
+			ms[memberKey(m.Zone, m.Addr)] = m
+		}
+		So(ms["sh001/127.0.0.1:7171"], ShouldNotBeNil)
+		So(ms["sh001/127.0.0.1:7172"].Source, ShouldEqual, model.MemberSourceAdmin)
+		So(ms["sh001/127.0.0.1:7172"].State, ShouldEqual, model.MemberRemoved)
+		So(ms["sh002/127.0.0.1:7181"].Source, ShouldEqual, model.MemberSourceAdmin)
+		So(ms["sh002/127.0.0.1:7181"].State, ShouldEqual, model.MemberActive)
+		Convey("test members persisted", func() {
+			m := newMembers(c.MemberFile)
+			nc := m.config(c)
+			So(nc.Nodes, ShouldResemble, []string{"127.0.0.1:7171"})
+			So(nc.Zones["sh002"], ShouldResemble, []string{"127.0.0.1:7181"})
+		})
+	})
+}
+
+func TestMembersReplicate(t *testing.T) {
+	Convey("test members replicate", t, func() {
+		var (
+			mu    sync.Mutex
+			calls = make(map[string]url.Values)
+		)
+		peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/discovery/members/") {
+				r.ParseForm()
+				mu.Lock()
+				calls[r.URL.Path] = r.Form
+				mu.Unlock()
+			}
+			w.Write([]byte(`{"code":0}`))
+		}))
+		defer peer.Close()
+		addr := strings.TrimPrefix(peer.URL, "http://")
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171", addr}
+		svr, cancel := New(c)
+		defer cancel()
+		Convey("test removed member replicated", func() {
+			err := svr.DecommissionMember(context.TODO(), &model.ArgMember{Addr: addr})
+			So(err, ShouldBeNil)
+			mu.Lock()
+			form := calls["/discovery/members/decommission"]
+			mu.Unlock()
+			So(form, ShouldNotBeNil)
+			So(form.Get("zone"), ShouldEqual, "sh001")
+			So(form.Get("addr"), ShouldEqual, addr)
+			So(form.Get("replication"), ShouldEqual, "true")
+			for _, n := range svr.Nodes(context.TODO()) {
+				So(n.Addr, ShouldNotEqual, addr)
+			}
+		})
+		Convey("test myself decommissioned by peer", func() {
+			err := svr.DecommissionMember(context.TODO(), &model.ArgMember{Addr: "127.0.0.1:7171", Replication: true})
+			So(err, ShouldBeNil)
+			select {
+			case <-svr.selfDone:
+			case <-time.After(time.Second):
+				t.Fatal("self registration not canceled")
+			}
+			for _, m := range svr.Members(context.TODO()) {
+				So(m.State, ShouldEqual, model.MemberActive)
+			}
+			mu.Lock()
+			So(calls, ShouldBeEmpty)
+			mu.Unlock()
+		})
+	})
+}
@@ -2,6 +2,7 @@ package discovery
 
 import (
 	"context"
+	"net"
 
 	"github.com/bilibili/discovery/model"
 	"github.com/bilibili/discovery/registry"
@@ -13,20 +14,32 @@ import (
 func (d *Discovery) Register(c context.Context, ins *model.Instance, latestTimestamp int64, replication bool, fromzone bool) {
 	_ = d.registry.Register(ins, latestTimestamp)
 	if !replication {
+		defer d.replicating()()
 		_ = d.nodes.Load().(*registry.Nodes).Replicate(c, model.Register, ins, fromzone)
 	}
 }
 
+// CheckMetadata checks the metadata of an instance to register against the limit.
+func (d *Discovery) CheckMetadata(md map[string]string) error {
+	return d.registry.MetadataLimit().Validate(md)
+}
+
+// Now returns a timestamp of the hybrid logical clock of registry.
+func (d *Discovery) Now() int64 {
+	return d.registry.Now()
+}
+
 // Renew marks the given instance of the given app name as renewed, and also marks whether it originated from replication.
 func (d *Discovery) Renew(c context.Context, arg *model.ArgRenew) (i *model.Instance, err error) {
 	i, ok := d.registry.Renew(arg)
 	if !ok {
 		err = ecode.NothingFound
-		log.Error("renew appid(%s) hostname(%s) zone(%s) env(%s) error", arg.AppID, arg.Hostname, arg.Zone, arg.Env)
+		log.Error("renew appid(%s) instance(%s) zone(%s) env(%s) error", arg.AppID, arg.ID(), arg.Zone, arg.Env)
 		return
 	}
 	if !arg.Replication {
-		_ = d.nodes.Load().(*registry.Nodes).Replicate(c, model.Renew, i, arg.Zone != d.c.Env.Zone)
+		defer d.replicating()()
+		_ = d.nodes.Load().(*registry.Nodes).Replicate(c, model.Renew, i, arg.Zone != d.config().Env.Zone)
 		return
 	}
 	if arg.DirtyTimestamp > i.DirtyTimestamp {
@@ -42,11 +55,12 @@ func (d *Discovery) Cancel(c context.Context, arg *model.ArgCancel) (err error)
 	i, ok := d.registry.Cancel(arg)
 	if !ok {
 		err = ecode.NothingFound
-		log.Error("cancel appid(%s) hostname(%s) error", arg.AppID, arg.Hostname)
+		log.Error("cancel appid(%s) instance(%s) error", arg.AppID, arg.ID())
 		return
 	}
 	if !arg.Replication {
-		_ = d.nodes.Load().(*registry.Nodes).Replicate(c, model.Cancel, i, arg.Zone != d.c.Env.Zone)
+		defer d.replicating()()
+		_ = d.nodes.Load().(*registry.Nodes).Replicate(c, model.Cancel, i, arg.Zone != d.config().Env.Zone)
 	}
 	return
 }
@@ -56,28 +70,74 @@ func (d *Discovery) FetchAll(c context.Context) (im map[string][]*model.Instance
 	return d.registry.FetchAll()
 }
 
+// SyncApps returns a page of app summaries after cursor.
+func (d *Discovery) SyncApps(c context.Context, arg *model.ArgSyncApps) (res *model.SyncApps) {
+	return d.registry.SyncApps(arg.Cursor, arg.Ps)
+}
+
+// SyncApp returns all instances of an app with their checksum.
+func (d *Discovery) SyncApp(c context.Context, arg *model.ArgSyncApp) (res *model.SyncApp, err error) {
+	return d.registry.SyncApp(arg.AppID, arg.Env)
+}
+
+// Services returns the instances of all apps in env and zone, and the latest timestamp of the apps.
+func (d *Discovery) Services(c context.Context, env, zone string) (apps map[string][]*model.Instance, latest int64) {
+	return d.registry.Services(env, zone)
+}
+
+// Removed returns the instances of env cancelled or evicted after ts.
+func (d *Discovery) Removed(c context.Context, env string, ts int64) []*model.Instance {
+	return d.registry.Removed(env, ts)
+}
+
+// Changes returns a page of registry changes after cursor, and a channel closed on the next change.
+func (d *Discovery) Changes(c context.Context, arg *model.ArgChanges) (cs *model.Changes, notify <-chan struct{}, err error) {
+	return d.registry.Changes(arg.Cursor, arg.Ps)
+}
+
 // Fetch fetch all instances by appid.
 func (d *Discovery) Fetch(c context.Context, arg *model.ArgFetch) (info *model.InstanceInfo, err error) {
-	return d.registry.Fetch(arg.Zone, arg.Env, arg.AppID, 0, arg.Status)
+	if info, err = d.registry.Fetch(arg.Zone, arg.Env, arg.AppID, 0, arg.Status); err == nil {
+		info = info.FilterScheme(arg.Scheme)
+		info.Stale = d.Protected()
+	}
+	return
 }
 
 // Fetchs fetch multi app by appids.
 func (d *Discovery) Fetchs(c context.Context, arg *model.ArgFetchs) (is map[string]*model.InstanceInfo, err error) {
 	is = make(map[string]*model.InstanceInfo, len(arg.AppID))
+	stale := d.Protected()
 	for _, appid := range arg.AppID {
 		i, err := d.registry.Fetch(arg.Zone, arg.Env, appid, 0, arg.Status)
 		if err != nil {
 			log.Error("Fetchs fetch appid(%v) err", err)
 			continue
 		}
+		i = i.FilterScheme(arg.Scheme)
+		i.Stale = stale
 		is[appid] = i
 	}
 	return
 }
 
 // Polls hangs request and then write instances when that has changes, or return NotModified.
+// In protect mode polls answer at once with stale instances, so that clients switch to a complete node.
 func (d *Discovery) Polls(c context.Context, arg *model.ArgPolls) (ch chan map[string]*model.InstanceInfo, new bool, miss []string, err error) {
-	return d.registry.Polls(arg)
+	if !d.Protected() {
+		return d.registry.Polls(arg)
+	}
+	sarg := *arg
+	sarg.LatestTimestamp = make([]int64, len(arg.AppID))
+	if ch, new, miss, err = d.registry.Polls(&sarg); err != nil || !new {
+		return
+	}
+	ins := <-ch
+	for _, i := range ins {
+		i.Stale = true
+	}
+	ch <- ins
+	return
 }
 
 // DelConns delete conn of host in appid
@@ -85,18 +145,81 @@ func (d *Discovery) DelConns(arg *model.ArgPolls) {
 	d.registry.DelConns(arg)
 }
 
+// Authorize checks whether token is allowed to write the instances of appid in env.
+func (d *Discovery) Authorize(token, appid, env string) error {
+	return d.config().Auth.Verify(token, appid, env)
+}
+
+// AuthorizeAdmin checks whether token is allowed to call operator apis.
+func (d *Discovery) AuthorizeAdmin(token string) error {
+	return d.config().Auth.VerifyAdmin(token)
+}
+
+// AuthorizePeer checks whether the request is sent by a peer node: the token must be an admin token
+// if authorization is enabled, otherwise the remote host must be the host of a node.
+func (d *Discovery) AuthorizePeer(token, remoteAddr string) error {
+	if d.config().Auth.Enabled() {
+		return d.config().Auth.VerifyAdmin(token)
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if !d.nodes.Load().(*registry.Nodes).Peer(host) {
+		return ecode.AccessDenied
+	}
+	return nil
+}
+
+// StaleRead returns whether reads are served with stale data in protect mode.
+func (d *Discovery) StaleRead() bool {
+	return d.config().StaleRead
+}
+
 // Nodes get all nodes of discovery.
 func (d *Discovery) Nodes(c context.Context) (nsi []*model.Node) {
 	return d.nodes.Load().(*registry.Nodes).Nodes()
 }
 
 // Set set metadata,color,status of instance.
-func (d *Discovery) Set(c context.Context, arg *model.ArgSet) (err error) {
-	if !d.registry.Set(arg) {
-		err = ecode.RequestErr
+// Stale changes are rejected with ecode.Conflict and the current instances, which the caller uses to re-sync.
+// The newer instances of peers in conflict with the replication are resolved locally.
+func (d *Discovery) Set(c context.Context, arg *model.ArgSet) (conflicts []*model.Instance, err error) {
+	if arg.SetTimestamp == 0 {
+		arg.SetTimestamp = d.registry.Now()
+	}
+	if conflicts, err = d.registry.Set(arg); err == ecode.Conflict {
+		log.Warn("set appid(%s) env(%s) hostname(%v) conflict set_timestamp(%d)", arg.AppID, arg.Env, arg.Hostname, arg.SetTimestamp)
+		return
+	} else if err != nil && err != ecode.NothingFound {
+		// NOTE: not found is still replicated, in case the instance is registered on peers only.
+		return
+	}
+	if !arg.Replication {
+		defer d.replicating()()
+		peers, _ := d.nodes.Load().(*registry.Nodes).ReplicateSet(c, arg, arg.FromZone)
+		d.registry.Resolve(peers)
+	}
+	return
+}
+
+// Overrides lists the status and metadata kept by operator over registrations.
+func (d *Discovery) Overrides(c context.Context, arg *model.ArgOverrides) []*model.Override {
+	return d.registry.Overrides(arg.AppID, arg.Env, arg.Cleared)
+}
+
+// ClearOverride clears the override of an instance, which restores the status and metadata registered.
+func (d *Discovery) ClearOverride(c context.Context, arg *model.ArgClearOverride) (err error) {
+	if arg.ClearTimestamp == 0 {
+		arg.ClearTimestamp = d.registry.Now()
+	}
+	if !d.registry.ClearOverride(arg.AppID, arg.Env, arg.ID(), arg.ClearTimestamp) {
+		err = ecode.NothingFound
 	}
+	// NOTE: replicate even if not found, in case peers missed the clear before.
 	if !arg.Replication {
-		d.nodes.Load().(*registry.Nodes).ReplicateSet(c, arg, arg.FromZone)
+		defer d.replicating()()
+		_ = d.nodes.Load().(*registry.Nodes).ReplicateClearOverride(c, arg, arg.FromZone)
 	}
 	return
 }
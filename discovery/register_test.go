@@ -3,8 +3,11 @@ package discovery
 import (
 	"context"
 	"flag"
+	xhttp "net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -112,7 +115,7 @@ func TestRegister(t *testing.T) {
 	Convey("test Register", t, func() {
 		svr, cancel := New(config)
 		defer cancel()
-		svr.client.SetTransport(gock.DefaultTransport)
+		svr.httpClient().SetTransport(gock.DefaultTransport)
 		svr.syncUp()
 		i := model.NewInstance(reg)
 		svr.Register(context.TODO(), i, reg.LatestTimestamp, reg.Replication, true)
@@ -129,7 +132,7 @@ func TestRegister(t *testing.T) {
 			}
 		})
 		Convey("test set", func() {
-			err = svr.Set(context.TODO(), set)
+			_, err = svr.Set(context.TODO(), set)
 			So(err, ShouldBeNil)
 			ins, err = svr.Fetch(context.TODO(), fet)
 			So(err, ShouldBeNil)
@@ -146,7 +149,7 @@ func TestDiscovery(t *testing.T) {
 	Convey("test cancel polls", t, func() {
 		svr, disCancel := New(config)
 		defer disCancel()
-		svr.client.SetTransport(gock.DefaultTransport)
+		svr.httpClient().SetTransport(gock.DefaultTransport)
 		reg2 := defRegisArg()
 		reg2.Hostname = "test2"
 		i1 := model.NewInstance(reg)
@@ -173,7 +176,7 @@ func TestFetchs(t *testing.T) {
 	Convey("test fetch multi appid", t, func() {
 		svr, cancel := New(config)
 		defer cancel()
-		svr.client.SetTransport(gock.DefaultTransport)
+		svr.httpClient().SetTransport(gock.DefaultTransport)
 		reg2 := defRegisArg()
 		reg2.AppID = "appid2"
 		i1 := model.NewInstance(reg)
@@ -187,11 +190,42 @@ func TestFetchs(t *testing.T) {
 		So(len(is), ShouldResemble, 2)
 	})
 }
+func TestFetchScheme(t *testing.T) {
+	Convey("test fetch addrs of scheme", t, func() {
+		svr, cancel := New(config)
+		defer cancel()
+		svr.httpClient().SetTransport(gock.DefaultTransport)
+		arg := defRegisArg()
+		arg.AppID = "main.arch.scheme"
+		arg.Addrs = []string{"http://127.0.0.1:8000", "grpc://127.0.0.1:9000?weight=20"}
+		So(model.ValidateAddrs(arg.Addrs), ShouldBeNil)
+		So(model.ValidateAddrs([]string{"127.0.0.1:9000"}), ShouldNotBeNil)
+		So(model.ValidateAddrs([]string{"grpc://127.0.0.1"}), ShouldNotBeNil)
+		svr.Register(ctx, model.NewInstance(arg), arg.LatestTimestamp, arg.Replication, arg.FromZone)
+		f := &model.ArgFetch{AppID: arg.AppID, Zone: "sh001", Env: "pre", Status: 1, Scheme: []string{"grpc"}}
+		info, err := svr.Fetch(ctx, f)
+		So(err, ShouldBeNil)
+		i := info.Instances["sh001"][0]
+		So(i.Addrs, ShouldResemble, []string{"grpc://127.0.0.1:9000?weight=20"})
+		es := i.Endpoints()
+		So(len(es), ShouldEqual, 1)
+		So(es[0].Addr(), ShouldEqual, "127.0.0.1:9000")
+		So(es[0].Weight(10), ShouldEqual, 20)
+		f.Scheme = []string{"thrift"}
+		info, err = svr.Fetch(ctx, f)
+		So(err, ShouldBeNil)
+		So(len(info.Instances), ShouldEqual, 0)
+		f.Scheme = nil
+		info, err = svr.Fetch(ctx, f)
+		So(err, ShouldBeNil)
+		So(len(info.Instances["sh001"][0].Addrs), ShouldEqual, 2)
+	})
+}
 func TestZones(t *testing.T) {
 	Convey("test multi zone discovery", t, func() {
 		svr, cancel := New(config)
 		defer cancel()
-		svr.client.SetTransport(gock.DefaultTransport)
+		svr.httpClient().SetTransport(gock.DefaultTransport)
 		reg2 := defRegisArg()
 		reg2.Zone = "sh002"
 		i1 := model.NewInstance(reg)
@@ -233,7 +267,7 @@ func TestRenew(t *testing.T) {
 	Convey("test Renew", t, func() {
 		svr, cancel := New(config)
 		defer cancel()
-		svr.client.SetTransport(gock.DefaultTransport)
+		svr.httpClient().SetTransport(gock.DefaultTransport)
 		i := model.NewInstance(reg)
 		svr.Register(context.TODO(), i, reg.LatestTimestamp, reg.Replication, reg.FromZone)
 		_, err := svr.Renew(context.TODO(), rew)
@@ -256,7 +290,7 @@ func TestCancel(t *testing.T) {
 	Convey("test cancel", t, func() {
 		svr, disCancel := New(config)
 		defer disCancel()
-		svr.client.SetTransport(gock.DefaultTransport)
+		svr.httpClient().SetTransport(gock.DefaultTransport)
 		i := model.NewInstance(reg)
 		svr.Register(context.TODO(), i, reg.LatestTimestamp, reg.Replication, reg.FromZone)
 		err := svr.Cancel(context.TODO(), cancel)
@@ -272,7 +306,7 @@ func TestFetchAll(t *testing.T) {
 	Convey("test fetch all", t, func() {
 		svr, cancel := New(config)
 		defer cancel()
-		svr.client.SetTransport(gock.DefaultTransport)
+		svr.httpClient().SetTransport(gock.DefaultTransport)
 		i := model.NewInstance(reg)
 		svr.Register(context.TODO(), i, reg.LatestTimestamp, reg.Replication, reg.FromZone)
 		fs := svr.FetchAll(context.TODO())[i.AppID]
@@ -284,10 +318,34 @@ func TestNodes(t *testing.T) {
 	Convey("test nodes", t, func() {
 		svr, cancel := New(config)
 		defer cancel()
-		svr.client.SetTransport(gock.DefaultTransport)
+		svr.httpClient().SetTransport(gock.DefaultTransport)
 		svr.Register(context.Background(), defRegDiscovery(), time.Now().UnixNano(), false, true)
 		time.Sleep(time.Second)
 		ns := svr.Nodes(context.TODO())
 		So(len(ns), ShouldResemble, 2)
 	})
 }
+
+func TestSetReplicate(t *testing.T) {
+	var sets int32
+	peer := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		if r.URL.Path == "/discovery/set" {
+			atomic.AddInt32(&sets, 1)
+		}
+		w.Write([]byte(`{"code":0}`))
+	}))
+	defer peer.Close()
+	Convey("test failed set is not replicated", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171", strings.TrimPrefix(peer.URL, "http://")}
+		svr, cancel := New(c)
+		defer cancel()
+		svr.Register(context.TODO(), model.NewInstance(reg), 0, true, false)
+		_, err := svr.Set(context.TODO(), &model.ArgSet{AppID: "main.arch.test", Zone: "sh001", Env: "pre", Hostname: []string{"test1"}, Status: []int64{5}})
+		So(ecode.Cause(err).Code(), ShouldEqual, ecode.RequestErr.Code())
+		So(atomic.LoadInt32(&sets), ShouldEqual, 0)
+		_, err = svr.Set(context.TODO(), &model.ArgSet{AppID: "main.arch.test", Zone: "sh001", Env: "pre", Hostname: []string{"test1"}, Status: []int64{2}})
+		So(err, ShouldBeNil)
+		So(atomic.LoadInt32(&sets), ShouldEqual, 1)
+	})
+}
@@ -4,69 +4,240 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync/atomic"
 	"time"
 
-	"github.com/bilibili/discovery/conf"
 	"github.com/bilibili/discovery/model"
 	"github.com/bilibili/discovery/registry"
 	"github.com/go-kratos/kratos/pkg/ecode"
 	log "github.com/go-kratos/kratos/pkg/log"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	_nodesPollWait = 30 * time.Second
+
+	_syncParallel  = 8
+	_syncRetry     = 3
+	_syncRetryWait = time.Second
 )
 
 var (
-	_fetchAllURL = "http://%s/discovery/fetch/all"
+	_fetchAllURL = "%s://%s/discovery/fetch/all"
+	_syncAppsURL = "%s://%s/discovery/sync/apps"
+	_syncAppURL  = "%s://%s/discovery/sync/app"
+	_overrideURL = "%s://%s/discovery/overrides?cleared=true"
 )
 
 // Protected return if service in init protect mode.
 // if service in init protect mode,only support write,
 // read operator isn't supported.
 func (d *Discovery) Protected() bool {
-	return d.protected
+	return atomic.LoadInt32(&d.protected) == 1
 }
 
 // syncUp populates the registry information from a peer eureka node.
 func (d *Discovery) syncUp() {
 	nodes := d.nodes.Load().(*registry.Nodes)
+	var peers int
 	for _, node := range nodes.AllNodes() {
 		if nodes.Myself(node.Addr) {
 			continue
 		}
-		uri := fmt.Sprintf(_fetchAllURL, node.Addr)
+		peers++
+		d.syncOverrides(node)
+		if pages, err := d.syncPages(node); err != nil {
+			if pages != 0 {
+				log.Error("service syncup from(%s) interrupted error(%v)", node.Addr, err)
+				continue
+			}
+			// NOTE: peer of old version does not support paged sync.
+			log.Warn("service syncup pages from(%s) error(%v), fallback to fetch all", node.Addr, err)
+			if err = d.syncAll(node); err != nil {
+				continue
+			}
+		}
+		// sync success from other node,exit protected mode
+		atomic.StoreInt32(&d.protected, 0)
+		atomic.StoreInt32(&d.synced, 1)
+		// NOTE: no continue, make sure that all instances from other nodes register into self.
+	}
+	if peers == 0 {
+		atomic.StoreInt32(&d.synced, 1)
+	}
+	nodes.UP()
+}
+
+// syncAll downloads the whole registry of node with one request.
+func (d *Discovery) syncAll(node *model.Node) (err error) {
+	uri := fmt.Sprintf(_fetchAllURL, node.Scheme, node.Addr)
+	var res struct {
+		Code int                          `json:"code"`
+		Data map[string][]*model.Instance `json:"data"`
+	}
+	if err = d.httpClient().Get(context.TODO(), uri, "", nil, &res); err != nil {
+		log.Error("d.client.Get(%v) error(%v)", uri, err)
+		return
+	}
+	if res.Code != 0 {
+		log.Error("service syncup from(%s) failed ", uri)
+		return ecode.Int(res.Code)
+	}
+	for _, is := range res.Data {
+		for _, i := range is {
+			_ = d.registry.Register(i, i.LatestTimestamp)
+		}
+	}
+	return
+}
+
+// syncOverrides downloads the overrides of operator from node.
+func (d *Discovery) syncOverrides(node *model.Node) {
+	uri := fmt.Sprintf(_overrideURL, node.Scheme, node.Addr)
+	var res struct {
+		Code int               `json:"code"`
+		Data []*model.Override `json:"data"`
+	}
+	if err := d.httpClient().Get(context.TODO(), uri, "", nil, &res); err != nil || res.Code != 0 {
+		// NOTE: peer of old version does not support overrides.
+		log.Warn("service syncup overrides from(%s) code(%d) error(%v)", node.Addr, res.Code, err)
+		return
+	}
+	d.registry.SyncOverrides(res.Data)
+	log.Info("service syncup from(%s) overrides(%d)", node.Addr, len(res.Data))
+}
+
+// syncPages downloads the registry of node page by page, apps of a page are downloaded in parallel.
+// A failed page is retried from its cursor, pages is the number of pages downloaded. It fails if any
+// app failed, then the registry is incomplete and the node stays in protect mode unless another peer syncs.
+func (d *Discovery) syncPages(node *model.Node) (pages int, err error) {
+	var (
+		cursor    string
+		apps      int
+		instances int64
+		failed    int64
+		start     = time.Now()
+	)
+	for {
+		var page *model.SyncApps
+		if page, err = d.syncApps(node, cursor); err != nil {
+			return
+		}
+		pages++
+		var (
+			eg  errgroup.Group
+			sem = make(chan struct{}, _syncParallel)
+		)
+		for _, app := range page.Apps {
+			app := app
+			sem <- struct{}{}
+			eg.Go(func() error {
+				defer func() { <-sem }()
+				n, err := d.syncApp(node, app)
+				if err != nil {
+					log.Error("service syncup from(%s) appid(%s) env(%s) error(%v)", node.Addr, app.AppID, app.Env, err)
+					atomic.AddInt64(&failed, 1)
+					return nil
+				}
+				atomic.AddInt64(&instances, int64(n))
+				return nil
+			})
+		}
+		_ = eg.Wait()
+		apps += len(page.Apps)
+		log.Info("service syncup from(%s) progress apps(%d/%d) instances(%d) failed apps(%d) cost(%v)",
+			node.Addr, apps, page.Total, atomic.LoadInt64(&instances), atomic.LoadInt64(&failed), time.Since(start))
+		if page.Cursor == "" {
+			if failed != 0 {
+				err = fmt.Errorf("%d apps failed", failed)
+			}
+			return
+		}
+		cursor = page.Cursor
+	}
+}
+
+func (d *Discovery) syncApps(node *model.Node, cursor string) (page *model.SyncApps, err error) {
+	uri := fmt.Sprintf(_syncAppsURL, node.Scheme, node.Addr)
+	params := url.Values{}
+	// NOTE: pages are sized by node.
+	params.Set("cursor", cursor)
+	for i := 0; i < _syncRetry; i++ {
+		if i > 0 {
+			time.Sleep(_syncRetryWait)
+		}
 		var res struct {
-			Code int                          `json:"code"`
-			Data map[string][]*model.Instance `json:"data"`
+			Code int             `json:"code"`
+			Data *model.SyncApps `json:"data"`
 		}
-		if err := d.client.Get(context.TODO(), uri, "", nil, &res); err != nil {
-			log.Error("d.client.Get(%v) error(%v)", uri, err)
+		if err = d.httpClient().Get(context.TODO(), uri, "", params, &res); err != nil {
+			log.Error("d.client.Get(%v) cursor(%s) error(%v)", uri, cursor, err)
 			continue
 		}
-		if res.Code != 0 {
-			log.Error("service syncup from(%s) failed ", uri)
+		if res.Code != 0 || res.Data == nil {
+			log.Error("d.client.Get(%v) cursor(%s) code(%d)", uri, cursor, res.Code)
+			err = ecode.Int(res.Code)
 			continue
 		}
-		// sync success from other node,exit protected mode
-		d.protected = false
-		for _, is := range res.Data {
-			for _, i := range is {
-				_ = d.registry.Register(i, i.LatestTimestamp)
+		page = res.Data
+		return
+	}
+	return
+}
+
+// syncApp downloads and registers all instances of app, verifying them with the checksum of node.
+// The app is skipped if the local instances have the checksum of summary already.
+func (d *Discovery) syncApp(node *model.Node, app *model.AppSummary) (n int, err error) {
+	if local, e := d.registry.SyncApp(app.AppID, app.Env); e == nil && local.Checksum == app.Checksum {
+		return len(local.Instances), nil
+	}
+	uri := fmt.Sprintf(_syncAppURL, node.Scheme, node.Addr)
+	params := url.Values{}
+	params.Set("appid", app.AppID)
+	params.Set("env", app.Env)
+	for i := 0; i < _syncRetry; i++ {
+		if i > 0 {
+			time.Sleep(_syncRetryWait)
+		}
+		var res struct {
+			Code int            `json:"code"`
+			Data *model.SyncApp `json:"data"`
+		}
+		if err = d.httpClient().Get(context.TODO(), uri, "", params, &res); err != nil {
+			continue
+		}
+		if err = ecode.Int(res.Code); res.Code != 0 || res.Data == nil {
+			if res.Code == ecode.NothingFound.Code() {
+				// NOTE: app canceled after listed.
+				return 0, nil
 			}
+			continue
+		}
+		if sum := model.Checksum(res.Data.Instances); sum != res.Data.Checksum {
+			log.Warn("service syncup from(%s) appid(%s) env(%s) checksum(%s) mismatch(%s)", node.Addr, app.AppID, app.Env, sum, res.Data.Checksum)
+			err = ecode.Conflict
+			continue
 		}
-		// NOTE: no return, make sure that all instances from other nodes register into self.
+		for _, i := range res.Data.Instances {
+			_ = d.registry.Register(i, i.LatestTimestamp)
+		}
+		return len(res.Data.Instances), nil
 	}
-	nodes.UP()
+	return
 }
 
 func (d *Discovery) regSelf() context.CancelFunc {
 	ctx, cancel := context.WithCancel(context.Background())
-	now := time.Now().UnixNano()
+	now := d.registry.Now()
 	ins := &model.Instance{
-		Region:   d.c.Env.Region,
-		Zone:     d.c.Env.Zone,
-		Env:      d.c.Env.DeployEnv,
-		Hostname: d.c.Env.Host,
+		Region:   d.config().Env.Region,
+		Zone:     d.config().Env.Zone,
+		Env:      d.config().Env.DeployEnv,
+		Hostname: d.config().Env.Host,
 		AppID:    model.AppID,
 		Addrs: []string{
-			"http://" + d.c.HTTPServer.Addr,
+			d.config().Scheme() + "://" + d.config().HTTPServer.Addr,
 		},
 		Status:          model.InstanceStatusUP,
 		RegTimestamp:    now,
@@ -84,9 +255,9 @@ func (d *Discovery) regSelf() context.CancelFunc {
 			case <-ticker.C:
 				arg := &model.ArgRenew{
 					AppID:    ins.AppID,
-					Zone:     d.c.Env.Zone,
-					Env:      d.c.Env.DeployEnv,
-					Hostname: d.c.Env.Host,
+					Zone:     d.config().Env.Zone,
+					Env:      d.config().Env.DeployEnv,
+					Hostname: d.config().Env.Host,
 				}
 				if _, err := d.Renew(ctx, arg); err != nil && err == ecode.NothingFound {
 					d.Register(ctx, ins, now, false, false)
@@ -94,13 +265,14 @@ func (d *Discovery) regSelf() context.CancelFunc {
 			case <-ctx.Done():
 				arg := &model.ArgCancel{
 					AppID:    model.AppID,
-					Zone:     d.c.Env.Zone,
-					Env:      d.c.Env.DeployEnv,
-					Hostname: d.c.Env.Host,
+					Zone:     d.config().Env.Zone,
+					Env:      d.config().Env.DeployEnv,
+					Hostname: d.config().Env.Host,
 				}
 				if err := d.Cancel(context.Background(), arg); err != nil {
 					log.Error("d.Cancel(%+v) error(%v)", arg, err)
 				}
+				close(d.selfDone)
 				return
 			}
 		}
@@ -108,6 +280,8 @@ func (d *Discovery) regSelf() context.CancelFunc {
 	return cancel
 }
 
+// nodesproc watches the self registration of discovery nodes and updates members.
+// NOTE: it never exits, errors are logged and retried.
 func (d *Discovery) nodesproc() {
 	var (
 		lastTs int64
@@ -115,8 +289,8 @@ func (d *Discovery) nodesproc() {
 	for {
 		arg := &model.ArgPolls{
 			AppID:           []string{model.AppID},
-			Env:             d.c.Env.DeployEnv,
-			Hostname:        d.c.Env.Host,
+			Env:             d.config().Env.DeployEnv,
+			Hostname:        d.config().Env.Host,
 			LatestTimestamp: []int64{lastTs},
 		}
 		ch, _, _, err := d.registry.Polls(arg)
@@ -125,37 +299,33 @@ func (d *Discovery) nodesproc() {
 			time.Sleep(time.Second)
 			continue
 		}
-		apps := <-ch
+		var apps map[string]*model.InstanceInfo
+		select {
+		case apps = <-ch:
+		case <-time.After(_nodesPollWait):
+			d.registry.DelConns(arg)
+			continue
+		}
 		ins, ok := apps[model.AppID]
 		if !ok || ins == nil {
-			return
+			log.Warn("discovery nodesproc found no discovery nodes, keep members")
+			time.Sleep(time.Second)
+			continue
 		}
 		var (
-			nodes []string
 			zones = make(map[string][]string)
 		)
 		for _, ins := range ins.Instances {
 			for _, in := range ins {
-				for _, addr := range in.Addrs {
-					u, err := url.Parse(addr)
-					if err == nil && u.Scheme == "http" {
-						if in.Zone == d.c.Env.Zone {
-							nodes = append(nodes, u.Host)
-						} else {
-							zones[in.Zone] = append(zones[in.Zone], u.Host)
-						}
-					}
+				for _, e := range in.Endpoints("http", "https") {
+					zones[in.Zone] = append(zones[in.Zone], e.Scheme+"://"+e.Addr())
 				}
 			}
 		}
 		lastTs = ins.LatestTimestamp
-		c := new(conf.Config)
-		*c = *d.c
-		c.Nodes = nodes
-		c.Zones = zones
-		ns := registry.NewNodes(c)
-		ns.UP()
-		d.nodes.Store(ns)
-		log.Info("discovery changed nodes:%v zones:%v", nodes, zones)
+		d.members.lock.Lock()
+		d.members.discovered = zones
+		d.storeNodes()
+		d.members.lock.Unlock()
 	}
 }
@@ -0,0 +1,116 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	xhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bilibili/discovery/model"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSyncPages(t *testing.T) {
+	now := time.Now().UnixNano()
+	ins := []*model.Instance{{AppID: "main.arch.sync", Env: "pre", Zone: "sh001", Hostname: "h1", Addrs: []string{"http://127.0.0.1:8000"},
+		Status: 1, RegTimestamp: now, UpTimestamp: now, RenewTimestamp: now, DirtyTimestamp: now, LatestTimestamp: now}}
+	var (
+		fails int32 = 1
+		hits  int32
+	)
+	reply := func(w xhttp.ResponseWriter, code int, data interface{}) {
+		bs, _ := json.Marshal(map[string]interface{}{"code": code, "data": data})
+		w.Write(bs)
+	}
+	peer := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		switch r.URL.Path {
+		case "/discovery/sync/apps":
+			reply(w, 0, &model.SyncApps{Apps: []*model.AppSummary{
+				{AppID: "main.arch.sync", Env: "pre", Count: 1, Checksum: model.Checksum(ins)},
+				{AppID: "main.arch.broken", Env: "pre", Count: 1},
+			}, Total: 2})
+		case "/discovery/sync/app":
+			if r.FormValue("appid") == "main.arch.sync" {
+				atomic.AddInt32(&hits, 1)
+				reply(w, 0, &model.SyncApp{Instances: ins, Checksum: model.Checksum(ins)})
+				return
+			}
+			if atomic.LoadInt32(&fails) == 1 {
+				reply(w, -500, nil)
+				return
+			}
+			reply(w, -404, nil)
+		default:
+			reply(w, 0, nil)
+		}
+	}))
+	defer peer.Close()
+	Convey("test sync pages fails if any app failed and skips apps synced", t, func() {
+		addr := strings.TrimPrefix(peer.URL, "http://")
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171", addr}
+		c.EnableProtect = true
+		svr, cancel := New(c)
+		defer cancel()
+		So(svr.Protected(), ShouldBeTrue)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 1)
+		res, err := svr.registry.SyncApp("main.arch.sync", "pre")
+		So(err, ShouldBeNil)
+		So(res.Checksum, ShouldEqual, model.Checksum(ins))
+		atomic.StoreInt32(&fails, 0)
+		pages, err := svr.syncPages(&model.Node{Addr: addr, Scheme: "http"})
+		So(err, ShouldBeNil)
+		So(pages, ShouldEqual, 1)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 1)
+	})
+}
+
+func TestSyncOverride(t *testing.T) {
+	now := time.Now().UnixNano()
+	i := &model.Instance{AppID: "main.arch.override", Env: "pre", Zone: "sh001", Hostname: "h1", Addrs: []string{"http://127.0.0.1:8000"},
+		Status: 1, Metadata: map[string]string{"color": "blue", "weight": "10"},
+		RegTimestamp: now, UpTimestamp: now, RenewTimestamp: now, DirtyTimestamp: now, LatestTimestamp: now}
+	o := &model.Override{AppID: "main.arch.override", Env: "pre", Hostname: "h1", Status: 2, Metadata: map[string]string{"color": "red"}, UpdateTimestamp: now}
+	o.Apply(i)
+	ins := []*model.Instance{i}
+	reply := func(w xhttp.ResponseWriter, code int, data interface{}) {
+		bs, _ := json.Marshal(map[string]interface{}{"code": code, "data": data})
+		w.Write(bs)
+	}
+	peer := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		switch r.URL.Path {
+		case "/discovery/overrides":
+			reply(w, 0, []*model.Override{o})
+		case "/discovery/sync/apps":
+			reply(w, 0, &model.SyncApps{Apps: []*model.AppSummary{{AppID: "main.arch.override", Env: "pre", Count: 1, Checksum: model.Checksum(ins)}}, Total: 1})
+		case "/discovery/sync/app":
+			reply(w, 0, &model.SyncApp{Instances: ins, Checksum: model.Checksum(ins)})
+		default:
+			reply(w, 0, nil)
+		}
+	}))
+	defer peer.Close()
+	Convey("test override synced is cleared to the status and metadata registered", t, func() {
+		c := newConfig()
+		c.Nodes = []string{"127.0.0.1:7171", strings.TrimPrefix(peer.URL, "http://")}
+		svr, cancel := New(c)
+		defer cancel()
+		info, err := svr.registry.Fetch("sh001", "pre", "main.arch.override", 0, model.InstanceStatusUP|model.InstancestatusWating)
+		So(err, ShouldBeNil)
+		si := info.Instances["sh001"][0]
+		So(si.Status, ShouldEqual, 2)
+		So(si.Metadata, ShouldResemble, map[string]string{"color": "red", "weight": "10"})
+		err = svr.ClearOverride(context.TODO(), &model.ArgClearOverride{AppID: "main.arch.override", Env: "pre", Hostname: "h1"})
+		So(err, ShouldBeNil)
+		info, err = svr.registry.Fetch("sh001", "pre", "main.arch.override", 0, model.InstanceStatusUP|model.InstancestatusWating)
+		So(err, ShouldBeNil)
+		si = info.Instances["sh001"][0]
+		So(si.Status, ShouldEqual, 1)
+		So(si.Metadata, ShouldResemble, map[string]string{"color": "blue", "weight": "10"})
+	})
+}
@@ -0,0 +1,164 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/discovery"
+
+	log "github.com/go-kratos/kratos/pkg/log"
+)
+
+const (
+	// _udpSize is the max size of udp responses without edns0.
+	_udpSize = 512
+	// _maxSize is the max size of udp requests and responses with edns0.
+	_maxSize = 4096
+	// _tcpIdle closes idle tcp connections.
+	_tcpIdle = 10 * time.Second
+	// _udpWorkers is the max udp queries handled at the same time, the others wait in the socket buffer.
+	_udpWorkers = 256
+)
+
+var (
+	dis    *discovery.Discovery
+	domain string
+	ttl    uint32
+
+	udp    net.PacketConn
+	tcp    net.Listener
+	closed int32
+	conns  = make(map[net.Conn]struct{})
+	cLock  sync.Mutex
+	wg     sync.WaitGroup
+)
+
+// Init serves dns on udp and tcp if enabled.
+func Init(c *conf.Config, s *discovery.Discovery) {
+	if !c.DNS.Enabled() {
+		return
+	}
+	dis = s
+	domain = c.DNS.Domain
+	ttl = uint32(time.Duration(c.DNS.TTL) / time.Second)
+	var err error
+	if udp, err = net.ListenPacket("udp", c.DNS.Addr); err != nil {
+		log.Error("net.ListenPacket(%s) error(%v)", c.DNS.Addr, err)
+		panic(err)
+	}
+	if tcp, err = net.Listen("tcp", c.DNS.Addr); err != nil {
+		log.Error("net.Listen(%s) error(%v)", c.DNS.Addr, err)
+		panic(err)
+	}
+	go serveUDP()
+	go serveTCP()
+	log.Info("[DNS] Listening on: %s domain: %s", c.DNS.Addr, domain)
+}
+
+// Shutdown closes the listeners and waits for active queries until the deadline of ctx.
+func Shutdown(ctx context.Context) (err error) {
+	if udp == nil || !atomic.CompareAndSwapInt32(&closed, 0, 1) {
+		return
+	}
+	udp.Close()
+	tcp.Close()
+	cLock.Lock()
+	for conn := range conns {
+		conn.Close()
+	}
+	cLock.Unlock()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+func serveUDP() {
+	sem := make(chan struct{}, _udpWorkers)
+	for {
+		buf := make([]byte, _maxSize)
+		n, addr, err := udp.ReadFrom(buf)
+		if err != nil {
+			if atomic.LoadInt32(&closed) == 1 {
+				return
+			}
+			log.Error("dns udp.ReadFrom() error(%v)", err)
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if res := handle(buf[:n], true); res != nil {
+				if _, err := udp.WriteTo(res, addr); err != nil {
+					log.Warn("dns udp.WriteTo(%s) error(%v)", addr, err)
+				}
+			}
+		}()
+	}
+}
+
+func serveTCP() {
+	for {
+		conn, err := tcp.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&closed) == 1 {
+				return
+			}
+			log.Error("dns tcp.Accept() error(%v)", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		cLock.Lock()
+		conns[conn] = struct{}{}
+		cLock.Unlock()
+		wg.Add(1)
+		go serveConn(conn)
+	}
+}
+
+// serveConn answers the queries of conn, each message is prefixed with its two bytes length.
+func serveConn(conn net.Conn) {
+	defer func() {
+		cLock.Lock()
+		delete(conns, conn)
+		cLock.Unlock()
+		conn.Close()
+		wg.Done()
+	}()
+	var l [2]byte
+	for {
+		conn.SetDeadline(time.Now().Add(_tcpIdle))
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		res := handle(req, false)
+		if res == nil {
+			return
+		}
+		binary.BigEndian.PutUint16(l[:], uint16(len(res)))
+		if _, err := conn.Write(append(l[:], res...)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/bilibili/discovery/model"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+	log "github.com/go-kratos/kratos/pkg/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	_metaWeight    = "weight"
+	_defaultWeight = 10
+)
+
+// handle answers the query req, nil is returned if req is malformed and should be dropped.
+func handle(req []byte, udp bool) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil || h.Response {
+		return nil
+	}
+	m := &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               h.ID,
+			Response:         true,
+			OpCode:           h.OpCode,
+			Authoritative:    true,
+			RecursionDesired: h.RecursionDesired,
+		},
+	}
+	qs, err := p.AllQuestions()
+	if err != nil || len(qs) != 1 {
+		m.RCode = dnsmessage.RCodeFormatError
+		return pack(m, _udpSize)
+	}
+	m.Questions = qs
+	size, opt := edns(&p)
+	if !udp {
+		size = 1<<16 - 1
+	}
+	if opt != nil {
+		m.Additionals = append(m.Additionals, *opt)
+	}
+	if h.OpCode != 0 {
+		m.RCode = dnsmessage.RCodeNotImplemented
+		return pack(m, size)
+	}
+	var extra []dnsmessage.Resource
+	m.RCode, m.Answers, extra = resolve(qs[0])
+	m.Additionals = append(extra, m.Additionals...)
+	return pack(m, size)
+}
+
+// edns returns the udp size of requester and the opt record answered if it supports edns0.
+func edns(p *dnsmessage.Parser) (size int, opt *dnsmessage.Resource) {
+	size = _udpSize
+	if p.SkipAllAnswers() != nil || p.SkipAllAuthorities() != nil {
+		return
+	}
+	for {
+		h, err := p.AdditionalHeader()
+		if err != nil {
+			return
+		}
+		if h.Type != dnsmessage.TypeOPT {
+			if p.SkipAdditional() != nil {
+				return
+			}
+			continue
+		}
+		if size = int(h.Class); size < _udpSize {
+			size = _udpSize
+		} else if size > _maxSize {
+			size = _maxSize
+		}
+		opt = &dnsmessage.Resource{Body: &dnsmessage.OPTResource{}}
+		if opt.Header.SetEDNS0(size, dnsmessage.RCodeSuccess, false) != nil {
+			opt = nil
+		}
+		return
+	}
+}
+
+// pack packs m, the records are dropped and m is marked truncated if it is larger than size.
+func pack(m *dnsmessage.Message, size int) []byte {
+	b, err := m.Pack()
+	if err == nil && len(b) <= size {
+		return b
+	}
+	if err != nil {
+		log.Error("dns pack(%v) error(%v)", m.Questions, err)
+		m.RCode = dnsmessage.RCodeServerFailure
+	} else {
+		m.Truncated = true
+	}
+	m.Answers = nil
+	var opt []dnsmessage.Resource
+	for _, r := range m.Additionals {
+		if r.Header.Type == dnsmessage.TypeOPT {
+			opt = append(opt, r)
+		}
+	}
+	m.Additionals = opt
+	if b, err = m.Pack(); err != nil {
+		return nil
+	}
+	return b
+}
+
+// resolve answers a name like "<appid>.<env>.<zone>.discovery." with the records of up instances,
+// "<hostname>.<appid>.<env>.<zone>.discovery." with the records of the instance,
+// and "_<scheme>._tcp." prefix selects the addrs of the scheme.
+func resolve(q dnsmessage.Question) (rcode dnsmessage.RCode, answers, extra []dnsmessage.Resource) {
+	if q.Class != dnsmessage.ClassINET && q.Class != dnsmessage.ClassANY {
+		return dnsmessage.RCodeRefused, nil, nil
+	}
+	name := q.Name.String()
+	if len(name) <= len(domain) || !strings.EqualFold(name[len(name)-len(domain):], domain) || name[len(name)-len(domain)-1] != '.' {
+		return dnsmessage.RCodeRefused, nil, nil
+	}
+	// NOTE: appid, env and zone are matched in the case queried as the registry does, only the domain and hostname are not.
+	labels := strings.Split(name[:len(name)-len(domain)-1], ".")
+	var scheme string
+	if len(labels) > 2 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_") {
+		scheme, labels = labels[0][1:], labels[2:]
+	}
+	if dis.Protected() && !dis.StaleRead() {
+		return dnsmessage.RCodeServerFailure, nil, nil
+	}
+	is, err := lookup(labels)
+	if err != nil {
+		if err == ecode.NothingFound {
+			return dnsmessage.RCodeNameError, nil, nil
+		}
+		log.Error("dns lookup(%s) error(%v)", name, err)
+		return dnsmessage.RCodeServerFailure, nil, nil
+	}
+	var (
+		env, zone = labels[len(labels)-2], labels[len(labels)-1]
+		seen      = make(map[string]struct{})
+	)
+	for _, in := range is {
+		target, err := dnsmessage.NewName(strings.Join([]string{in.Hostname, in.AppID, env, zone, domain}, "."))
+		if err != nil {
+			continue
+		}
+		for _, e := range in.Endpoints() {
+			ip, port := net.ParseIP(e.Host), uint16(e.Port)
+			if ip == nil || (scheme != "" && !strings.EqualFold(e.Scheme, scheme)) {
+				continue
+			}
+			switch q.Type {
+			case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+				if r, ok := ipResource(q.Name, ip); ok && r.Header.Type == q.Type {
+					if _, ok = seen[ip.String()]; !ok {
+						seen[ip.String()] = struct{}{}
+						answers = append(answers, r)
+					}
+				}
+			case dnsmessage.TypeSRV:
+				key := target.String() + ":" + strconv.Itoa(int(port))
+				if _, ok := seen[key]; ok || port == 0 {
+					continue
+				}
+				seen[key] = struct{}{}
+				answers = append(answers, dnsmessage.Resource{
+					Header: header(q.Name, dnsmessage.TypeSRV),
+					Body:   &dnsmessage.SRVResource{Weight: weight(in, e), Port: port, Target: target},
+				})
+				if r, ok := ipResource(target, ip); ok {
+					if _, ok = seen[target.String()+ip.String()]; !ok {
+						seen[target.String()+ip.String()] = struct{}{}
+						extra = append(extra, r)
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// lookup finds the up instances of labels, the labels before appid are taken as hostname
+// if no app is found with all of them.
+func lookup(labels []string) (is []*model.Instance, err error) {
+	n := len(labels)
+	if n < 3 {
+		return nil, ecode.NothingFound
+	}
+	arg := &model.ArgFetch{
+		Zone:   labels[n-1],
+		Env:    labels[n-2],
+		Status: model.InstanceStatusUP,
+	}
+	for i := 0; i < n-2; i++ {
+		hostname := strings.Join(labels[:i], ".")
+		arg.AppID = strings.Join(labels[i:n-2], ".")
+		info, err := dis.Fetch(context.TODO(), arg)
+		if err == ecode.NothingFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, ins := range info.Instances {
+			for _, in := range ins {
+				if i == 0 || strings.EqualFold(in.Hostname, hostname) {
+					is = append(is, in)
+				}
+			}
+		}
+		if i == 0 || len(is) != 0 {
+			return is, nil
+		}
+	}
+	return nil, ecode.NothingFound
+}
+
+// weight of srv record, the weight of endpoint overrides the one of instance.
+func weight(in *model.Instance, e *model.Endpoint) uint16 {
+	w, err := strconv.ParseUint(e.Metadata[model.EndpointWeight], 10, 16)
+	if err != nil || w == 0 {
+		w, err = strconv.ParseUint(in.Metadata[_metaWeight], 10, 16)
+	}
+	if err != nil || w == 0 {
+		return _defaultWeight
+	}
+	return uint16(w)
+}
+
+func ipResource(name dnsmessage.Name, ip net.IP) (r dnsmessage.Resource, ok bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		body := &dnsmessage.AResource{}
+		copy(body.A[:], ip4)
+		return dnsmessage.Resource{Header: header(name, dnsmessage.TypeA), Body: body}, true
+	}
+	if ip6 := ip.To16(); ip6 != nil {
+		body := &dnsmessage.AAAAResource{}
+		copy(body.AAAA[:], ip6)
+		return dnsmessage.Resource{Header: header(name, dnsmessage.TypeAAAA), Body: body}, true
+	}
+	return
+}
+
+func header(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET, TTL: ttl}
+}
@@ -0,0 +1,203 @@
+package dns
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	dc "github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/discovery"
+	"github.com/bilibili/discovery/model"
+
+	"github.com/go-kratos/kratos/pkg/conf/paladin"
+	"github.com/go-kratos/kratos/pkg/ecode"
+	http "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+	xtime "github.com/go-kratos/kratos/pkg/time"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestMain(m *testing.M) {
+	flag.Set("conf", "./")
+	flag.Parse()
+	paladin.Init()
+	c := &dc.Config{
+		HTTPClient: &http.ClientConfig{Timeout: xtime.Duration(time.Second), Dial: xtime.Duration(time.Second)},
+		HTTPServer: &http.ServerConfig{Addr: "127.0.0.1:7171"},
+		Nodes:      []string{"127.0.0.1:7171"},
+		Env:        &dc.Env{Zone: "sh001", DeployEnv: "pre", Host: "test_server"},
+	}
+	var cancel context.CancelFunc
+	dis, cancel = discovery.New(c)
+	domain, ttl = "discovery.", 5
+	register := func(appid, hostname string, status uint32, addrs ...string) {
+		i := model.NewInstance(&model.ArgRegister{Zone: "sh001", Env: "pre", AppID: appid, Hostname: hostname, Status: status})
+		i.Addrs, i.Metadata = addrs, map[string]string{"weight": "5"}
+		dis.Register(context.TODO(), i, 0, true, false)
+	}
+	register("provider", "h1", model.InstanceStatusUP, "http://10.0.0.1:8080", "grpc://10.0.0.1:9000?weight=20")
+	register("provider", "h2", model.InstanceStatusUP, "grpc://10.0.0.2:9000", "grpc://[::1]:9001")
+	register("provider", "h3", model.InstancestatusWating, "grpc://10.0.0.3:9000")
+	register("main.arch.test", "h1", model.InstanceStatusUP, "grpc://10.0.1.1:9000")
+	register("Main.Arch.Mixed", "h1", model.InstanceStatusUP, "grpc://10.0.2.1:9000")
+	for n := 0; n < 64; n++ {
+		register("big", fmt.Sprintf("h%d", n), model.InstanceStatusUP, fmt.Sprintf("http://10.1.0.%d:80", n))
+	}
+	code := m.Run()
+	cancel()
+	os.Exit(code)
+}
+
+func query(name string, typ dnsmessage.Type, edns int, questions int) []byte {
+	m := &dnsmessage.Message{Header: dnsmessage.Header{ID: 1, RecursionDesired: true}}
+	for n := 0; n < questions; n++ {
+		m.Questions = append(m.Questions, dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET})
+	}
+	if edns != 0 {
+		opt := dnsmessage.Resource{Body: &dnsmessage.OPTResource{}}
+		opt.Header.SetEDNS0(edns, dnsmessage.RCodeSuccess, false)
+		m.Additionals = append(m.Additionals, opt)
+	}
+	b, err := m.Pack()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func answer(req []byte, udp bool) (m *dnsmessage.Message, size int) {
+	res := handle(req, udp)
+	if res == nil {
+		return nil, 0
+	}
+	m = new(dnsmessage.Message)
+	if err := m.Unpack(res); err != nil {
+		panic(err)
+	}
+	return m, len(res)
+}
+
+// records returns the answers in text sorted, like "A 10.0.0.1" and "SRV h1.provider.pre.sh001.discovery.:9000/20".
+func records(rs []dnsmessage.Resource) (ss []string) {
+	for _, r := range rs {
+		switch b := r.Body.(type) {
+		case *dnsmessage.AResource:
+			ss = append(ss, fmt.Sprintf("A %d.%d.%d.%d", b.A[0], b.A[1], b.A[2], b.A[3]))
+		case *dnsmessage.AAAAResource:
+			ss = append(ss, fmt.Sprintf("AAAA %x", b.AAAA[:]))
+		case *dnsmessage.SRVResource:
+			ss = append(ss, fmt.Sprintf("SRV %s:%d/%d", b.Target, b.Port, b.Weight))
+		case *dnsmessage.OPTResource:
+			ss = append(ss, "OPT")
+		}
+	}
+	sort.Strings(ss)
+	return
+}
+
+func TestResolve(t *testing.T) {
+	Convey("test resolve queries", t, func() {
+		for _, c := range []struct {
+			name    string
+			typ     dnsmessage.Type
+			rcode   dnsmessage.RCode
+			answers []string
+			extra   []string
+		}{
+			{"provider.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, []string{"A 10.0.0.1", "A 10.0.0.2"}, nil},
+			{"provider.pre.sh001.Discovery.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, []string{"A 10.0.0.1", "A 10.0.0.2"}, nil},
+			{"PROVIDER.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeNameError, nil, nil},
+			{"Main.Arch.Mixed.pre.sh001.DISCOVERY.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, []string{"A 10.0.2.1"}, nil},
+			{"H1.Main.Arch.Mixed.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, []string{"A 10.0.2.1"}, nil},
+			{"main.arch.mixed.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeNameError, nil, nil},
+			{"provider.pre.sh001.discovery.", dnsmessage.TypeAAAA, dnsmessage.RCodeSuccess, []string{"AAAA 00000000000000000000000000000001"}, nil},
+			{"_grpc._tcp.provider.pre.sh001.discovery.", dnsmessage.TypeSRV, dnsmessage.RCodeSuccess,
+				[]string{"SRV h1.provider.pre.sh001.discovery.:9000/20", "SRV h2.provider.pre.sh001.discovery.:9000/5", "SRV h2.provider.pre.sh001.discovery.:9001/5"},
+				[]string{"A 10.0.0.1", "A 10.0.0.2", "AAAA 00000000000000000000000000000001"}},
+			{"_http._tcp.provider.pre.sh001.discovery.", dnsmessage.TypeSRV, dnsmessage.RCodeSuccess,
+				[]string{"SRV h1.provider.pre.sh001.discovery.:8080/5"}, []string{"A 10.0.0.1"}},
+			{"_https._tcp.provider.pre.sh001.discovery.", dnsmessage.TypeSRV, dnsmessage.RCodeSuccess, nil, nil},
+			{"h2.provider.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, []string{"A 10.0.0.2"}, nil},
+			{"main.arch.test.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, []string{"A 10.0.1.1"}, nil},
+			{"h1.main.arch.test.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, []string{"A 10.0.1.1"}, nil},
+			{"h3.provider.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeNameError, nil, nil},
+			{"unknown.pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeNameError, nil, nil},
+			{"provider.prod.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeNameError, nil, nil},
+			{"pre.sh001.discovery.", dnsmessage.TypeA, dnsmessage.RCodeNameError, nil, nil},
+			{"provider.pre.sh001.example.com.", dnsmessage.TypeA, dnsmessage.RCodeRefused, nil, nil},
+			{"xdiscovery.", dnsmessage.TypeA, dnsmessage.RCodeRefused, nil, nil},
+		} {
+			m, _ := answer(query(c.name, c.typ, 0, 1), true)
+			So(m, ShouldNotBeNil)
+			So(m.ID, ShouldEqual, 1)
+			So(m.Response, ShouldBeTrue)
+			So(m.RecursionDesired, ShouldBeTrue)
+			So(fmt.Sprint(c.name, m.RCode), ShouldEqual, fmt.Sprint(c.name, c.rcode))
+			So(records(m.Answers), ShouldResemble, c.answers)
+			So(records(m.Additionals), ShouldResemble, c.extra)
+		}
+	})
+}
+
+func TestHandle(t *testing.T) {
+	Convey("test handle malformed and unsupported queries", t, func() {
+		m, _ := answer([]byte{0, 1, 2}, true)
+		So(m, ShouldBeNil)
+		res := query("provider.pre.sh001.discovery.", dnsmessage.TypeA, 0, 1)
+		res[2] |= 0x80
+		m, _ = answer(res, true)
+		So(m, ShouldBeNil)
+		m, _ = answer(query("provider.pre.sh001.discovery.", dnsmessage.TypeA, 0, 2), true)
+		So(m.RCode, ShouldEqual, dnsmessage.RCodeFormatError)
+		m, _ = answer(query("provider.pre.sh001.discovery.", dnsmessage.TypeA, 0, 0), true)
+		So(m.RCode, ShouldEqual, dnsmessage.RCodeFormatError)
+		req := query("provider.pre.sh001.discovery.", dnsmessage.TypeA, 0, 1)
+		req[2] |= 2 << 3
+		m, _ = answer(req, true)
+		So(m.RCode, ShouldEqual, dnsmessage.RCodeNotImplemented)
+	})
+	Convey("test truncation and edns", t, func() {
+		name := "big.pre.sh001.discovery."
+		m, size := answer(query(name, dnsmessage.TypeA, 0, 1), true)
+		So(m.Truncated, ShouldBeTrue)
+		So(len(m.Answers), ShouldEqual, 0)
+		So(size, ShouldBeLessThanOrEqualTo, _udpSize)
+		m, _ = answer(query(name, dnsmessage.TypeA, 0, 1), false)
+		So(m.Truncated, ShouldBeFalse)
+		So(len(m.Answers), ShouldEqual, 64)
+		m, _ = answer(query(name, dnsmessage.TypeA, 4096, 1), true)
+		So(m.Truncated, ShouldBeFalse)
+		So(len(m.Answers), ShouldEqual, 64)
+		So(records(m.Additionals), ShouldResemble, []string{"OPT"})
+		So(m.Additionals[0].Header.Class, ShouldEqual, _maxSize)
+		// NOTE: the opt record is kept on truncation, and sizes below 512 are taken as 512.
+		m, size = answer(query("_http._tcp."+name, dnsmessage.TypeSRV, 256, 1), true)
+		So(m.Truncated, ShouldBeTrue)
+		So(size, ShouldBeLessThanOrEqualTo, _udpSize)
+		So(records(m.Additionals), ShouldResemble, []string{"OPT"})
+	})
+}
+
+func TestLookup(t *testing.T) {
+	Convey("test lookup labels", t, func() {
+		is, err := lookup([]string{"provider", "pre", "sh001"})
+		So(err, ShouldBeNil)
+		So(len(is), ShouldEqual, 2)
+		is, err = lookup([]string{"h1", "provider", "pre", "sh001"})
+		So(err, ShouldBeNil)
+		So(len(is), ShouldEqual, 1)
+		So(is[0].Hostname, ShouldEqual, "h1")
+		// NOTE: the longest appid is taken first.
+		is, err = lookup([]string{"main", "arch", "test", "pre", "sh001"})
+		So(err, ShouldBeNil)
+		So(is[0].AppID, ShouldEqual, "main.arch.test")
+		_, err = lookup([]string{"h9", "provider", "pre", "sh001"})
+		So(err, ShouldEqual, ecode.NothingFound)
+		_, err = lookup([]string{"pre", "sh001"})
+		So(err, ShouldEqual, ecode.NothingFound)
+	})
+}
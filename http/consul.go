@@ -0,0 +1,191 @@
+package http
+
+import (
+	"encoding/json"
+	xhttp "net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bilibili/discovery/model"
+
+	log "github.com/go-kratos/kratos/pkg/log"
+	bm "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+)
+
+const (
+	_consulIndexHeader   = "X-Consul-Index"
+	_consulLeaderHeader  = "X-Consul-Knownleader"
+	_consulContactHeader = "X-Consul-Lastcontact"
+)
+
+// consulQuery is the query of consul api, dc is taken as zone and env is the env of discovery node by default.
+type consulQuery struct {
+	env     string
+	zone    string
+	tag     string
+	index   int64
+	wait    time.Duration
+	passing bool
+}
+
+// consulRouter init the read only subset of consul http api, for tools which speak consul.
+func consulRouter(e *bm.Engine) {
+	group := e.Group("/v1", protectStatus)
+	{
+		group.GET("/catalog/services", consulServices)
+		group.GET("/catalog/service/:service", consulCatalog)
+		group.GET("/health/service/:service", consulHealth)
+	}
+}
+
+func consulServices(c *bm.Context) {
+	q, ok := consulArgs(c)
+	if !ok {
+		return
+	}
+	// NOTE: take the notify of change feed before the apps, so that no change is missed between.
+	_, notify, _ := dis.Changes(c, &model.ArgChanges{Cursor: -1})
+	apps, index := dis.Services(c, q.env, q.zone)
+	if q.index > 0 && index <= q.index {
+		timeout := time.After(q.wait)
+	wait:
+		for {
+			select {
+			case <-notify:
+				_, notify, _ = dis.Changes(c, &model.ArgChanges{Cursor: -1})
+				if apps, index = dis.Services(c, q.env, q.zone); index > q.index {
+					break wait
+				}
+			case <-timeout:
+				break wait
+			case <-dis.GoAway():
+				break wait
+			case <-c.Done():
+				break wait
+			}
+		}
+	}
+	services := make(map[string][]string, len(apps))
+	for appid, is := range apps {
+		services[appid] = model.ConsulTags(is)
+	}
+	consulRender(c, index, services)
+}
+
+func consulCatalog(c *bm.Context) {
+	q, ok := consulArgs(c)
+	if !ok {
+		return
+	}
+	is, index := consulInstances(c, q, model.InstanceStatusUP|model.InstancestatusWating)
+	consulRender(c, index, model.ConsulCatalog(model.ConsulEntries(is, q.tag)))
+}
+
+func consulHealth(c *bm.Context) {
+	q, ok := consulArgs(c)
+	if !ok {
+		return
+	}
+	status := model.InstanceStatusUP | model.InstancestatusWating
+	if q.passing {
+		status = model.InstanceStatusUP
+	}
+	is, index := consulInstances(c, q, status)
+	consulRender(c, index, model.ConsulEntries(is, q.tag))
+}
+
+func consulArgs(c *bm.Context) (q *consulQuery, ok bool) {
+	v := c.Request.URL.Query()
+	q = &consulQuery{
+		env:  v.Get("env"),
+		zone: v.Get("dc"),
+		tag:  v.Get("tag"),
+		wait: _pollWaitSecond,
+	}
+	if q.env == "" {
+		q.env = local.DeployEnv
+	}
+	if _, q.passing = v["passing"]; q.passing {
+		q.passing = v.Get("passing") != "false" && v.Get("passing") != "0"
+	}
+	var err error
+	if s := v.Get("index"); s != "" {
+		if q.index, err = strconv.ParseInt(s, 10, 64); err != nil {
+			c.String(xhttp.StatusBadRequest, "Invalid index: %v", err)
+			return
+		}
+	}
+	if s := v.Get("wait"); s != "" {
+		if q.wait, err = time.ParseDuration(s); err != nil {
+			c.String(xhttp.StatusBadRequest, "Invalid wait time: %v", err)
+			return
+		}
+		// NOTE: hold no longer than poll, within the timeout of http server.
+		if q.wait <= 0 || q.wait > _pollWaitSecond {
+			q.wait = _pollWaitSecond
+		}
+	}
+	return q, true
+}
+
+// consulInstances returns the instances of service sorted by zone and hostname, blocking until the app
+// changes after the index of query or wait elapses.
+func consulInstances(c *bm.Context, q *consulQuery, status uint32) (is []*model.Instance, index int64) {
+	appid := c.Params.ByName("service")
+	if q.index > 0 {
+		arg := &model.ArgPolls{
+			Zone:            q.zone,
+			Env:             q.env,
+			AppID:           []string{appid},
+			Hostname:        "consul:" + c.Request.RemoteAddr,
+			LatestTimestamp: []int64{q.index},
+		}
+		ch, new, _, err := dis.Polls(c, arg)
+		if err == nil && !new {
+			select {
+			case <-ch:
+			case <-dis.GoAway():
+				dis.DelConns(arg)
+			case <-time.After(q.wait):
+				dis.DelConns(arg)
+			case <-c.Done():
+				dis.DelConns(arg)
+			}
+		}
+	}
+	info, err := dis.Fetch(c, &model.ArgFetch{Zone: q.zone, Env: q.env, AppID: appid, Status: status})
+	if err != nil {
+		// NOTE: unknown service is an empty list in consul.
+		return nil, q.index
+	}
+	zones := make([]string, 0, len(info.Instances))
+	for zone := range info.Instances {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	for _, zone := range zones {
+		zis := info.Instances[zone]
+		sort.Slice(zis, func(i, j int) bool { return zis[i].Hostname < zis[j].Hostname })
+		is = append(is, zis...)
+	}
+	return is, info.LatestTimestamp
+}
+
+// consulRender writes data with the index of blocking query, which must not be zero.
+func consulRender(c *bm.Context, index int64, data interface{}) {
+	if index <= 0 {
+		index = 1
+	}
+	h := c.Writer.Header()
+	h.Set(_consulIndexHeader, strconv.FormatInt(index, 10))
+	h.Set(_consulLeaderHeader, "true")
+	h.Set(_consulContactHeader, "0")
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Error("consul json.Marshal() error(%v)", err)
+		c.String(xhttp.StatusInternalServerError, "%v", err)
+		return
+	}
+	c.Bytes(xhttp.StatusOK, "application/json", b)
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"html/template"
+	xhttp "net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bilibili/discovery/model"
+
+	log "github.com/go-kratos/kratos/pkg/log"
+	bm "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+)
+
+var dashboardTpl = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"age": func(ts int64) string {
+		if ts == 0 {
+			return "-"
+		}
+		return time.Since(time.Unix(0, ts)).Truncate(time.Second).String()
+	},
+	"status": func(status uint32) string {
+		switch status {
+		case model.InstanceStatusUP:
+			return "UP"
+		case model.InstancestatusWating:
+			return "WAITING"
+		}
+		return "UNKNOWN"
+	},
+	"node": func(status model.NodeStatus) string {
+		if status == model.NodeStatusUP {
+			return "UP"
+		}
+		return "LOST"
+	},
+	"metadata": func(md map[string]string) string {
+		kvs := make([]string, 0, len(md))
+		for k, v := range md {
+			kvs = append(kvs, k+"="+v)
+		}
+		sort.Strings(kvs)
+		return strings.Join(kvs, " ")
+	},
+}).Parse(_dashboardHTML))
+
+// dashboard renders the html dashboard for operators, status is overridden through /discovery/set.
+func dashboard(c *bm.Context) {
+	q := c.Request.URL.Query()
+	db := dis.Dashboard(c, q.Get("env"), q.Get("zone"), q.Get("appid"))
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Writer.WriteHeader(xhttp.StatusOK)
+	if err := dashboardTpl.Execute(c.Writer, db); err != nil {
+		log.Error("dashboardTpl.Execute() error(%v)", err)
+	}
+}
+
+const _dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>discovery dashboard</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 16px; }
+table { border-collapse: collapse; margin-bottom: 12px; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+.UP { color: #080; } .LOST, .DOWN, .WAITING { color: #c00; }
+h3 { margin: 16px 0 4px; }
+</style>
+</head>
+<body>
+<h2>discovery</h2>
+<table>
+<tr><th>status</th><th>synced</th><th>protected</th><th>self preservation</th><th>peers up</th><th>apps</th><th>instances</th></tr>
+{{with .Health}}<tr><td class="{{.Status}}">{{.Status}}</td><td>{{.Synced}}</td><td>{{.Protected}}</td><td>{{.SelfPreservation}}</td><td>{{.PeersUP}}/{{len .Peers}}</td><td>{{.Apps}}</td><td>{{.Instances}}</td></tr>{{end}}
+</table>
+
+<h3>nodes</h3>
+<table>
+<tr><th>zone</th><th>addr</th><th>status</th></tr>
+{{range .Nodes}}<tr><td>{{.Zone}}</td><td>{{.Scheme}}://{{.Addr}}</td><td class="{{node .Status}}">{{node .Status}}</td></tr>
+{{end}}</table>
+
+{{if .Schedulers}}<h3>schedulers</h3>
+<table>
+<tr><th>appid</th><th>env</th><th>client zone</th><th>weights</th><th>remark</th></tr>
+{{range $sch := .Schedulers}}{{range $src, $s := $sch.Clients}}<tr><td>{{$sch.AppID}}</td><td>{{$sch.Env}}</td><td>{{$src}}</td><td>{{range $dst, $w := $s.Zones}}{{$dst}}={{$w.Weight}} {{end}}</td><td>{{$sch.Remark}}</td></tr>
+{{end}}{{end}}</table>
+{{end}}
+
+<h3>apps</h3>
+<form method="get">
+env <input name="env" value="{{.Env}}" size="8">
+zone <input name="zone" value="{{.Zone}}" size="8">
+appid <input name="appid" value="{{.AppID}}" size="24">
+<input type="submit" value="filter">
+<button type="button" onclick="localStorage.removeItem('discoveryToken')">forget token</button>
+</form>
+{{range $app := .Apps}}
+<h3>{{$app.AppID}} <small>{{$app.Env}}</small></h3>
+<table>
+<tr><th>zone</th><th>hostname</th><th>addrs</th><th>version</th><th>status</th><th>metadata</th><th>renew age</th><th>up age</th><th></th></tr>
+{{range $z := $app.Zones}}{{range $z.Instances}}<tr>
+<td>{{$z.Zone}}</td><td>{{.Hostname}}{{if ne .ID .Hostname}}<br><small>{{.ID}}</small>{{end}}</td><td>{{range .Addrs}}{{.}}<br>{{end}}</td><td>{{.Version}}</td>
+<td class="{{status .Status}}">{{status .Status}}</td><td>{{metadata .Metadata}}</td><td>{{age .RenewTimestamp}}</td><td>{{age .UpTimestamp}}</td>
+<td>{{if eq (status .Status) "UP"}}<button onclick="setStatus({{.Zone}}, {{.Env}}, {{.AppID}}, {{.Hostname}}, {{.ID}}, 2)">set waiting</button>{{else}}<button onclick="setStatus({{.Zone}}, {{.Env}}, {{.AppID}}, {{.Hostname}}, {{.ID}}, 1)">set up</button>{{end}}</td>
+</tr>
+{{end}}{{end}}</table>
+{{else}}<p>no app found</p>
+{{end}}
+<script>
+function token() {
+	var t = localStorage.getItem('discoveryToken');
+	if (t === null) {
+		t = prompt('token of the app or admin, empty if auth is disabled') || '';
+		localStorage.setItem('discoveryToken', t);
+	}
+	return t;
+}
+function setStatus(zone, env, appid, hostname, id, status) {
+	if (!confirm('set ' + appid + ' ' + id + ' status to ' + (status === 1 ? 'UP' : 'WAITING') + '?')) {
+		return;
+	}
+	var body = new URLSearchParams({zone: zone, env: env, appid: appid, hostname: hostname, instance_id: id, status: status, override: true});
+	fetch('/discovery/set', {
+		method: 'POST',
+		headers: {'Content-Type': 'application/x-www-form-urlencoded', 'Authorization': 'Bearer ' + token()},
+		body: body
+	}).then(function (r) { return r.json(); }).then(function (res) {
+		if (res.code !== 0) {
+			if (res.code === -401 || res.code === -403) {
+				localStorage.removeItem('discoveryToken');
+			}
+			alert('set failed: ' + res.code + ' ' + res.message);
+			return;
+		}
+		location.reload();
+	});
+}
+</script>
+</body>
+</html>
+`
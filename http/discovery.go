@@ -1,8 +1,8 @@
 package http
 
 import (
-	"encoding/json"
 	"fmt"
+	xhttp "net/http"
 	"time"
 
 	"github.com/bilibili/discovery/model"
@@ -10,6 +10,7 @@ import (
 	"github.com/go-kratos/kratos/pkg/ecode"
 	log "github.com/go-kratos/kratos/pkg/log"
 	bm "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+	"github.com/go-kratos/kratos/pkg/net/http/blademaster/render"
 )
 
 const (
@@ -23,20 +24,35 @@ func register(c *bm.Context) {
 	}
 	i := model.NewInstance(arg)
 	if i.Status == 0 || i.Status > 2 {
+		c.JSON(nil, ecode.Error(ecode.RequestErr, "status must be 1(up) or 2(waiting)"))
 		log.Error("register params status invalid")
 		return
 	}
 	if arg.Metadata != "" {
 		// check the metadata type is json
-		if !json.Valid([]byte(arg.Metadata)) {
-			c.JSON(nil, ecode.RequestErr)
+		if _, err := model.ParseMetadata(arg.Metadata); err != nil {
+			c.JSON(nil, ecode.Error(ecode.RequestErr, err.Error()))
 			log.Error("register params() metadata(%v) invalid json", arg.Metadata)
 			return
 		}
 	}
+	// NOTE: replications are validated by the node registered, and old nodes do not validate.
+	if !arg.Replication {
+		err := model.ValidateAddrs(arg.Addrs)
+		if err == nil {
+			err = dis.CheckMetadata(i.Metadata)
+		}
+		if err != nil {
+			c.JSON(nil, ecode.Error(ecode.RequestErr, err.Error()))
+			log.Error("register params() appid(%s) hostname(%s) %v", arg.AppID, arg.Hostname, err)
+			return
+		}
+	}
 	// register replication
 	if arg.DirtyTimestamp > 0 {
 		i.DirtyTimestamp = arg.DirtyTimestamp
+	} else {
+		i.DirtyTimestamp = dis.Now()
 	}
 	dis.Register(c, i, arg.LatestTimestamp, arg.Replication, arg.FromZone)
 	c.JSON(nil, nil)
@@ -64,6 +80,51 @@ func fetchAll(c *bm.Context) {
 	c.JSON(dis.FetchAll(c), nil)
 }
 
+func syncApps(c *bm.Context) {
+	arg := new(model.ArgSyncApps)
+	if err := c.Bind(arg); err != nil {
+		return
+	}
+	c.JSON(dis.SyncApps(c, arg), nil)
+}
+
+func syncApp(c *bm.Context) {
+	arg := new(model.ArgSyncApp)
+	if err := c.Bind(arg); err != nil {
+		return
+	}
+	c.JSON(dis.SyncApp(c, arg))
+}
+
+// changes answers changes after cursor at once, or waits for the next change.
+func changes(c *bm.Context) {
+	arg := new(model.ArgChanges)
+	if err := c.Bind(arg); err != nil {
+		return
+	}
+	cs, notify, err := dis.Changes(c, arg)
+	if err != nil || len(cs.Changes) != 0 || arg.Cursor < 0 {
+		c.JSON(cs, err)
+		return
+	}
+	if dis.Closing() {
+		c.JSON(nil, errGoAway)
+		return
+	}
+	select {
+	case <-notify:
+		cs, _, err = dis.Changes(c, arg)
+		c.JSON(cs, err)
+		return
+	case <-dis.GoAway():
+		c.JSON(nil, errGoAway)
+		return
+	case <-time.After(_pollWaitSecond):
+	case <-c.Done():
+	}
+	c.JSON(nil, ecode.NotModified)
+}
+
 func fetch(c *bm.Context) {
 	arg := new(model.ArgFetch)
 	if err := c.Bind(arg); err != nil {
@@ -85,6 +146,10 @@ func poll(c *bm.Context) {
 	if err := c.Bind(arg); err != nil {
 		return
 	}
+	if dis.Closing() {
+		c.JSON(nil, errGoAway)
+		return
+	}
 	ch, new, miss, err := dis.Polls(c, arg)
 	if err != nil {
 		c.JSON(nil, err)
@@ -101,11 +166,15 @@ func poll(c *bm.Context) {
 	// wait for instance change
 	select {
 	case e := <-ch:
-		c.JSON(e[arg.AppID[0]], nil)
+		c.JSON(e[arg.AppID[0]].FilterScheme(arg.Scheme), nil)
 		if !new {
 			dis.DelConns(arg) // broadcast will delete all connections of appid
 		}
 		return
+	case <-dis.GoAway():
+		c.JSON(nil, errGoAway)
+		dis.DelConns(arg)
+		return
 	case <-time.After(_pollWaitSecond):
 	case <-c.Done():
 	}
@@ -122,6 +191,10 @@ func polls(c *bm.Context) {
 		c.JSON(nil, ecode.RequestErr)
 		return
 	}
+	if dis.Closing() {
+		c.JSON(nil, errGoAway)
+		return
+	}
 	ch, new, miss, err := dis.Polls(c, arg)
 	if err != nil {
 		c.JSON(nil, err)
@@ -130,6 +203,13 @@ func polls(c *bm.Context) {
 	// wait for instance change
 	select {
 	case e := <-ch:
+		if len(arg.Scheme) != 0 {
+			fe := make(map[string]*model.InstanceInfo, len(e))
+			for appid, info := range e {
+				fe[appid] = info.FilterScheme(arg.Scheme)
+			}
+			e = fe
+		}
 		c.JSONMap(map[string]interface{}{
 			"data": e,
 			"error": map[ecode.Code]interface{}{
@@ -140,6 +220,10 @@ func polls(c *bm.Context) {
 			dis.DelConns(arg) // broadcast will delete all connections of appid
 		}
 		return
+	case <-dis.GoAway():
+		c.JSON(nil, errGoAway)
+		dis.DelConns(arg)
+		return
 	case <-time.After(_pollWaitSecond):
 	case <-c.Done():
 	}
@@ -152,18 +236,80 @@ func set(c *bm.Context) {
 	if err := c.Bind(arg); err != nil {
 		return
 	}
-	// len of color,status,metadata must equal to len of hostname or be zero
-	if (len(arg.Hostname) != len(arg.Status) && len(arg.Status) != 0) ||
-		(len(arg.Hostname) != len(arg.Metadata) && len(arg.Metadata) != 0) {
+	// len of color,status,metadata must equal to len of instance ids or be zero
+	ids := arg.IDs()
+	if (len(ids) != len(arg.Status) && len(arg.Status) != 0) ||
+		(len(ids) != len(arg.Metadata) && len(arg.Metadata) != 0) ||
+		(len(ids) != len(arg.Hostname) && len(arg.Hostname) != 0) {
 		c.JSON(nil, ecode.RequestErr)
 		return
 	}
-	if arg.SetTimestamp == 0 {
-		arg.SetTimestamp = time.Now().UnixNano()
+	c.JSON(dis.Set(c, arg))
+}
+
+func overrides(c *bm.Context) {
+	arg := new(model.ArgOverrides)
+	if err := c.Bind(arg); err != nil {
+		return
 	}
-	c.JSON(nil, dis.Set(c, arg))
+	c.JSON(dis.Overrides(c, arg), nil)
+}
+
+func clearOverride(c *bm.Context) {
+	arg := new(model.ArgClearOverride)
+	if err := c.Bind(arg); err != nil {
+		return
+	}
+	c.JSON(nil, dis.ClearOverride(c, arg))
 }
 
 func nodes(c *bm.Context) {
 	c.JSON(dis.Nodes(c), nil)
 }
+
+func members(c *bm.Context) {
+	c.JSON(dis.Members(c), nil)
+}
+
+func addMember(c *bm.Context) {
+	arg := new(model.ArgMember)
+	if err := c.Bind(arg); err != nil {
+		return
+	}
+	c.JSON(nil, dis.AddMember(c, arg))
+}
+
+func removeMember(c *bm.Context) {
+	arg := new(model.ArgMember)
+	if err := c.Bind(arg); err != nil {
+		return
+	}
+	c.JSON(nil, dis.RemoveMember(c, arg))
+}
+
+func decommissionMember(c *bm.Context) {
+	arg := new(model.ArgMember)
+	if err := c.Bind(arg); err != nil {
+		return
+	}
+	c.JSON(nil, dis.DecommissionMember(c, arg))
+}
+
+// healthLive always responds 200 while the process serves http, with the status in body.
+func healthLive(c *bm.Context) {
+	c.JSON(dis.Live(c), nil)
+}
+
+// healthReady responds 503 until the node serves reads, e.g. in init protect mode.
+func healthReady(c *bm.Context) {
+	h := dis.Health(c)
+	if h.Status == model.HealthUP {
+		c.JSON(h, nil)
+		return
+	}
+	c.Render(xhttp.StatusServiceUnavailable, render.JSON{
+		Code:    ecode.ServiceUnavailable.Code(),
+		Message: errProtected.Error(),
+		Data:    h,
+	})
+}
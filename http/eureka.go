@@ -0,0 +1,244 @@
+package http
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	xhttp "net/http"
+	"strings"
+	"time"
+
+	"github.com/bilibili/discovery/model"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+	log "github.com/go-kratos/kratos/pkg/log"
+	bm "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+)
+
+const (
+	// _eurekaDelta is the name of delta api, which shares the path of apps with app name.
+	_eurekaDelta = "delta"
+	// _eurekaDeltaWindow is the window of changes returned by delta, the same as eureka server.
+	_eurekaDeltaWindow = 3 * time.Minute
+)
+
+// eurekaRouter init the eureka rest api for eureka clients, instances are of the env of discovery node.
+func eurekaRouter(e *bm.Engine) {
+	e.GET("/eureka/apps", protectStatus, eurekaApps)
+	group := e.Group("/eureka/apps")
+	{
+		group.GET("/", protectStatus, eurekaApps)
+		group.GET("/:app", protectStatus, eurekaApp)
+		group.POST("/:app", eurekaAuth, eurekaRegister)
+		group.GET("/:app/:id", protectStatus, eurekaInstance)
+		group.PUT("/:app/:id", eurekaAuth, eurekaRenew)
+		group.DELETE("/:app/:id", eurekaAuth, eurekaCancel)
+		group.PUT("/:app/:id/status", eurekaAuth, eurekaStatus)
+		group.DELETE("/:app/:id/status", eurekaAuth, eurekaStatus)
+	}
+}
+
+// eurekaAuth aborts the write operation unless the token, usually the password of basic auth, is allowed to write the app.
+func eurekaAuth(c *bm.Context) {
+	req := c.Request
+	appid := model.EurekaAppID(c.Params.ByName("app"))
+	if err := dis.Authorize(token(req), appid, local.DeployEnv); err != nil {
+		log.Warn("authorize %s appid(%s) from(%s) error(%v)", req.URL.Path, appid, req.RemoteAddr, err)
+		eurekaError(c, err)
+		c.Abort()
+	}
+}
+
+func eurekaApps(c *bm.Context) {
+	apps, _ := dis.Services(c, local.DeployEnv, "")
+	eurekaRender(c, "applications", model.NewEurekaApplications(apps, nil, 0))
+}
+
+func eurekaApp(c *bm.Context) {
+	name := c.Params.ByName("app")
+	if name == _eurekaDelta {
+		since := dis.Now() - int64(_eurekaDeltaWindow)
+		apps, _ := dis.Services(c, local.DeployEnv, "")
+		eurekaRender(c, "applications", model.NewEurekaApplications(apps, dis.Removed(c, local.DeployEnv, since), since))
+		return
+	}
+	is, err := eurekaInstances(c, model.EurekaAppID(name))
+	if err != nil {
+		eurekaError(c, err)
+		return
+	}
+	ea := model.NewEurekaApplications(map[string][]*model.Instance{model.EurekaAppID(name): is}, nil, 0)
+	if len(ea.Applications) == 0 {
+		eurekaError(c, ecode.NothingFound)
+		return
+	}
+	eurekaRender(c, "application", ea.Applications[0])
+}
+
+func eurekaInstance(c *bm.Context) {
+	i, err := eurekaLocate(c)
+	if err != nil {
+		eurekaError(c, err)
+		return
+	}
+	eurekaRender(c, "instance", model.NewEurekaInstance(i))
+}
+
+func eurekaRegister(c *bm.Context) {
+	e := new(model.EurekaInstance)
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err == nil {
+		if strings.Contains(c.Request.Header.Get("Content-Type"), "xml") {
+			err = xml.Unmarshal(body, e)
+		} else {
+			err = json.Unmarshal(body, &struct {
+				Instance *model.EurekaInstance `json:"instance"`
+			}{e})
+		}
+	}
+	if err != nil || e.EurekaID() == "" {
+		log.Error("eureka register app(%s) body(%s) error(%v)", c.Params.ByName("app"), body, err)
+		eurekaError(c, ecode.RequestErr)
+		return
+	}
+	e.App = c.Params.ByName("app")
+	i := e.Instance(local.Region, local.Zone, local.DeployEnv)
+	if err = dis.CheckMetadata(i.Metadata); err != nil {
+		log.Error("eureka register app(%s) id(%s) error(%v)", c.Params.ByName("app"), i.ID(), err)
+		eurekaError(c, ecode.RequestErr)
+		return
+	}
+	now := dis.Now()
+	i.RegTimestamp, i.UpTimestamp, i.RenewTimestamp, i.DirtyTimestamp, i.LatestTimestamp = now, now, now, now, now
+	dis.Register(c, i, 0, false, false)
+	c.Bytes(xhttp.StatusNoContent, "")
+}
+
+func eurekaRenew(c *bm.Context) {
+	arg := &model.ArgRenew{
+		Zone:       local.Zone,
+		Env:        local.DeployEnv,
+		AppID:      model.EurekaAppID(c.Params.ByName("app")),
+		InstanceID: c.Params.ByName("id"),
+	}
+	_, err := dis.Renew(c, arg)
+	if err == ecode.NothingFound {
+		// NOTE: instances with metadata zone are registered in other zone.
+		var i *model.Instance
+		if i, err = eurekaLocate(c); err == nil && i.Zone != arg.Zone {
+			arg.Zone = i.Zone
+			_, err = dis.Renew(c, arg)
+		} else if err == nil {
+			err = ecode.NothingFound
+		}
+	}
+	eurekaError(c, err)
+}
+
+func eurekaCancel(c *bm.Context) {
+	i, err := eurekaLocate(c)
+	if err == nil {
+		err = dis.Cancel(c, &model.ArgCancel{Zone: i.Zone, Env: i.Env, AppID: i.AppID, Hostname: i.Hostname, InstanceID: i.ID()})
+	}
+	eurekaError(c, err)
+}
+
+// eurekaStatus overrides the status of instance by set, the status registered is restored if the override is removed.
+func eurekaStatus(c *bm.Context) {
+	i, err := eurekaLocate(c)
+	if err != nil {
+		eurekaError(c, err)
+		return
+	}
+	if c.Request.Method == xhttp.MethodDelete {
+		if err = dis.ClearOverride(c, &model.ArgClearOverride{AppID: i.AppID, Env: i.Env, Hostname: i.Hostname, InstanceID: i.ID()}); err == ecode.NothingFound {
+			err = nil
+		}
+		eurekaError(c, err)
+		return
+	}
+	status := model.InstanceStatusUP
+	if c.Request.URL.Query().Get("value") != model.EurekaUP {
+		status = model.InstancestatusWating
+	}
+	_, err = dis.Set(c, &model.ArgSet{
+		Region:     i.Region,
+		Zone:       i.Zone,
+		Env:        i.Env,
+		AppID:      i.AppID,
+		Hostname:   []string{i.Hostname},
+		InstanceID: []string{i.ID()},
+		Status:     []int64{int64(status)},
+		Override:   true,
+	})
+	eurekaError(c, err)
+}
+
+// eurekaInstances returns all instances of app in the env of discovery node.
+func eurekaInstances(c *bm.Context, appid string) (is []*model.Instance, err error) {
+	info, err := dis.Fetch(c, &model.ArgFetch{Env: local.DeployEnv, AppID: appid, Status: model.InstanceStatusUP | model.InstancestatusWating})
+	if err != nil {
+		return
+	}
+	for _, zis := range info.Instances {
+		is = append(is, zis...)
+	}
+	return
+}
+
+// eurekaLocate returns the instance of app and id in path, in whichever zone it is registered.
+func eurekaLocate(c *bm.Context) (i *model.Instance, err error) {
+	is, err := eurekaInstances(c, model.EurekaAppID(c.Params.ByName("app")))
+	if err != nil {
+		return
+	}
+	id := c.Params.ByName("id")
+	for _, i = range is {
+		if i.ID() == id {
+			return
+		}
+	}
+	return nil, ecode.NothingFound
+}
+
+// eurekaRender writes v in xml if the client prefers xml, otherwise in json wrapped by name.
+func eurekaRender(c *bm.Context, name string, v interface{}) {
+	var (
+		b      []byte
+		err    error
+		accept = c.Request.Header.Get("Accept")
+		ct     = "application/json"
+	)
+	if strings.Contains(accept, "xml") && !strings.Contains(accept, "json") {
+		ct = "application/xml"
+		b, err = xml.Marshal(v)
+	} else {
+		b, err = json.Marshal(map[string]interface{}{name: v})
+	}
+	if err != nil {
+		log.Error("eureka marshal %s error(%v)", name, err)
+		c.String(xhttp.StatusInternalServerError, "%v", err)
+		return
+	}
+	c.Bytes(xhttp.StatusOK, ct, b)
+}
+
+// eurekaError writes the http status of err, which is what eureka clients check.
+func eurekaError(c *bm.Context, err error) {
+	status := xhttp.StatusInternalServerError
+	switch ecode.Cause(err).Code() {
+	case ecode.OK.Code():
+		status = xhttp.StatusOK
+	case ecode.RequestErr.Code():
+		status = xhttp.StatusBadRequest
+	case ecode.Unauthorized.Code():
+		status = xhttp.StatusUnauthorized
+	case ecode.AccessDenied.Code():
+		status = xhttp.StatusForbidden
+	case ecode.NothingFound.Code():
+		status = xhttp.StatusNotFound
+	case ecode.Conflict.Code():
+		status = xhttp.StatusConflict
+	}
+	c.Bytes(status, "")
+}
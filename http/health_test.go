@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	xhttp "net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	dc "github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/discovery"
+	"github.com/bilibili/discovery/model"
+
+	"github.com/go-kratos/kratos/pkg/conf/paladin"
+	"github.com/go-kratos/kratos/pkg/ecode"
+	bm "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+	xtime "github.com/go-kratos/kratos/pkg/time"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMain(m *testing.M) {
+	flag.Set("conf", "./")
+	flag.Parse()
+	paladin.Init()
+	os.Exit(m.Run())
+}
+
+func newEngine(protect bool) (e *bm.Engine, cancel context.CancelFunc) {
+	c := &dc.Config{
+		HTTPClient:    &bm.ClientConfig{Timeout: xtime.Duration(time.Second), Dial: xtime.Duration(time.Second)},
+		HTTPServer:    &bm.ServerConfig{Addr: "127.0.0.1:7171"},
+		Nodes:         []string{"127.0.0.1:7171"},
+		Env:           &dc.Env{Zone: "sh001", DeployEnv: "pre", Host: "test_server"},
+		EnableProtect: protect,
+	}
+	dis, cancel = discovery.New(c)
+	e = bm.NewServer(nil)
+	innerRouter(e)
+	return
+}
+
+func get(e *bm.Engine, path string) (code int, res struct {
+	Code int           `json:"code"`
+	Data *model.Health `json:"data"`
+}) {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res
+}
+
+func TestHealth(t *testing.T) {
+	Convey("test health in protect mode", t, func() {
+		e, cancel := newEngine(true)
+		defer cancel()
+		So(dis.Protected(), ShouldBeTrue)
+		code, res := get(e, "/discovery/health/live")
+		So(code, ShouldEqual, xhttp.StatusOK)
+		So(res.Data.Status, ShouldEqual, model.HealthUP)
+		So(res.Data.Protected, ShouldBeTrue)
+		code, res = get(e, "/discovery/health/ready")
+		So(code, ShouldEqual, xhttp.StatusServiceUnavailable)
+		So(res.Code, ShouldEqual, ecode.ServiceUnavailable.Code())
+		So(res.Data.Status, ShouldEqual, model.HealthDown)
+	})
+	Convey("test health out of protect mode", t, func() {
+		e, cancel := newEngine(false)
+		defer cancel()
+		code, res := get(e, "/discovery/health/live")
+		So(code, ShouldEqual, xhttp.StatusOK)
+		So(res.Data.Status, ShouldEqual, model.HealthUP)
+		code, res = get(e, "/discovery/health/ready")
+		So(code, ShouldEqual, xhttp.StatusOK)
+		So(res.Code, ShouldEqual, 0)
+		So(res.Data.Status, ShouldEqual, model.HealthUP)
+		So(res.Data.Instances, ShouldEqual, 1)
+	})
+}
@@ -1,54 +1,245 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"net"
+	xhttp "net/http"
+	"strings"
+	"time"
 
 	"github.com/bilibili/discovery/conf"
 	"github.com/bilibili/discovery/discovery"
+	"github.com/bilibili/discovery/model"
 
+	"github.com/go-kratos/kratos/pkg/ecode"
 	log "github.com/go-kratos/kratos/pkg/log"
 	bm "github.com/go-kratos/kratos/pkg/net/http/blademaster"
 )
 
+const (
+	// _staleHeader marks responses served in protect mode, which may be incomplete.
+	_staleHeader = "X-Discovery-Stale"
+)
+
+// _adminPaths are the routes of bm hidden from client listener when admin listener is configured.
+var _adminPaths = []string{"/metrics", "/metadata"}
+
 var (
 	dis          *discovery.Discovery
+	local        *conf.Env
+	servers      []*xhttp.Server
 	protected    = true
 	errProtected = errors.New("discovery in protect mode and only support register")
+	// errGoAway answers polls on shutdown, clients switch to other node at once.
+	errGoAway = ecode.ServiceUnavailable
 )
 
 // Init init http
 func Init(c *conf.Config, s *discovery.Discovery) {
 	dis = s
+	local = c.Env
 	engineInner := bm.DefaultServer(c.HTTPServer)
 	innerRouter(engineInner)
-	if err := engineInner.Start(); err != nil {
-		log.Error("bm.DefaultServer error(%v)", err)
+	innerRouterV2(engineInner)
+	consulRouter(engineInner)
+	eurekaRouter(engineInner)
+	if c.AdminServer == nil {
+		adminRouter(engineInner)
+		adminRouterV2(engineInner)
+		serve(engineInner, c, c.HTTPServer)
+		return
+	}
+	// NOTE: replication and syncup of peers are kept on client listener, only for peer nodes.
+	group := engineInner.Group("/discovery")
+	group.POST("/set", peerOnly, set)
+	group.POST("/overrides/clear", peerOnly, clearOverride)
+	group.POST("/members/add", peerOnly, addMember)
+	group.POST("/members/remove", peerOnly, removeMember)
+	group.POST("/members/decommission", peerOnly, decommissionMember)
+	group.GET("/fetch/all", authPeer, initProtect, fetchAll)
+	group.GET("/sync/apps", authPeer, initProtect, syncApps)
+	group.GET("/sync/app", authPeer, initProtect, syncApp)
+	engineAdmin := bm.DefaultServer(c.AdminServer)
+	adminRouter(engineAdmin)
+	adminRouterV2(engineAdmin)
+	serve(hide(engineInner, _adminPaths...), c, c.HTTPServer)
+	serve(engineAdmin, c, c.AdminServer)
+}
+
+// Shutdown closes the listeners and waits for active requests until the deadline of ctx.
+func Shutdown(ctx context.Context) (err error) {
+	for _, server := range servers {
+		if e := server.Shutdown(ctx); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+// serve listens on the addr of sc and serves h, over tls if enabled.
+func serve(h xhttp.Handler, c *conf.Config, sc *bm.ServerConfig) {
+	l, err := listen(c, sc.Addr)
+	if err != nil {
+		log.Error("listen(%s) error(%v)", sc.Addr, err)
 		panic(err)
 	}
-	log.Info("[HTTP] Listening on: %s", c.HTTPServer.Addr)
+	server := &xhttp.Server{
+		Handler:      h,
+		ReadTimeout:  time.Duration(sc.ReadTimeout),
+		WriteTimeout: time.Duration(sc.WriteTimeout),
+	}
+	servers = append(servers, server)
+	go func() {
+		if err := server.Serve(l); err != nil && err != xhttp.ErrServerClosed {
+			log.Error("server.Serve(%s) error(%v)", sc.Addr, err)
+			panic(err)
+		}
+	}()
+	if c.TLS.Enabled() {
+		log.Info("[HTTPS] Listening on: %s", sc.Addr)
+	} else {
+		log.Info("[HTTP] Listening on: %s", sc.Addr)
+	}
 }
 
-// innerRouter init local router api path.
+// listen listens on addr, over tls if enabled.
+func listen(c *conf.Config, addr string) (l net.Listener, err error) {
+	if l, err = net.Listen("tcp", addr); err != nil || !c.TLS.Enabled() {
+		return
+	}
+	tc, err := c.TLS.Server()
+	if err != nil {
+		l.Close()
+		return
+	}
+	return tls.NewListener(l, tc), nil
+}
+
+// hide responds 404 to paths, e.g. the routes bm registers on every engine.
+func hide(h xhttp.Handler, paths ...string) xhttp.Handler {
+	return xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		for _, path := range paths {
+			if r.URL.Path == path {
+				xhttp.NotFound(w, r)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// innerRouter init local router api path, used by clients and peers.
 func innerRouter(e *bm.Engine) {
 	group := e.Group("/discovery")
 	{
-		group.POST("/register", register)
-		group.POST("/renew", renew)
-		group.POST("/cancel", cancel)
-		group.GET("/fetch/all", initProtect, fetchAll)
+		group.POST("/register", authApp, register)
+		group.POST("/renew", authApp, renew)
+		group.POST("/cancel", authApp, cancel)
 		group.GET("/fetch", initProtect, fetch)
 		group.GET("/fetchs", initProtect, fetchs)
 		group.GET("/poll", initProtect, poll)
 		group.GET("/polls", initProtect, polls)
-		//manager
-		group.POST("/set", set)
 		group.GET("/nodes", initProtect, nodes)
+		group.GET("/changes", initProtect, changes)
+		group.GET("/overrides", overrides)
+		//probe
+		group.GET("/health/live", healthLive)
+		group.GET("/health/ready", healthReady)
+	}
+}
+
+// adminRouter init management api path, served by admin listener if configured.
+func adminRouter(e *bm.Engine) {
+	group := e.Group("/discovery")
+	{
+		group.GET("/fetch/all", initProtect, fetchAll)
+		group.GET("/sync/apps", initProtect, syncApps)
+		group.GET("/sync/app", initProtect, syncApp)
+		group.POST("/set", authApp, set)
+		group.POST("/overrides/clear", authApp, clearOverride)
+		group.GET("/members", members)
+		group.POST("/members/add", authAdmin, addMember)
+		group.POST("/members/remove", authAdmin, removeMember)
+		group.POST("/members/decommission", authAdmin, decommissionMember)
+		//dashboard
+		group.GET("/dashboard", dashboard)
+	}
+}
+
+// peerOnly aborts requests not replicated by peers, see authPeer.
+func peerOnly(ctx *bm.Context) {
+	req := ctx.Request
+	if req.FormValue("replication") != "true" && req.FormValue("from_zone") != "true" {
+		log.Warn("peer only %s from(%s) not replicated", req.URL.Path, req.RemoteAddr)
+		ctx.JSON(nil, ecode.AccessDenied)
+		ctx.Abort()
+		return
+	}
+	authPeer(ctx)
+}
+
+// authPeer aborts requests not sent by peer nodes, which present admin token if auth is enabled,
+// otherwise they are known by the hosts of nodes.
+func authPeer(ctx *bm.Context) {
+	req := ctx.Request
+	if err := dis.AuthorizePeer(token(req), req.RemoteAddr); err != nil {
+		log.Warn("authorize peer %s from(%s) error(%v)", req.URL.Path, req.RemoteAddr, err)
+		ctx.JSON(nil, err)
+		ctx.Abort()
 	}
 }
 
 func initProtect(ctx *bm.Context) {
 	if dis.Protected() {
+		if dis.StaleRead() {
+			ctx.Writer.Header().Set(_staleHeader, "1")
+			return
+		}
 		ctx.JSON(nil, errProtected)
 		ctx.AbortWithStatus(503)
 	}
 }
+
+// protectStatus answers 503 in protect mode for the apis of other registries, unless stale read is enabled.
+func protectStatus(c *bm.Context) {
+	if !dis.Protected() {
+		return
+	}
+	if dis.StaleRead() {
+		c.Writer.Header().Set(_staleHeader, "1")
+		return
+	}
+	c.String(xhttp.StatusServiceUnavailable, "%s", errProtected)
+	c.Abort()
+}
+
+// authApp aborts the write operation unless the token is allowed to write the appid and env in form.
+func authApp(ctx *bm.Context) {
+	req := ctx.Request
+	appid, env := req.FormValue("appid"), req.FormValue("env")
+	if err := dis.Authorize(token(req), appid, env); err != nil {
+		log.Warn("authorize %s appid(%s) env(%s) from(%s) error(%v)", req.URL.Path, appid, env, req.RemoteAddr, err)
+		ctx.JSON(nil, err)
+		ctx.Abort()
+	}
+}
+
+// authAdmin aborts the operator api unless the token is an admin token.
+func authAdmin(ctx *bm.Context) {
+	req := ctx.Request
+	if err := dis.AuthorizeAdmin(token(req)); err != nil {
+		log.Warn("authorize %s from(%s) error(%v)", req.URL.Path, req.RemoteAddr, err)
+		ctx.JSON(nil, err)
+		ctx.Abort()
+	}
+}
+
+// token returns the bearer token, or the password of basic auth used by clients like eureka.
+func token(req *xhttp.Request) string {
+	if _, password, ok := req.BasicAuth(); ok {
+		return password
+	}
+	return strings.TrimPrefix(req.Header.Get(model.AuthHeader), model.AuthBearer)
+}
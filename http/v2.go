@@ -0,0 +1,195 @@
+package http
+
+import (
+	"encoding/json"
+	xhttp "net/http"
+
+	"github.com/bilibili/discovery/model"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+	log "github.com/go-kratos/kratos/pkg/log"
+	bm "github.com/go-kratos/kratos/pkg/net/http/blademaster"
+	"github.com/go-kratos/kratos/pkg/net/http/blademaster/binding"
+	"github.com/go-kratos/kratos/pkg/net/http/blademaster/render"
+)
+
+// errorsV2 maps ecode to the http status and reason of v2 api.
+var errorsV2 = map[int]struct {
+	status  int
+	reason  string
+	message string
+}{
+	ecode.NotModified.Code():        {xhttp.StatusNotModified, "NOT_MODIFIED", "instances not modified"},
+	ecode.RequestErr.Code():         {xhttp.StatusBadRequest, "BAD_REQUEST", "invalid request"},
+	ecode.Unauthorized.Code():       {xhttp.StatusUnauthorized, "UNAUTHORIZED", "token required"},
+	ecode.AccessDenied.Code():       {xhttp.StatusForbidden, "FORBIDDEN", "token not allowed to write the app"},
+	ecode.NothingFound.Code():       {xhttp.StatusNotFound, "NOT_FOUND", "app or instance not found"},
+	ecode.Conflict.Code():           {xhttp.StatusConflict, "CONFLICT", "instance changed by a newer write"},
+	ecode.ServiceUnavailable.Code(): {xhttp.StatusServiceUnavailable, "UNAVAILABLE", "discovery node unavailable"},
+}
+
+// innerRouterV2 init the json api of v2 used by clients.
+func innerRouterV2(e *bm.Engine) {
+	group := e.Group("/discovery/v2")
+	{
+		group.POST("/register", registerV2)
+		group.POST("/renew", renewV2)
+		group.POST("/cancel", cancelV2)
+		group.GET("/fetch", protectV2, fetchV2)
+		group.GET("/nodes", protectV2, nodesV2)
+	}
+}
+
+// adminRouterV2 init the management json api of v2.
+func adminRouterV2(e *bm.Engine) {
+	e.Group("/discovery/v2").POST("/set", setV2)
+}
+
+// renderV2 writes data, or the error object with the http status of err.
+func renderV2(c *bm.Context, data interface{}, err error) {
+	c.Error = err
+	if err == nil {
+		c.Render(xhttp.StatusOK, render.MapJSON{"data": data})
+		return
+	}
+	ec := ecode.Cause(err)
+	e := &model.ErrorV2{
+		Code:    ec.Code(),
+		Status:  xhttp.StatusInternalServerError,
+		Reason:  "INTERNAL",
+		Message: ec.Message(),
+	}
+	if v, ok := errorsV2[ec.Code()]; ok {
+		e.Status, e.Reason = v.status, v.reason
+		// NOTE: bare ecode has no message, errors with message explain themselves.
+		if _, ok := err.(ecode.Code); ok {
+			e.Message = v.message
+		}
+	}
+	if _, ok := err.(ecode.Codes); !ok {
+		e.Message = err.Error()
+	}
+	body := render.MapJSON{"error": e}
+	if data != nil {
+		body["data"] = data
+	}
+	c.Render(e.Status, body)
+}
+
+// bindV2 binds the json body, or query of GET requests, and renders the error.
+func bindV2(c *bm.Context, arg interface{}) (err error) {
+	var b binding.Binding = binding.JSON
+	if c.Request.Method == xhttp.MethodGet {
+		b = binding.Form
+	}
+	if err = b.Bind(c.Request, arg); err != nil {
+		renderV2(c, nil, ecode.Error(ecode.RequestErr, err.Error()))
+		return
+	}
+	return
+}
+
+// authV2 authorizes the write operation of appid and env in json body.
+func authV2(c *bm.Context, appid, env string) (err error) {
+	if err = dis.Authorize(token(c.Request), appid, env); err != nil {
+		log.Warn("authorize %s appid(%s) env(%s) from(%s) error(%v)", c.Request.URL.Path, appid, env, c.Request.RemoteAddr, err)
+		renderV2(c, nil, err)
+	}
+	return
+}
+
+func protectV2(c *bm.Context) {
+	if dis.Protected() {
+		if dis.StaleRead() {
+			c.Writer.Header().Set(_staleHeader, "1")
+			return
+		}
+		renderV2(c, nil, ecode.Error(ecode.ServiceUnavailable, errProtected.Error()))
+		c.Abort()
+	}
+}
+
+func registerV2(c *bm.Context) {
+	arg := new(model.ArgRegisterV2)
+	if bindV2(c, arg) != nil || authV2(c, arg.AppID, arg.Env) != nil {
+		return
+	}
+	if arg.Status != model.InstanceStatusUP && arg.Status != model.InstancestatusWating {
+		renderV2(c, nil, ecode.Error(ecode.RequestErr, "status must be 1(up) or 2(waiting)"))
+		return
+	}
+	err := model.ValidateAddrs(arg.Addrs)
+	if err == nil {
+		err = dis.CheckMetadata(arg.Metadata)
+	}
+	if err != nil {
+		renderV2(c, nil, ecode.Error(ecode.RequestErr, err.Error()))
+		return
+	}
+	reg := &model.ArgRegister{
+		Region:     arg.Region,
+		Zone:       arg.Zone,
+		Env:        arg.Env,
+		AppID:      arg.AppID,
+		Hostname:   arg.Hostname,
+		Status:     arg.Status,
+		Addrs:      arg.Addrs,
+		Version:    arg.Version,
+		InstanceID: arg.InstanceID,
+	}
+	if arg.Metadata != nil {
+		bs, _ := json.Marshal(arg.Metadata)
+		reg.Metadata = string(bs)
+	}
+	i := model.NewInstance(reg)
+	i.DirtyTimestamp = dis.Now()
+	dis.Register(c, i, 0, false, false)
+	renderV2(c, i, nil)
+}
+
+func renewV2(c *bm.Context) {
+	arg := new(model.ArgInstanceV2)
+	if bindV2(c, arg) != nil || authV2(c, arg.AppID, arg.Env) != nil {
+		return
+	}
+	_, err := dis.Renew(c, &model.ArgRenew{Zone: arg.Zone, Env: arg.Env, AppID: arg.AppID, Hostname: arg.Hostname, InstanceID: arg.InstanceID})
+	renderV2(c, nil, err)
+}
+
+func cancelV2(c *bm.Context) {
+	arg := new(model.ArgInstanceV2)
+	if bindV2(c, arg) != nil || authV2(c, arg.AppID, arg.Env) != nil {
+		return
+	}
+	renderV2(c, nil, dis.Cancel(c, &model.ArgCancel{Zone: arg.Zone, Env: arg.Env, AppID: arg.AppID, Hostname: arg.Hostname, InstanceID: arg.InstanceID}))
+}
+
+func setV2(c *bm.Context) {
+	arg := new(model.ArgSetV2)
+	if bindV2(c, arg) != nil || authV2(c, arg.AppID, arg.Env) != nil {
+		return
+	}
+	conflicts, err := dis.Set(c, arg.ArgSet())
+	if len(conflicts) != 0 {
+		renderV2(c, conflicts, err)
+		return
+	}
+	renderV2(c, nil, err)
+}
+
+func fetchV2(c *bm.Context) {
+	arg := new(model.ArgFetch)
+	if bindV2(c, arg) != nil {
+		return
+	}
+	info, err := dis.Fetch(c, arg)
+	if err != nil {
+		renderV2(c, nil, err)
+		return
+	}
+	renderV2(c, info, nil)
+}
+
+func nodesV2(c *bm.Context) {
+	renderV2(c, dis.Nodes(c), nil)
+}
@@ -0,0 +1,25 @@
+package model
+
+// actions of change feed.
+const (
+	ChangeRegister = "register"
+	ChangeCancel   = "cancel"
+	ChangeEvict    = "evict"
+	ChangeSet      = "set"
+)
+
+// Change is a mutation of registry, Instance is the instance after the mutation,
+// or the removed one of cancel and evict.
+type Change struct {
+	Seq      int64     `json:"seq"`
+	Action   string    `json:"action"`
+	Instance *Instance `json:"instance"`
+}
+
+// Changes is a page of change feed, Cursor is the seq of the last change, or the cursor requested if empty.
+type Changes struct {
+	Changes []*Change `json:"changes"`
+	Cursor  int64     `json:"cursor"`
+	// More whether there are changes after Cursor.
+	More bool `json:"more"`
+}
@@ -0,0 +1,207 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// consul health check status.
+const (
+	ConsulPassing  = "passing"
+	ConsulCritical = "critical"
+)
+
+const (
+	_consulWeight = 10
+)
+
+// ConsulNode is the node of consul, an instance is a node named by its hostname.
+type ConsulNode struct {
+	ID              string            `json:"ID"`
+	Node            string            `json:"Node"`
+	Address         string            `json:"Address"`
+	Datacenter      string            `json:"Datacenter"`
+	TaggedAddresses map[string]string `json:"TaggedAddresses"`
+	Meta            map[string]string `json:"Meta"`
+	CreateIndex     uint64            `json:"CreateIndex"`
+	ModifyIndex     uint64            `json:"ModifyIndex"`
+}
+
+// ConsulWeights is the weights of consul service.
+type ConsulWeights struct {
+	Passing int `json:"Passing"`
+	Warning int `json:"Warning"`
+}
+
+// ConsulService is the service of consul, each addr of an instance is a service tagged by its scheme.
+type ConsulService struct {
+	ID                string            `json:"ID"`
+	Service           string            `json:"Service"`
+	Tags              []string          `json:"Tags"`
+	Address           string            `json:"Address"`
+	Meta              map[string]string `json:"Meta"`
+	Port              int               `json:"Port"`
+	Weights           ConsulWeights     `json:"Weights"`
+	EnableTagOverride bool              `json:"EnableTagOverride"`
+	CreateIndex       uint64            `json:"CreateIndex"`
+	ModifyIndex       uint64            `json:"ModifyIndex"`
+}
+
+// ConsulCheck is the health check of consul, passing if the instance is up.
+type ConsulCheck struct {
+	Node        string   `json:"Node"`
+	CheckID     string   `json:"CheckID"`
+	Name        string   `json:"Name"`
+	Status      string   `json:"Status"`
+	Notes       string   `json:"Notes"`
+	Output      string   `json:"Output"`
+	ServiceID   string   `json:"ServiceID"`
+	ServiceName string   `json:"ServiceName"`
+	ServiceTags []string `json:"ServiceTags"`
+	CreateIndex uint64   `json:"CreateIndex"`
+	ModifyIndex uint64   `json:"ModifyIndex"`
+}
+
+// ConsulServiceEntry is the element of /v1/health/service/<name>.
+type ConsulServiceEntry struct {
+	Node    *ConsulNode    `json:"Node"`
+	Service *ConsulService `json:"Service"`
+	Checks  []*ConsulCheck `json:"Checks"`
+}
+
+// ConsulCatalogService is the element of /v1/catalog/service/<name>.
+type ConsulCatalogService struct {
+	ID                       string            `json:"ID"`
+	Node                     string            `json:"Node"`
+	Address                  string            `json:"Address"`
+	Datacenter               string            `json:"Datacenter"`
+	TaggedAddresses          map[string]string `json:"TaggedAddresses"`
+	NodeMeta                 map[string]string `json:"NodeMeta"`
+	ServiceID                string            `json:"ServiceID"`
+	ServiceName              string            `json:"ServiceName"`
+	ServiceAddress           string            `json:"ServiceAddress"`
+	ServiceTags              []string          `json:"ServiceTags"`
+	ServiceMeta              map[string]string `json:"ServiceMeta"`
+	ServicePort              int               `json:"ServicePort"`
+	ServiceWeights           ConsulWeights     `json:"ServiceWeights"`
+	ServiceEnableTagOverride bool              `json:"ServiceEnableTagOverride"`
+	CreateIndex              uint64            `json:"CreateIndex"`
+	ModifyIndex              uint64            `json:"ModifyIndex"`
+}
+
+// ConsulEntries translates the addrs of instances into consul service entries, filtered by tag if not empty.
+func ConsulEntries(is []*Instance, tag string) (es []*ConsulServiceEntry) {
+	es = make([]*ConsulServiceEntry, 0, len(is))
+	for _, i := range is {
+		node := &ConsulNode{
+			Node:            i.Hostname,
+			Datacenter:      i.Zone,
+			TaggedAddresses: map[string]string{},
+			Meta: map[string]string{
+				"region": i.Region,
+				"zone":   i.Zone,
+				"env":    i.Env,
+			},
+			CreateIndex: uint64(i.RegTimestamp),
+			ModifyIndex: uint64(i.LatestTimestamp),
+		}
+		for _, e := range i.Endpoints() {
+			if tag != "" && e.Scheme != tag {
+				continue
+			}
+			n := *node
+			n.Address = e.Host
+			if net.ParseIP(n.Address) != nil {
+				n.TaggedAddresses = map[string]string{"lan": n.Address}
+			}
+			svc := &ConsulService{
+				ID:          fmt.Sprintf("%s:%s:%d", i.Hostname, e.Scheme, e.Port),
+				Service:     i.AppID,
+				Tags:        []string{e.Scheme},
+				Address:     n.Address,
+				Meta:        consulMeta(i),
+				Port:        e.Port,
+				Weights:     ConsulWeights{Passing: e.Weight(consulWeight(i)), Warning: 1},
+				CreateIndex: n.CreateIndex,
+				ModifyIndex: n.ModifyIndex,
+			}
+			check := &ConsulCheck{
+				Node:        i.Hostname,
+				CheckID:     "service:" + svc.ID,
+				Name:        "discovery status",
+				Status:      ConsulPassing,
+				Output:      "instance is up",
+				ServiceID:   svc.ID,
+				ServiceName: svc.Service,
+				ServiceTags: svc.Tags,
+				CreateIndex: n.CreateIndex,
+				ModifyIndex: n.ModifyIndex,
+			}
+			if i.Status != InstanceStatusUP {
+				check.Status = ConsulCritical
+				check.Output = "instance is waiting"
+			}
+			es = append(es, &ConsulServiceEntry{Node: &n, Service: svc, Checks: []*ConsulCheck{check}})
+		}
+	}
+	return
+}
+
+// ConsulCatalog translates service entries into the elements of consul catalog.
+func ConsulCatalog(es []*ConsulServiceEntry) (cs []*ConsulCatalogService) {
+	cs = make([]*ConsulCatalogService, 0, len(es))
+	for _, e := range es {
+		cs = append(cs, &ConsulCatalogService{
+			Node:            e.Node.Node,
+			Address:         e.Node.Address,
+			Datacenter:      e.Node.Datacenter,
+			TaggedAddresses: e.Node.TaggedAddresses,
+			NodeMeta:        e.Node.Meta,
+			ServiceID:       e.Service.ID,
+			ServiceName:     e.Service.Service,
+			ServiceAddress:  e.Service.Address,
+			ServiceTags:     e.Service.Tags,
+			ServiceMeta:     e.Service.Meta,
+			ServicePort:     e.Service.Port,
+			ServiceWeights:  e.Service.Weights,
+			CreateIndex:     e.Service.CreateIndex,
+			ModifyIndex:     e.Service.ModifyIndex,
+		})
+	}
+	return
+}
+
+// ConsulTags returns the tags of instances, which are the schemes of addrs.
+func ConsulTags(is []*Instance) (tags []string) {
+	tags = make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, i := range is {
+		for _, e := range i.Endpoints() {
+			if _, ok := seen[e.Scheme]; !ok {
+				seen[e.Scheme] = struct{}{}
+				tags = append(tags, e.Scheme)
+			}
+		}
+	}
+	return
+}
+
+func consulMeta(i *Instance) (meta map[string]string) {
+	meta = make(map[string]string, len(i.Metadata)+1)
+	for k, v := range i.Metadata {
+		meta[k] = v
+	}
+	if i.Version != "" {
+		meta["version"] = i.Version
+	}
+	return
+}
+
+func consulWeight(i *Instance) int {
+	w, err := strconv.Atoi(i.Metadata["weight"])
+	if err != nil || w <= 0 {
+		return _consulWeight
+	}
+	return w
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConsulEntries(t *testing.T) {
+	Convey("test consul entries of instances", t, func() {
+		is := []*Instance{
+			{Region: "sh", Zone: "sh001", Env: "prod", AppID: "provider", Hostname: "h1", Version: "1.0", Status: InstanceStatusUP,
+				Addrs:    []string{"http://10.0.0.1:8080", "grpc://10.0.0.1:9000?weight=20", "invalid"},
+				Metadata: map[string]string{"weight": "5"}, RegTimestamp: 1, LatestTimestamp: 2},
+			{Region: "sh", Zone: "sh002", Env: "prod", AppID: "provider", Hostname: "h2", Status: InstancestatusWating,
+				Addrs: []string{"grpc://h2.local:9000"}},
+		}
+		es := ConsulEntries(is, "")
+		So(len(es), ShouldEqual, 3)
+		e := es[0]
+		So(e.Node.Node, ShouldEqual, "h1")
+		So(e.Node.Address, ShouldEqual, "10.0.0.1")
+		So(e.Node.Datacenter, ShouldEqual, "sh001")
+		So(e.Node.TaggedAddresses, ShouldResemble, map[string]string{"lan": "10.0.0.1"})
+		So(e.Node.Meta, ShouldResemble, map[string]string{"region": "sh", "zone": "sh001", "env": "prod"})
+		So(e.Service.ID, ShouldEqual, "h1:http:8080")
+		So(e.Service.Service, ShouldEqual, "provider")
+		So(e.Service.Tags, ShouldResemble, []string{"http"})
+		So(e.Service.Port, ShouldEqual, 8080)
+		So(e.Service.Meta, ShouldResemble, map[string]string{"weight": "5", "version": "1.0"})
+		So(e.Service.Weights, ShouldResemble, ConsulWeights{Passing: 5, Warning: 1})
+		So(e.Service.CreateIndex, ShouldEqual, 1)
+		So(e.Service.ModifyIndex, ShouldEqual, 2)
+		So(e.Checks[0].Status, ShouldEqual, ConsulPassing)
+		So(e.Checks[0].ServiceID, ShouldEqual, e.Service.ID)
+		// NOTE: the weight of endpoint wins over the weight of instance.
+		So(es[1].Service.Weights.Passing, ShouldEqual, 20)
+		So(es[2].Node.TaggedAddresses, ShouldResemble, map[string]string{})
+		So(es[2].Service.Weights.Passing, ShouldEqual, _consulWeight)
+		So(es[2].Checks[0].Status, ShouldEqual, ConsulCritical)
+		es = ConsulEntries(is, "grpc")
+		So(len(es), ShouldEqual, 2)
+		So(es[0].Service.ID, ShouldEqual, "h1:grpc:9000")
+		So(es[1].Service.ID, ShouldEqual, "h2:grpc:9000")
+		So(len(ConsulEntries(is, "https")), ShouldEqual, 0)
+		cs := ConsulCatalog(ConsulEntries(is, "http"))
+		So(len(cs), ShouldEqual, 1)
+		So(cs[0].ServiceAddress, ShouldEqual, "10.0.0.1")
+		So(cs[0].ServicePort, ShouldEqual, 8080)
+	})
+}
+
+func TestConsulTags(t *testing.T) {
+	Convey("test consul tags of instances", t, func() {
+		So(ConsulTags(nil), ShouldResemble, []string{})
+		is := []*Instance{
+			{Addrs: []string{"http://10.0.0.1:8080", "grpc://10.0.0.1:9000"}},
+			{Addrs: []string{"grpc://10.0.0.2:9000", "10.0.0.2:7000"}},
+		}
+		So(ConsulTags(is), ShouldResemble, []string{"http", "grpc"})
+	})
+}
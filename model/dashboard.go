@@ -0,0 +1,26 @@
+package model
+
+// Dashboard is the view of discovery dashboard for operators.
+type Dashboard struct {
+	Health     *Health
+	Nodes      []*Node
+	Schedulers []*Scheduler
+	Apps       []*DashboardApp
+	// filters of apps
+	Env   string
+	Zone  string
+	AppID string
+}
+
+// DashboardApp is the instances of an app in env grouped by zone.
+type DashboardApp struct {
+	AppID string
+	Env   string
+	Zones []*DashboardZone
+}
+
+// DashboardZone is the instances of an app in zone.
+type DashboardZone struct {
+	Zone      string
+	Instances []*Instance
+}
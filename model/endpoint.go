@@ -0,0 +1,159 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// endpoint metadata common key.
+const (
+	EndpointWeight = "weight"
+	EndpointTLS    = "tls"
+)
+
+var defaultPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+}
+
+// Endpoint is an addr of instance, like "grpc://10.0.0.1:9000?weight=20&tls=true",
+// in which the query is the metadata of endpoint.
+type Endpoint struct {
+	Scheme   string            `json:"scheme"`
+	Host     string            `json:"host"`
+	Port     int               `json:"port"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ParseEndpoint parses addr, scheme and host are required, port is required unless the scheme has a default one.
+func ParseEndpoint(addr string) (e *Endpoint, err error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme == "" || u.Hostname() == "" {
+		return nil, fmt.Errorf("addr(%s) must be scheme://host:port", addr)
+	}
+	e = &Endpoint{Scheme: u.Scheme, Host: u.Hostname()}
+	if p := u.Port(); p != "" {
+		if e.Port, err = strconv.Atoi(p); err != nil || e.Port <= 0 || e.Port > 65535 {
+			return nil, fmt.Errorf("addr(%s) port invalid", addr)
+		}
+	} else if e.Port = defaultPorts[u.Scheme]; e.Port == 0 {
+		return nil, fmt.Errorf("addr(%s) port is required", addr)
+	}
+	if u.RawQuery != "" {
+		q, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			return nil, fmt.Errorf("addr(%s) metadata invalid: %v", addr, err)
+		}
+		e.Metadata = make(map[string]string, len(q))
+		for k := range q {
+			e.Metadata[k] = q.Get(k)
+		}
+	}
+	return
+}
+
+// ValidateAddrs returns the error of the first invalid addr.
+func ValidateAddrs(addrs []string) (err error) {
+	for _, addr := range addrs {
+		if _, err = ParseEndpoint(addr); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Addr returns host:port.
+func (e *Endpoint) Addr() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// String returns the addr of endpoint, metadata in query sorted by key.
+func (e *Endpoint) String() string {
+	s := e.Scheme + "://" + e.Addr()
+	if len(e.Metadata) == 0 {
+		return s
+	}
+	keys := make([]string, 0, len(e.Metadata))
+	for k := range e.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	q := make([]string, 0, len(keys))
+	for _, k := range keys {
+		q = append(q, url.QueryEscape(k)+"="+url.QueryEscape(e.Metadata[k]))
+	}
+	return s + "?" + strings.Join(q, "&")
+}
+
+// Weight returns the weight of endpoint, or def if not set.
+func (e *Endpoint) Weight(def int) int {
+	if w, err := strconv.Atoi(e.Metadata[EndpointWeight]); err == nil && w > 0 {
+		return w
+	}
+	return def
+}
+
+// TLS returns whether the endpoint requires tls, which is implied by https.
+func (e *Endpoint) TLS() bool {
+	tls, _ := strconv.ParseBool(e.Metadata[EndpointTLS])
+	return tls || e.Scheme == "https"
+}
+
+// Endpoints returns the valid endpoints of instance, of the schemes if any.
+func (i *Instance) Endpoints(schemes ...string) (es []*Endpoint) {
+	for _, addr := range i.Addrs {
+		e, err := ParseEndpoint(addr)
+		if err != nil || !hasScheme(schemes, e.Scheme) {
+			continue
+		}
+		es = append(es, e)
+	}
+	return
+}
+
+// FilterScheme returns a copy of info, in which only the valid addrs of schemes are kept,
+// and instances without such addrs are removed. info is returned if schemes is empty.
+func (info *InstanceInfo) FilterScheme(schemes []string) *InstanceInfo {
+	if info == nil || len(schemes) == 0 {
+		return info
+	}
+	ni := *info
+	ni.Instances = make(map[string][]*Instance, len(info.Instances))
+	for zone, is := range info.Instances {
+		nis := make([]*Instance, 0, len(is))
+		for _, i := range is {
+			var addrs []string
+			for _, addr := range i.Addrs {
+				if e, err := ParseEndpoint(addr); err == nil && hasScheme(schemes, e.Scheme) {
+					addrs = append(addrs, addr)
+				}
+			}
+			if len(addrs) == 0 {
+				continue
+			}
+			n := *i
+			n.Addrs = addrs
+			nis = append(nis, &n)
+		}
+		if len(nis) != 0 {
+			ni.Instances[zone] = nis
+		}
+	}
+	return &ni
+}
+
+func hasScheme(schemes []string, scheme string) bool {
+	if len(schemes) == 0 {
+		return true
+	}
+	for _, s := range schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
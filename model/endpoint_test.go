@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	Convey("test parse endpoint", t, func() {
+		for _, c := range []struct {
+			addr string
+			ok   bool
+			want string
+		}{
+			{"grpc://10.0.0.1:9000", true, "grpc://10.0.0.1:9000"},
+			{"grpc://10.0.0.1:9000?weight=20&tls=true", true, "grpc://10.0.0.1:9000?tls=true&weight=20"},
+			{"http://10.0.0.1", true, "http://10.0.0.1:80"},
+			{"https://host.local", true, "https://host.local:443"},
+			{"grpc://[::1]:9000", true, "grpc://[::1]:9000"},
+			{"grpc://10.0.0.1", false, ""},
+			{"10.0.0.1:9000", false, ""},
+			{"//10.0.0.1:9000", false, ""},
+			{"grpc://:9000", false, ""},
+			{"grpc://10.0.0.1:0", false, ""},
+			{"grpc://10.0.0.1:65536", false, ""},
+			{"grpc://10.0.0.1:port", false, ""},
+			{"grpc://10.0.0.1:9000?weight=%zz", false, ""},
+		} {
+			e, err := ParseEndpoint(c.addr)
+			So(c.addr+" "+boolString(err == nil), ShouldEqual, c.addr+" "+boolString(c.ok))
+			if c.ok {
+				So(e.String(), ShouldEqual, c.want)
+			}
+		}
+		So(ValidateAddrs([]string{"grpc://10.0.0.1:9000", "http://10.0.0.1"}), ShouldBeNil)
+		So(ValidateAddrs([]string{"grpc://10.0.0.1:9000", "10.0.0.1:9000"}), ShouldNotBeNil)
+	})
+}
+
+func TestFilterScheme(t *testing.T) {
+	Convey("test filter addrs by scheme", t, func() {
+		info := &InstanceInfo{Instances: map[string][]*Instance{
+			"sh001": {
+				{Hostname: "h1", Addrs: []string{"http://10.0.0.1:8080", "grpc://10.0.0.1:9000"}},
+				{Hostname: "h2", Addrs: []string{"grpc://10.0.0.2", "http://10.0.0.2"}},
+			},
+			"sh002": {{Hostname: "h3", Addrs: []string{"http://10.0.0.3"}}},
+		}}
+		So(info.FilterScheme(nil), ShouldEqual, info)
+		ni := info.FilterScheme([]string{"grpc"})
+		So(len(ni.Instances), ShouldEqual, 1)
+		// NOTE: invalid addrs are dropped like the endpoints of naming.
+		So(len(ni.Instances["sh001"]), ShouldEqual, 1)
+		So(ni.Instances["sh001"][0].Addrs, ShouldResemble, []string{"grpc://10.0.0.1:9000"})
+		So(info.Instances["sh001"][0].Addrs, ShouldHaveLength, 2)
+		ni = info.FilterScheme([]string{"http"})
+		So(len(ni.Instances["sh001"]), ShouldEqual, 2)
+		So(len(ni.Instances["sh002"]), ShouldEqual, 1)
+	})
+}
+
+func boolString(b bool) string {
+	if b {
+		return "valid"
+	}
+	return "invalid"
+}
@@ -0,0 +1,387 @@
+package model
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eureka instance status.
+const (
+	EurekaUP           = "UP"
+	EurekaOutOfService = "OUT_OF_SERVICE"
+	EurekaUnknown      = "UNKNOWN"
+)
+
+// eureka action type of delta.
+const (
+	EurekaAdded    = "ADDED"
+	EurekaModified = "MODIFIED"
+	EurekaDeleted  = "DELETED"
+)
+
+const (
+	_eurekaDataCenter  = "com.netflix.appinfo.InstanceInfo$DefaultDataCenterInfo"
+	_eurekaMyOwn       = "MyOwn"
+	_eurekaMetaPrefix  = "eureka."
+	_eurekaRenewSecs   = 30
+	_eurekaDurationSec = 90
+)
+
+// EurekaValue is a scalar of eureka, which is a string in java clients and maybe a number or bool in others.
+type EurekaValue string
+
+// UnmarshalJSON accepts json string, number and bool.
+func (v *EurekaValue) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(b, &s); err != nil {
+		s, err = string(b), nil
+	}
+	if s == "null" {
+		s = ""
+	}
+	*v = EurekaValue(s)
+	return
+}
+
+// EurekaPort is the port of eureka instance, like {"$": 8080, "@enabled": "true"}.
+type EurekaPort struct {
+	Port    int         `json:"$" xml:",chardata"`
+	Enabled EurekaValue `json:"@enabled" xml:"enabled,attr"`
+}
+
+// UnmarshalJSON accepts the port in json number and string.
+func (p *EurekaPort) UnmarshalJSON(b []byte) (err error) {
+	var v struct {
+		Port    EurekaValue `json:"$"`
+		Enabled EurekaValue `json:"@enabled"`
+	}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return
+	}
+	p.Enabled = v.Enabled
+	if v.Port != "" {
+		p.Port, err = strconv.Atoi(string(v.Port))
+	}
+	return
+}
+
+func (p *EurekaPort) enabled() (port int, ok bool) {
+	if p == nil || p.Enabled != "true" || p.Port <= 0 {
+		return
+	}
+	return p.Port, true
+}
+
+// EurekaDataCenter is the data center of eureka instance, which is always MyOwn.
+type EurekaDataCenter struct {
+	Class string `json:"@class" xml:"class,attr"`
+	Name  string `json:"name" xml:"name"`
+}
+
+// EurekaLease is the lease of eureka instance, timestamps are in milliseconds.
+type EurekaLease struct {
+	RenewalIntervalInSecs int   `json:"renewalIntervalInSecs" xml:"renewalIntervalInSecs"`
+	DurationInSecs        int   `json:"durationInSecs" xml:"durationInSecs"`
+	RegistrationTimestamp int64 `json:"registrationTimestamp" xml:"registrationTimestamp"`
+	LastRenewalTimestamp  int64 `json:"lastRenewalTimestamp" xml:"lastRenewalTimestamp"`
+	EvictionTimestamp     int64 `json:"evictionTimestamp" xml:"evictionTimestamp"`
+	ServiceUpTimestamp    int64 `json:"serviceUpTimestamp" xml:"serviceUpTimestamp"`
+}
+
+// EurekaMetadata is the metadata of eureka instance, which is a list of elements in xml.
+type EurekaMetadata map[string]string
+
+// MarshalXML encodes metadata as <metadata><key>value</key></metadata>.
+func (m EurekaMetadata) MarshalXML(e *xml.Encoder, start xml.StartElement) (err error) {
+	if err = e.EncodeToken(start); err != nil {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err = e.EncodeElement(m[k], xml.StartElement{Name: xml.Name{Local: k}}); err != nil {
+			return
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// UnmarshalXML decodes metadata from <metadata><key>value</key></metadata>.
+func (m *EurekaMetadata) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
+	*m = make(EurekaMetadata)
+	for {
+		var t xml.Token
+		if t, err = d.Token(); err != nil {
+			return
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			var v string
+			if err = d.DecodeElement(&v, &t); err != nil {
+				return
+			}
+			(*m)[t.Name.Local] = v
+		case xml.EndElement:
+			return
+		}
+	}
+}
+
+// EurekaInstance is the instance of eureka.
+type EurekaInstance struct {
+	XMLName                       xml.Name          `json:"-" xml:"instance"`
+	InstanceID                    string            `json:"instanceId,omitempty" xml:"instanceId,omitempty"`
+	HostName                      string            `json:"hostName" xml:"hostName"`
+	App                           string            `json:"app" xml:"app"`
+	IPAddr                        string            `json:"ipAddr" xml:"ipAddr"`
+	Status                        string            `json:"status" xml:"status"`
+	OverriddenStatus              string            `json:"overriddenStatus,omitempty" xml:"overriddenstatus,omitempty"`
+	Port                          *EurekaPort       `json:"port,omitempty" xml:"port,omitempty"`
+	SecurePort                    *EurekaPort       `json:"securePort,omitempty" xml:"securePort,omitempty"`
+	CountryID                     int               `json:"countryId" xml:"countryId"`
+	DataCenterInfo                *EurekaDataCenter `json:"dataCenterInfo,omitempty" xml:"dataCenterInfo,omitempty"`
+	LeaseInfo                     *EurekaLease      `json:"leaseInfo,omitempty" xml:"leaseInfo,omitempty"`
+	Metadata                      EurekaMetadata    `json:"metadata,omitempty" xml:"metadata,omitempty"`
+	HomePageURL                   string            `json:"homePageUrl,omitempty" xml:"homePageUrl,omitempty"`
+	StatusPageURL                 string            `json:"statusPageUrl,omitempty" xml:"statusPageUrl,omitempty"`
+	HealthCheckURL                string            `json:"healthCheckUrl,omitempty" xml:"healthCheckUrl,omitempty"`
+	VipAddress                    string            `json:"vipAddress,omitempty" xml:"vipAddress,omitempty"`
+	SecureVipAddress              string            `json:"secureVipAddress,omitempty" xml:"secureVipAddress,omitempty"`
+	IsCoordinatingDiscoveryServer EurekaValue       `json:"isCoordinatingDiscoveryServer" xml:"isCoordinatingDiscoveryServer"`
+	LastUpdatedTimestamp          EurekaValue       `json:"lastUpdatedTimestamp" xml:"lastUpdatedTimestamp"`
+	LastDirtyTimestamp            EurekaValue       `json:"lastDirtyTimestamp" xml:"lastDirtyTimestamp"`
+	ActionType                    string            `json:"actionType,omitempty" xml:"actionType,omitempty"`
+}
+
+// EurekaApplication is the application of eureka, named by the upper case of appid.
+type EurekaApplication struct {
+	XMLName   xml.Name          `json:"-" xml:"application"`
+	Name      string            `json:"name" xml:"name"`
+	Instances []*EurekaInstance `json:"instance" xml:"instance"`
+}
+
+// EurekaApplications is the registry of eureka.
+type EurekaApplications struct {
+	XMLName       xml.Name             `json:"-" xml:"applications"`
+	VersionsDelta string               `json:"versions__delta" xml:"versions__delta"`
+	AppsHashcode  string               `json:"apps__hashcode" xml:"apps__hashcode"`
+	Applications  []*EurekaApplication `json:"application" xml:"application"`
+}
+
+// eureka fields kept in metadata, so that eureka clients see what they registered.
+var _eurekaFields = []string{"hostName", "vipAddress", "secureVipAddress", "homePageUrl", "statusPageUrl", "healthCheckUrl"}
+
+func (e *EurekaInstance) fields() []*string {
+	return []*string{&e.HostName, &e.VipAddress, &e.SecureVipAddress, &e.HomePageURL, &e.StatusPageURL, &e.HealthCheckURL}
+}
+
+// EurekaAppID returns the appid of eureka app name, which is the lower case of it.
+func EurekaAppID(app string) string {
+	return strings.ToLower(app)
+}
+
+// EurekaID returns the instance id of eureka instance, the hostname if not given.
+func (e *EurekaInstance) EurekaID() string {
+	if e.InstanceID != "" {
+		return e.InstanceID
+	}
+	return e.HostName
+}
+
+// Instance translates the eureka instance into instance of env and zone, zone is overridden by metadata zone.
+// The eureka instance id is the instance id, so that instances on the same host are distinguished.
+// The addr is http://ipAddr:port if port is enabled, and https://ipAddr:securePort if secure port is enabled.
+func (e *EurekaInstance) Instance(region, zone, env string) (i *Instance) {
+	i = &Instance{
+		Region:     region,
+		Zone:       zone,
+		Env:        env,
+		AppID:      EurekaAppID(e.App),
+		Hostname:   e.HostName,
+		InstanceID: e.EurekaID(),
+		Status:     InstancestatusWating,
+		Metadata:   make(map[string]string, len(e.Metadata)+len(_eurekaFields)),
+	}
+	if i.Hostname == "" {
+		i.Hostname = i.InstanceID
+	}
+	status := e.Status
+	if e.OverriddenStatus != "" && e.OverriddenStatus != EurekaUnknown {
+		status = e.OverriddenStatus
+	}
+	if status == EurekaUP {
+		i.Status = InstanceStatusUP
+	}
+	for k, v := range e.Metadata {
+		// NOTE: jackson writes the class of empty map as "@class".
+		if !strings.HasPrefix(k, "@") {
+			i.Metadata[k] = v
+		}
+	}
+	if z := i.Metadata["zone"]; z != "" {
+		i.Zone = z
+	}
+	i.Version = i.Metadata["version"]
+	for n, f := range e.fields() {
+		if *f != "" {
+			i.Metadata[_eurekaMetaPrefix+_eurekaFields[n]] = *f
+		}
+	}
+	host := e.IPAddr
+	if host == "" {
+		host = e.HostName
+	}
+	if port, ok := e.Port.enabled(); ok {
+		i.Addrs = append(i.Addrs, fmt.Sprintf("http://%s:%d", host, port))
+	}
+	if port, ok := e.SecurePort.enabled(); ok {
+		i.Addrs = append(i.Addrs, fmt.Sprintf("https://%s:%d", host, port))
+	}
+	return
+}
+
+// NewEurekaInstance translates the instance into eureka instance, the port is taken from the http addr
+// or the first addr with port, and the secure port from the https addr.
+func NewEurekaInstance(i *Instance) (e *EurekaInstance) {
+	e = &EurekaInstance{
+		InstanceID:       i.ID(),
+		App:              strings.ToUpper(i.AppID),
+		Status:           EurekaOutOfService,
+		OverriddenStatus: EurekaUnknown,
+		Port:             &EurekaPort{Enabled: "false"},
+		SecurePort:       &EurekaPort{Enabled: "false"},
+		CountryID:        1,
+		DataCenterInfo:   &EurekaDataCenter{Class: _eurekaDataCenter, Name: _eurekaMyOwn},
+		LeaseInfo: &EurekaLease{
+			RenewalIntervalInSecs: _eurekaRenewSecs,
+			DurationInSecs:        _eurekaDurationSec,
+			RegistrationTimestamp: eurekaMillis(i.RegTimestamp),
+			LastRenewalTimestamp:  eurekaMillis(i.RenewTimestamp),
+			ServiceUpTimestamp:    eurekaMillis(i.UpTimestamp),
+		},
+		Metadata:                      EurekaMetadata{"zone": i.Zone},
+		VipAddress:                    i.AppID,
+		SecureVipAddress:              i.AppID,
+		IsCoordinatingDiscoveryServer: "false",
+		LastUpdatedTimestamp:          EurekaValue(strconv.FormatInt(eurekaMillis(i.LatestTimestamp), 10)),
+		LastDirtyTimestamp:            EurekaValue(strconv.FormatInt(eurekaMillis(i.DirtyTimestamp), 10)),
+	}
+	if i.Status == InstanceStatusUP {
+		e.Status = EurekaUP
+	}
+	if i.Version != "" {
+		e.Metadata["version"] = i.Version
+	}
+	fields := e.fields()
+	for k, v := range i.Metadata {
+		if !strings.HasPrefix(k, _eurekaMetaPrefix) {
+			e.Metadata[k] = v
+			continue
+		}
+		for n, name := range _eurekaFields {
+			if k == _eurekaMetaPrefix+name {
+				*fields[n] = v
+			}
+		}
+	}
+	for _, ep := range i.Endpoints() {
+		if e.IPAddr == "" || ep.Scheme == "http" {
+			e.IPAddr = ep.Host
+		}
+		switch {
+		case ep.Scheme == "https":
+			e.SecurePort = &EurekaPort{Port: ep.Port, Enabled: "true"}
+		case ep.Scheme == "http" || e.Port.Enabled != "true":
+			e.Port = &EurekaPort{Port: ep.Port, Enabled: "true"}
+		}
+	}
+	if e.HostName == "" {
+		e.HostName = e.IPAddr
+	}
+	return
+}
+
+// NewEurekaApplications translates the instances keyed by appid into eureka applications sorted by name.
+// If since is not zero, only the instances changed after it are included as delta, with the removed instances
+// not registered again as deleted, while the hashcode is always of all instances, with which clients reconcile the delta.
+func NewEurekaApplications(apps map[string][]*Instance, removed []*Instance, since int64) (ea *EurekaApplications) {
+	ea = &EurekaApplications{
+		VersionsDelta: "1",
+		Applications:  make([]*EurekaApplication, 0, len(apps)),
+	}
+	counts := make(map[string]int)
+	eapps := make(map[string]*EurekaApplication)
+	for appid, is := range apps {
+		app := &EurekaApplication{Name: strings.ToUpper(appid)}
+		for _, i := range is {
+			e := NewEurekaInstance(i)
+			counts[e.Status]++
+			if since != 0 && i.LatestTimestamp <= since {
+				continue
+			}
+			e.ActionType = EurekaAdded
+			if since != 0 && i.RegTimestamp <= since {
+				e.ActionType = EurekaModified
+			}
+			app.Instances = append(app.Instances, e)
+		}
+		eapps[appid] = app
+	}
+	if since != 0 {
+		seen := make(map[string]bool, len(removed))
+		for _, i := range removed {
+			// NOTE: an instance removed more than once is deleted once.
+			key := i.AppID + "/" + i.ID()
+			if seen[key] || hasInstance(apps[i.AppID], i.ID()) {
+				continue
+			}
+			seen[key] = true
+			app, ok := eapps[i.AppID]
+			if !ok {
+				app = &EurekaApplication{Name: strings.ToUpper(i.AppID)}
+				eapps[i.AppID] = app
+			}
+			e := NewEurekaInstance(i)
+			e.ActionType = EurekaDeleted
+			app.Instances = append(app.Instances, e)
+		}
+	}
+	for _, app := range eapps {
+		if len(app.Instances) != 0 {
+			sort.Slice(app.Instances, func(i, j int) bool { return app.Instances[i].InstanceID < app.Instances[j].InstanceID })
+			ea.Applications = append(ea.Applications, app)
+		}
+	}
+	sort.Slice(ea.Applications, func(i, j int) bool { return ea.Applications[i].Name < ea.Applications[j].Name })
+	status := make([]string, 0, len(counts))
+	for s := range counts {
+		status = append(status, s)
+	}
+	sort.Strings(status)
+	for _, s := range status {
+		ea.AppsHashcode += fmt.Sprintf("%s_%d_", s, counts[s])
+	}
+	return
+}
+
+func hasInstance(is []*Instance, id string) bool {
+	for _, i := range is {
+		if i.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// eurekaMillis converts the nanoseconds of instance timestamps into milliseconds of eureka.
+func eurekaMillis(ns int64) int64 {
+	return ns / int64(time.Millisecond)
+}
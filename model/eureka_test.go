@@ -0,0 +1,126 @@
+package model
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var _eurekaXML = `<instance>
+  <instanceId>host1:provider:8080</instanceId>
+  <hostName>host1</hostName>
+  <app>PROVIDER</app>
+  <ipAddr>10.0.0.1</ipAddr>
+  <status>UP</status>
+  <overriddenstatus>UNKNOWN</overriddenstatus>
+  <port enabled="true">8080</port>
+  <securePort enabled="false">443</securePort>
+  <countryId>1</countryId>
+  <dataCenterInfo class="com.netflix.appinfo.InstanceInfo$DefaultDataCenterInfo"><name>MyOwn</name></dataCenterInfo>
+  <metadata><zone>sh002</zone><version>1.0</version></metadata>
+  <vipAddress>provider</vipAddress>
+  <isCoordinatingDiscoveryServer>false</isCoordinatingDiscoveryServer>
+  <lastUpdatedTimestamp>1525336400123</lastUpdatedTimestamp>
+  <lastDirtyTimestamp>1525336400123</lastDirtyTimestamp>
+</instance>`
+
+var _eurekaJSON = `{"instance":{"instanceId":"host1:provider:8080","hostName":"host1","app":"PROVIDER","ipAddr":"10.0.0.1",
+"status":"STARTING","overriddenStatus":"UNKNOWN","port":{"$":"8080","@enabled":"true"},"securePort":{"$":443,"@enabled":true},
+"countryId":1,"dataCenterInfo":{"@class":"com.netflix.appinfo.InstanceInfo$DefaultDataCenterInfo","name":"MyOwn"},
+"metadata":{"@class":"java.util.Collections$EmptyMap","version":"1.0"},"vipAddress":"provider",
+"isCoordinatingDiscoveryServer":false,"lastUpdatedTimestamp":1525336400123,"lastDirtyTimestamp":null}}`
+
+func TestEurekaXML(t *testing.T) {
+	Convey("test eureka instance round trip in xml", t, func() {
+		e := new(EurekaInstance)
+		So(xml.Unmarshal([]byte(_eurekaXML), e), ShouldBeNil)
+		i := e.Instance("sh", "sh001", "prod")
+		So(i.AppID, ShouldEqual, "provider")
+		So(i.ID(), ShouldEqual, "host1:provider:8080")
+		So(i.Zone, ShouldEqual, "sh002")
+		So(i.Version, ShouldEqual, "1.0")
+		So(i.Status, ShouldEqual, InstanceStatusUP)
+		So(i.Addrs, ShouldResemble, []string{"http://10.0.0.1:8080"})
+		So(i.Metadata[_eurekaMetaPrefix+"vipAddress"], ShouldEqual, "provider")
+		bs, err := xml.Marshal(NewEurekaInstance(i))
+		So(err, ShouldBeNil)
+		ne := new(EurekaInstance)
+		So(xml.Unmarshal(bs, ne), ShouldBeNil)
+		So(ne.InstanceID, ShouldEqual, e.InstanceID)
+		So(ne.HostName, ShouldEqual, e.HostName)
+		So(ne.App, ShouldEqual, e.App)
+		So(ne.IPAddr, ShouldEqual, e.IPAddr)
+		So(ne.Status, ShouldEqual, EurekaUP)
+		So(*ne.Port, ShouldResemble, EurekaPort{Port: 8080, Enabled: "true"})
+		So(ne.SecurePort.Enabled, ShouldEqual, "false")
+		So(ne.Metadata, ShouldResemble, EurekaMetadata{"zone": "sh002", "version": "1.0"})
+		So(ne.VipAddress, ShouldEqual, "provider")
+		ni := ne.Instance("sh", "sh001", "prod")
+		So(ni.ID(), ShouldEqual, i.ID())
+		So(ni.Zone, ShouldEqual, i.Zone)
+		So(ni.Status, ShouldEqual, i.Status)
+		So(ni.Addrs, ShouldResemble, i.Addrs)
+		So(ni.Metadata[_eurekaMetaPrefix+"secureVipAddress"], ShouldEqual, "provider")
+	})
+}
+
+func TestEurekaJSON(t *testing.T) {
+	Convey("test eureka instance round trip in json", t, func() {
+		e := new(EurekaInstance)
+		So(json.Unmarshal([]byte(_eurekaJSON), &struct {
+			Instance *EurekaInstance `json:"instance"`
+		}{e}), ShouldBeNil)
+		So(e.SecurePort.Enabled, ShouldEqual, "true")
+		So(e.LastDirtyTimestamp, ShouldEqual, "")
+		i := e.Instance("sh", "sh001", "prod")
+		So(i.Zone, ShouldEqual, "sh001")
+		So(i.Status, ShouldEqual, InstancestatusWating)
+		So(i.Addrs, ShouldResemble, []string{"http://10.0.0.1:8080", "https://10.0.0.1:443"})
+		So(i.Metadata, ShouldNotContainKey, "@class")
+		bs, err := json.Marshal(NewEurekaInstance(i))
+		So(err, ShouldBeNil)
+		ne := new(EurekaInstance)
+		So(json.Unmarshal(bs, ne), ShouldBeNil)
+		So(ne.Status, ShouldEqual, EurekaOutOfService)
+		So(*ne.SecurePort, ShouldResemble, EurekaPort{Port: 443, Enabled: "true"})
+		So(ne.Metadata, ShouldResemble, EurekaMetadata{"zone": "sh001", "version": "1.0"})
+		ni := ne.Instance("sh", "sh001", "prod")
+		So(ni.ID(), ShouldEqual, i.ID())
+		So(ni.Status, ShouldEqual, i.Status)
+		So(ni.Addrs, ShouldResemble, i.Addrs)
+		So(ni.Version, ShouldEqual, i.Version)
+		So(ni.Metadata["zone"], ShouldEqual, "sh001")
+	})
+}
+
+func TestEurekaDelta(t *testing.T) {
+	Convey("test eureka delta of applications", t, func() {
+		up := &Instance{AppID: "provider", InstanceID: "up", Status: InstanceStatusUP, RegTimestamp: 1, LatestTimestamp: 1}
+		added := &Instance{AppID: "provider", InstanceID: "added", Status: InstanceStatusUP, RegTimestamp: 20, LatestTimestamp: 20}
+		modified := &Instance{AppID: "provider", InstanceID: "modified", Status: InstancestatusWating, RegTimestamp: 1, LatestTimestamp: 20}
+		apps := map[string][]*Instance{"provider": {up, added, modified}}
+		removed := []*Instance{
+			{AppID: "provider", InstanceID: "added", LatestTimestamp: 15},
+			{AppID: "consumer", InstanceID: "gone", LatestTimestamp: 15},
+			{AppID: "consumer", InstanceID: "gone", LatestTimestamp: 18},
+		}
+		ea := NewEurekaApplications(apps, removed, 10)
+		So(ea.AppsHashcode, ShouldEqual, "OUT_OF_SERVICE_1_UP_2_")
+		So(len(ea.Applications), ShouldEqual, 2)
+		So(ea.Applications[0].Name, ShouldEqual, "CONSUMER")
+		So(len(ea.Applications[0].Instances), ShouldEqual, 1)
+		So(ea.Applications[0].Instances[0].ActionType, ShouldEqual, EurekaDeleted)
+		So(ea.Applications[1].Name, ShouldEqual, "PROVIDER")
+		actions := make(map[string]string)
+		for _, e := range ea.Applications[1].Instances {
+			actions[e.InstanceID] = e.ActionType
+		}
+		So(actions, ShouldResemble, map[string]string{"added": EurekaAdded, "modified": EurekaModified})
+		ea = NewEurekaApplications(apps, removed, 0)
+		So(len(ea.Applications), ShouldEqual, 1)
+		So(len(ea.Applications[0].Instances), ShouldEqual, 3)
+		So(ea.Applications[0].Instances[0].ActionType, ShouldEqual, EurekaAdded)
+	})
+}
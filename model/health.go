@@ -0,0 +1,25 @@
+package model
+
+// health status.
+const (
+	// HealthUP node is ready to serve reads
+	HealthUP = "UP"
+	// HealthDown node rejects reads, see Health for the reason
+	HealthDown = "DOWN"
+)
+
+// Health is the health of discovery node for load balancer and orchestrator probes.
+type Health struct {
+	Status string `json:"status"`
+	// Synced whether syncup from peers succeeded, or there is no peer.
+	Synced bool `json:"synced"`
+	// Protected whether in init protect mode, in which only write is supported.
+	Protected bool `json:"protected"`
+	// SelfPreservation whether eviction is stopped because renews are less than expected.
+	SelfPreservation bool `json:"self_preservation"`
+	// Peers, PeersUP, Apps and Instances are omitted by liveness.
+	Peers     []*Node `json:"peers,omitempty"`
+	PeersUP   int     `json:"peers_up,omitempty"`
+	Apps      int     `json:"apps,omitempty"`
+	Instances int     `json:"instances,omitempty"`
+}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -53,6 +55,9 @@ type Instance struct {
 	Version  string            `json:"version"`
 	Metadata map[string]string `json:"metadata"`
 
+	// InstanceID distinguishes the instances on the same hostname, which is the hostname by default.
+	InstanceID string `json:"instance_id"`
+
 	// Status enum instance status
 	Status uint32 `json:"status"`
 
@@ -63,6 +68,53 @@ type Instance struct {
 	DirtyTimestamp int64 `json:"dirty_timestamp"`
 
 	LatestTimestamp int64 `json:"latest_timestamp"`
+
+	// StatusTimestamp and MetadataTimestamp are the timestamps of the last set of status and metadata,
+	// which resolve concurrent sets field by field. The dirty timestamp is taken if zero.
+	StatusTimestamp   int64 `json:"status_timestamp,omitempty"`
+	MetadataTimestamp int64 `json:"metadata_timestamp,omitempty"`
+
+	// Registered is the status and metadata before overrides of operator, nil if not overridden.
+	// It is carried by syncup and replication, so that the node cleared restores them.
+	Registered *Registered `json:"registered,omitempty"`
+}
+
+// Registered is the status and metadata registered by an instance.
+type Registered struct {
+	Status   uint32            `json:"status"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// keepRegistered keeps the current status and metadata as the registered ones, unless kept already.
+func (i *Instance) keepRegistered() {
+	if i.Registered != nil {
+		return
+	}
+	md := make(map[string]string, len(i.Metadata))
+	for k, v := range i.Metadata {
+		md[k] = v
+	}
+	i.Registered = &Registered{Status: i.Status, Metadata: md}
+}
+
+// Origin returns the status and metadata registered before overrides of operator.
+func (i *Instance) Origin() (status uint32, metadata map[string]string) {
+	if i.Registered == nil {
+		return i.Status, i.Metadata
+	}
+	return i.Registered.Status, i.Registered.Metadata
+}
+
+// ID returns the instance id, the hostname if empty.
+func (i *Instance) ID() string {
+	return instanceID(i.InstanceID, i.Hostname)
+}
+
+func instanceID(id, hostname string) string {
+	if id != "" {
+		return id
+	}
+	return hostname
 }
 
 // NewInstance new a instance.
@@ -74,6 +126,7 @@ func NewInstance(arg *ArgRegister) (i *Instance) {
 		Env:             arg.Env,
 		AppID:           arg.AppID,
 		Hostname:        arg.Hostname,
+		InstanceID:      instanceID(arg.InstanceID, arg.Hostname),
 		Addrs:           arg.Addrs,
 		Version:         arg.Version,
 		Status:          arg.Status,
@@ -82,15 +135,109 @@ func NewInstance(arg *ArgRegister) (i *Instance) {
 		LatestTimestamp: now,
 		RenewTimestamp:  now,
 		DirtyTimestamp:  now,
+
+		StatusTimestamp:   arg.StatusTimestamp,
+		MetadataTimestamp: arg.MetadataTimestamp,
 	}
 	if arg.Metadata != "" {
-		if err := json.Unmarshal([]byte(arg.Metadata), &i.Metadata); err != nil {
+		var err error
+		if i.Metadata, err = ParseMetadata(arg.Metadata); err != nil {
 			log.Error("json unmarshal metadata err %v", err)
 		}
 	}
 	return
 }
 
+// compareStatus compares status s set at ts with the status of i, it is positive if s wins.
+// NOTE: the larger status wins on the same timestamp, so that replicas converge whatever the order of sets.
+func (i *Instance) compareStatus(ts int64, s uint32) int {
+	its := i.StatusTimestamp
+	if its == 0 {
+		its = i.DirtyTimestamp
+	}
+	switch {
+	case ts != its:
+		return compareInt64(ts, its)
+	case s > i.Status:
+		return 1
+	case s < i.Status:
+		return -1
+	}
+	return 0
+}
+
+// compareMetadata compares metadata md set at ts with the metadata of i, it is positive if md wins.
+// NOTE: the larger metadata in json wins on the same timestamp, so that replicas converge whatever the order of sets.
+func (i *Instance) compareMetadata(ts int64, md map[string]string) int {
+	its := i.MetadataTimestamp
+	if its == 0 {
+		its = i.DirtyTimestamp
+	}
+	if ts != its {
+		return compareInt64(ts, its)
+	}
+	return strings.Compare(metadataJSON(md), metadataJSON(i.Metadata))
+}
+
+// merge takes the status and metadata of o which win over the ones of i, it returns whether any of them is taken.
+func (i *Instance) merge(o *Instance) (ok bool) {
+	i.pinTimestamps()
+	ts := o.StatusTimestamp
+	if ts == 0 {
+		ts = o.DirtyTimestamp
+	}
+	if i.compareStatus(ts, o.Status) > 0 {
+		i.Status, i.StatusTimestamp = o.Status, ts
+		if i.Status == InstanceStatusUP {
+			i.UpTimestamp = o.UpTimestamp
+		}
+		ok = true
+	}
+	if ts = o.MetadataTimestamp; ts == 0 {
+		ts = o.DirtyTimestamp
+	}
+	if i.compareMetadata(ts, o.Metadata) > 0 {
+		i.Metadata = make(map[string]string, len(o.Metadata))
+		for k, v := range o.Metadata {
+			i.Metadata[k] = v
+		}
+		i.MetadataTimestamp = ts
+		ok = true
+	}
+	if ok && o.DirtyTimestamp > i.DirtyTimestamp {
+		i.DirtyTimestamp = o.DirtyTimestamp
+	}
+	return
+}
+
+// pinTimestamps fills the zero timestamps of status and metadata with the dirty timestamp, before it changes.
+func (i *Instance) pinTimestamps() {
+	if i.StatusTimestamp == 0 {
+		i.StatusTimestamp = i.DirtyTimestamp
+	}
+	if i.MetadataTimestamp == 0 {
+		i.MetadataTimestamp = i.DirtyTimestamp
+	}
+}
+
+func compareInt64(a, b int64) int {
+	if a > b {
+		return 1
+	}
+	if a < b {
+		return -1
+	}
+	return 0
+}
+
+func metadataJSON(md map[string]string) string {
+	if len(md) == 0 {
+		return "{}"
+	}
+	bs, _ := json.Marshal(md)
+	return string(bs)
+}
+
 // deep copy a new instance from old one
 func copyInstance(oi *Instance) (ni *Instance) {
 	ni = new(Instance)
@@ -111,6 +258,8 @@ type InstanceInfo struct {
 	Instances       map[string][]*Instance `json:"instances"`
 	Scheduler       *Scheduler             `json:"scheduler,omitempty"`
 	LatestTimestamp int64                  `json:"latest_timestamp"`
+	// Stale instances may be incomplete, served by a node in protect mode.
+	Stale bool `json:"stale,omitempty"`
 }
 
 // Apps app distinguished by zone
@@ -207,6 +356,14 @@ func (p *Apps) InstanceInfo(zone string, latestTime int64, status uint32) (ci *I
 	return
 }
 
+// LatestTimestamp returns the latest timestamp of apps.
+func (p *Apps) LatestTimestamp() (lts int64) {
+	p.lock.RLock()
+	lts = p.latestTimestamp
+	p.lock.RUnlock()
+	return
+}
+
 // UpdateLatest update LatestTimestamp.
 func (p *Apps) UpdateLatest(latestTime int64) {
 	p.lock.Lock()
@@ -218,7 +375,7 @@ func (p *Apps) UpdateLatest(latestTime int64) {
 	p.lock.Unlock()
 }
 
-// App Instances distinguished by hostname
+// App Instances distinguished by instance id
 type App struct {
 	AppID           string
 	Zone            string
@@ -253,34 +410,48 @@ func (a *App) Instances() (is []*Instance) {
 
 // NewInstance new a instance.
 func (a *App) NewInstance(ni *Instance, latestTime int64) (i *Instance, ok bool) {
-	i = new(Instance)
 	a.lock.Lock()
-	oi, ok := a.instances[ni.Hostname]
+	oi, ok := a.instances[ni.ID()]
 	if ok {
 		ni.UpTimestamp = oi.UpTimestamp
 		if ni.DirtyTimestamp < oi.DirtyTimestamp {
 			log.Warn("register exist(%v) dirty timestamp over than caller(%v)", oi, ni)
+			oi.merge(ni)
 			ni = oi
+		} else {
+			// NOTE: keep the status and metadata set after the registration of caller.
+			ni.merge(oi)
 		}
 	}
-	a.instances[ni.Hostname] = ni
+	a.instances[ni.ID()] = ni
 	a.updateLatest(latestTime)
-	*i = *ni
+	i = copyInstance(ni)
 	a.lock.Unlock()
 	ok = !ok
 	return
 }
 
+// Instance returns a copy of the instance of id.
+func (a *App) Instance(id string) (i *Instance, ok bool) {
+	a.lock.RLock()
+	oi, ok := a.instances[id]
+	if ok {
+		i = copyInstance(oi)
+	}
+	a.lock.RUnlock()
+	return
+}
+
 // Renew new a instance.
-func (a *App) Renew(hostname string) (i *Instance, ok bool) {
+func (a *App) Renew(id string, renewTime int64) (i *Instance, ok bool) {
 	i = new(Instance)
 	a.lock.Lock()
 	defer a.lock.Unlock()
-	oi, ok := a.instances[hostname]
+	oi, ok := a.instances[id]
 	if !ok {
 		return
 	}
-	oi.RenewTimestamp = time.Now().UnixNano()
+	oi.RenewTimestamp = renewTime
 	i = copyInstance(oi)
 	return
 }
@@ -294,15 +465,15 @@ func (a *App) updateLatest(latestTime int64) {
 }
 
 // Cancel cancel a instance.
-func (a *App) Cancel(hostname string, latestTime int64) (i *Instance, l int, ok bool) {
+func (a *App) Cancel(id string, latestTime int64) (i *Instance, l int, ok bool) {
 	i = new(Instance)
 	a.lock.Lock()
 	defer a.lock.Unlock()
-	oi, ok := a.instances[hostname]
+	oi, ok := a.instances[id]
 	if !ok {
 		return
 	}
-	delete(a.instances, hostname)
+	delete(a.instances, id)
 	l = len(a.instances)
 	oi.LatestTimestamp = latestTime
 	a.updateLatest(latestTime)
@@ -318,40 +489,155 @@ func (a *App) Len() (l int) {
 	return
 }
 
-// Set set new status,metadata,color  of instance .
-func (a *App) Set(changes *ArgSet) (ok bool) {
+// Set set new status,metadata,color of instance.
+// Status and metadata are last-writer-wins field by field: a field set before the current one is stale.
+// Sets of clients are applied all or nothing, ecode.Conflict is returned with the current instances if any
+// field is stale. Replications apply the fields which are not stale, and return ecode.Conflict with the
+// instances of the stale ones, which the node set resolves by Resolve. The metadata set by clients are
+// stored as ResultMetadata of changes, so that replicas take the same metadata whatever the order of sets.
+func (a *App) Set(changes *ArgSet, limit *MetadataLimit) (conflicts []*Instance, err error) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 	var (
-		dst     *Instance
-		setTime = changes.SetTimestamp
+		setTime  = changes.SetTimestamp
+		ids      = changes.IDs()
+		status   = make([]uint32, len(ids))
+		metadata = make([]map[string]string, len(ids))
+		stale    = make([]bool, len(ids))
+		lim      = limit
 	)
-	for i, hostname := range changes.Hostname {
-		if dst, ok = a.instances[hostname]; !ok {
-			log.Error("SetWeight hostname(%s) not found", hostname)
+	if changes.Replication {
+		// NOTE: the size of replications is limited by the node set, reserved keys are checked anyway.
+		lim = nil
+	}
+	for i, id := range ids {
+		dst, ok := a.instances[id]
+		if !ok {
+			log.Error("SetWeight instance(%s) not found", id)
+			err = ecode.NothingFound
 			return
 		}
-		if len(changes.Status) != 0 {
+		// NOTE: zero status and empty metadata keep the host unchanged.
+		if len(changes.Status) != 0 && changes.Status[i] != 0 {
 			if uint32(changes.Status[i]) != InstanceStatusUP && uint32(changes.Status[i]) != InstancestatusWating {
 				log.Error("SetWeight change status(%d) is error", changes.Status[i])
-				ok = false
+				err = ecode.Error(ecode.RequestErr, fmt.Sprintf("instance(%s) status(%d) must be 1 or 2", id, changes.Status[i]))
+				return
+			}
+			status[i] = uint32(changes.Status[i])
+		}
+		if len(changes.Metadata) != 0 && changes.Metadata[i] != "" {
+			op, patch := changes.MetadataOp, changes.Metadata[i]
+			if changes.Replication && len(changes.ResultMetadata) == len(ids) && changes.ResultMetadata[i] != "" {
+				op, patch = MetadataReplace, changes.ResultMetadata[i]
+			}
+			if metadata[i], err = PatchMetadata(dst.Metadata, op, patch); err == nil {
+				err = lim.Validate(metadata[i])
+			}
+			if err != nil {
+				log.Error("set change metadata(%s) instance(%s) error(%v)", changes.Metadata[i], id, err)
+				err = ecode.Error(ecode.RequestErr, fmt.Sprintf("instance(%s) %v", id, err))
 				return
 			}
-			dst.Status = uint32(changes.Status[i])
+		}
+		if status[i] != 0 && dst.compareStatus(setTime, status[i]) < 0 || metadata[i] != nil && dst.compareMetadata(setTime, metadata[i]) < 0 {
+			log.Warn("set instance(%s) set timestamp(%d) older than status timestamp(%d) or metadata timestamp(%d)", id, setTime, dst.StatusTimestamp, dst.MetadataTimestamp)
+			stale[i] = true
+			if !changes.Replication {
+				conflicts = append(conflicts, copyInstance(dst))
+			}
+		}
+	}
+	if len(conflicts) != 0 {
+		err = ecode.Conflict
+		return
+	}
+	if !changes.Replication && len(changes.Metadata) != 0 {
+		changes.ResultMetadata = make([]string, len(ids))
+	}
+	for i, id := range ids {
+		dst := a.instances[id]
+		dst.pinTimestamps()
+		if changes.Override {
+			dst.keepRegistered()
+		}
+		var changed bool
+		if status[i] != 0 && dst.compareStatus(setTime, status[i]) > 0 {
+			dst.Status, dst.StatusTimestamp = status[i], setTime
 			if dst.Status == InstanceStatusUP {
 				dst.UpTimestamp = setTime
 			}
+			changed = true
 		}
-		if len(changes.Metadata) != 0 {
-			if err := json.Unmarshal([]byte(changes.Metadata[i]), &dst.Metadata); err != nil {
-				log.Error("set change metadata err %s", changes.Metadata[i])
-				ok = false
-				return
+		if metadata[i] != nil && dst.compareMetadata(setTime, metadata[i]) > 0 {
+			dst.Metadata, dst.MetadataTimestamp = metadata[i], setTime
+			changed = true
+		}
+		if metadata[i] != nil && !changes.Replication {
+			changes.ResultMetadata[i] = metadataJSON(dst.Metadata)
+		}
+		if changed {
+			dst.LatestTimestamp = setTime
+			if setTime > dst.DirtyTimestamp {
+				dst.DirtyTimestamp = setTime
 			}
 		}
-		dst.LatestTimestamp = setTime
-		dst.DirtyTimestamp = setTime
+		if stale[i] {
+			conflicts = append(conflicts, copyInstance(dst))
+		}
 	}
 	a.updateLatest(setTime)
+	if len(conflicts) != 0 {
+		err = ecode.Conflict
+	}
+	return
+}
+
+// Resolve takes the status and metadata of i which win over the ones of the same instance, e.g. the conflicts
+// returned by peers. It returns whether any of them is taken.
+func (a *App) Resolve(i *Instance, latestTime int64) (ok bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	dst, exist := a.instances[i.ID()]
+	if !exist {
+		return
+	}
+	if ok = dst.merge(i); ok {
+		dst.LatestTimestamp = latestTime
+		a.updateLatest(latestTime)
+	}
+	return
+}
+
+// Restore restores the status and metadata registered by instance id when its override is cleared at ts,
+// unless they are set after ts. It returns whether any of them is restored.
+func (a *App) Restore(id string, ts int64) (ok bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	dst, exist := a.instances[id]
+	if !exist || dst.Registered == nil {
+		return
+	}
+	rg := dst.Registered
+	dst.Registered = nil
+	dst.pinTimestamps()
+	if dst.compareStatus(ts, rg.Status) > 0 {
+		dst.Status, dst.StatusTimestamp = rg.Status, ts
+		if dst.Status == InstanceStatusUP {
+			dst.UpTimestamp = ts
+		}
+		ok = true
+	}
+	if dst.compareMetadata(ts, rg.Metadata) > 0 {
+		dst.Metadata, dst.MetadataTimestamp = rg.Metadata, ts
+		ok = true
+	}
+	if ok {
+		dst.LatestTimestamp = ts
+		if ts > dst.DirtyTimestamp {
+			dst.DirtyTimestamp = ts
+		}
+		a.updateLatest(ts)
+	}
 	return
 }
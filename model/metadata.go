@@ -0,0 +1,122 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// metadata operations of set.
+const (
+	// MetadataMerge overwrites the keys given and keeps the others, the default operation.
+	MetadataMerge = "merge"
+	// MetadataReplace replaces the whole metadata.
+	MetadataReplace = "replace"
+	// MetadataDelete deletes the keys given as a json array.
+	MetadataDelete = "delete"
+)
+
+// reserved metadata keys, which are used by clients to balance.
+const (
+	MetaWeight  = "weight"
+	MetaColor   = "color"
+	MetaCluster = "cluster"
+	MetaZone    = "zone"
+)
+
+var _metaName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// MetadataLimit limits the metadata of an instance, no limit if zero.
+type MetadataLimit struct {
+	// Keys is the max number of keys.
+	Keys int
+	// Size is the max total length of keys and values.
+	Size int
+}
+
+// ParseMetadata parses metadata in json, numbers and bools are taken as their literals.
+func ParseMetadata(s string) (md map[string]string, err error) {
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("metadata must be a json object: %v", err)
+	}
+	md = make(map[string]string, len(raw))
+	for k, v := range raw {
+		var str string
+		if err = json.Unmarshal(v, &str); err == nil {
+			md[k] = str
+			continue
+		}
+		var val interface{}
+		if err = json.Unmarshal(v, &val); err != nil {
+			return
+		}
+		switch val.(type) {
+		case float64, bool:
+			md[k] = string(v)
+		default:
+			return nil, fmt.Errorf("metadata key(%s) must be a string", k)
+		}
+	}
+	return md, nil
+}
+
+// PatchMetadata returns a new metadata applying patch to old by op, merge if op is empty.
+func PatchMetadata(old map[string]string, op, patch string) (md map[string]string, err error) {
+	md = make(map[string]string, len(old))
+	switch op {
+	case "", MetadataMerge:
+		var add map[string]string
+		if add, err = ParseMetadata(patch); err != nil {
+			return
+		}
+		for k, v := range old {
+			md[k] = v
+		}
+		for k, v := range add {
+			md[k] = v
+		}
+	case MetadataReplace:
+		md, err = ParseMetadata(patch)
+	case MetadataDelete:
+		var keys []string
+		if err = json.Unmarshal([]byte(patch), &keys); err != nil {
+			return nil, fmt.Errorf("metadata keys to delete must be a json array of strings: %v", err)
+		}
+		for k, v := range old {
+			md[k] = v
+		}
+		for _, k := range keys {
+			delete(md, k)
+		}
+	default:
+		err = fmt.Errorf("metadata_op(%s) must be merge, replace or delete", op)
+	}
+	return
+}
+
+// Validate checks the size of md and the values of reserved keys.
+func (l *MetadataLimit) Validate(md map[string]string) (err error) {
+	if l != nil && l.Keys > 0 && len(md) > l.Keys {
+		return fmt.Errorf("metadata has %d keys, more than %d", len(md), l.Keys)
+	}
+	var size int
+	for k, v := range md {
+		size += len(k) + len(v)
+	}
+	if l != nil && l.Size > 0 && size > l.Size {
+		return fmt.Errorf("metadata size %d bytes, more than %d", size, l.Size)
+	}
+	if v, ok := md[MetaWeight]; ok {
+		if w, err := strconv.ParseInt(v, 10, 64); err != nil || w <= 0 {
+			return fmt.Errorf("metadata weight(%s) must be a positive integer", v)
+		}
+	}
+	for _, k := range []string{MetaColor, MetaCluster, MetaZone} {
+		if v := md[k]; v != "" && !_metaName.MatchString(v) {
+			return fmt.Errorf("metadata %s(%s) must be letters, digits, '.', '_' or '-'", k, v)
+		}
+	}
+	return
+}
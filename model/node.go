@@ -19,13 +19,50 @@ const (
 	AppID = "infra.discovery"
 )
 
+// authorization of write operations, see conf.AuthConfig.
+const (
+	// AuthHeader is the http header carrying the token
+	AuthHeader = "Authorization"
+	// AuthBearer is the scheme prefix of the token
+	AuthBearer = "Bearer "
+)
+
 // Node node
 type Node struct {
 	Addr   string     `json:"addr"`
+	Scheme string     `json:"scheme,omitempty"`
 	Status NodeStatus `json:"status"`
 	Zone   string     `json:"zone"`
 }
 
+// member sources.
+const (
+	// MemberSourceConfig member comes from nodes and zones of config
+	MemberSourceConfig = "config"
+	// MemberSourceDiscovered member comes from the self registration of discovery nodes
+	MemberSourceDiscovered = "discovered"
+	// MemberSourceAdmin member is added or removed by admin api
+	MemberSourceAdmin = "admin"
+)
+
+// member states.
+const (
+	// MemberActive member receives replication
+	MemberActive = "active"
+	// MemberRemoved member is removed by admin and ignored even if configured or discovered
+	MemberRemoved = "removed"
+	// MemberDecommissioned member is removed by admin and its self registration is canceled
+	MemberDecommissioned = "decommissioned"
+)
+
+// Member is a peer of discovery cluster and where it comes from.
+type Member struct {
+	Zone   string `json:"zone"`
+	Addr   string `json:"addr"`
+	Source string `json:"source"`
+	State  string `json:"state"`
+}
+
 // Scheduler info.
 type Scheduler struct {
 	AppID   string                   `json:"app_id,omitempty"`
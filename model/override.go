@@ -0,0 +1,116 @@
+package model
+
+import "encoding/json"
+
+// Override is the status and metadata set by operator on an instance, which are applied on top of
+// whatever the instance registers, until cleared.
+type Override struct {
+	AppID    string `json:"appid"`
+	Env      string `json:"env"`
+	Hostname string `json:"hostname"`
+	// Status overrides the status registered if not zero.
+	Status uint32 `json:"status,omitempty"`
+	// Metadata is merged into the metadata registered, after the keys of Deleted are deleted from it,
+	// or replaces it if Replace is true.
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	Deleted         []string          `json:"deleted,omitempty"`
+	Replace         bool              `json:"replace,omitempty"`
+	UpdateTimestamp int64             `json:"update_timestamp"`
+	// InstanceID is the instance overridden, the hostname if empty.
+	InstanceID string `json:"instance_id,omitempty"`
+	// Cleared marks the tombstone of an override cleared at UpdateTimestamp, so that older ones are not taken again.
+	Cleared bool `json:"cleared,omitempty"`
+}
+
+// ID returns the instance id overridden.
+func (o *Override) ID() string {
+	return instanceID(o.InstanceID, o.Hostname)
+}
+
+// Apply applies the override on the status and metadata registered of i, which are kept to be restored on clear.
+func (o *Override) Apply(i *Instance) {
+	i.keepRegistered()
+	i.Status = i.Registered.Status
+	if o.Status != 0 {
+		i.Status = o.Status
+	}
+	md := make(map[string]string, len(i.Registered.Metadata)+len(o.Metadata))
+	if !o.Replace {
+		for k, v := range i.Registered.Metadata {
+			md[k] = v
+		}
+		for _, k := range o.Deleted {
+			delete(md, k)
+		}
+	}
+	for k, v := range o.Metadata {
+		md[k] = v
+	}
+	i.Metadata = md
+}
+
+func copyOverride(o *Override) (no *Override) {
+	no = new(Override)
+	*no = *o
+	no.Metadata = make(map[string]string, len(o.Metadata))
+	for k, v := range o.Metadata {
+		no.Metadata[k] = v
+	}
+	no.Deleted = append([]string(nil), o.Deleted...)
+	return
+}
+
+// Patch returns a copy of o, with status and metadata of the hostname at index n of set.
+// The keys deleted are kept as tombstones, so that they are deleted from the metadata registered too.
+func (o *Override) Patch(arg *ArgSet, n int) (no *Override, err error) {
+	no = copyOverride(o)
+	if len(arg.Status) != 0 && arg.Status[n] != 0 {
+		no.Status = uint32(arg.Status[n])
+	}
+	if len(arg.Metadata) != 0 && arg.Metadata[n] != "" {
+		if no.Metadata, err = PatchMetadata(o.Metadata, arg.MetadataOp, arg.Metadata[n]); err != nil {
+			return nil, err
+		}
+		switch arg.MetadataOp {
+		case MetadataReplace:
+			no.Replace, no.Deleted = true, nil
+		case MetadataDelete:
+			if !no.Replace {
+				var keys []string
+				_ = json.Unmarshal([]byte(arg.Metadata[n]), &keys)
+				no.Deleted = appendKeys(no.Deleted, keys)
+			}
+		default:
+			no.Deleted = removeKeys(no.Deleted, no.Metadata)
+		}
+	}
+	no.UpdateTimestamp, no.Cleared = arg.SetTimestamp, false
+	return
+}
+
+// appendKeys appends the keys not in ks yet.
+func appendKeys(ks, keys []string) []string {
+	for _, k := range keys {
+		var found bool
+		for _, e := range ks {
+			if e == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ks = append(ks, k)
+		}
+	}
+	return ks
+}
+
+// removeKeys removes the keys of md from ks.
+func removeKeys(ks []string, md map[string]string) (nks []string) {
+	for _, k := range ks {
+		if _, ok := md[k]; !ok {
+			nks = append(nks, k)
+		}
+	}
+	return
+}
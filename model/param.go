@@ -15,6 +15,11 @@ type ArgRegister struct {
 	LatestTimestamp int64    `form:"latest_timestamp"`
 	DirtyTimestamp  int64    `form:"dirty_timestamp"`
 	FromZone        bool     `form:"from_zone"`
+	// InstanceID distinguishes the instances on the same hostname, the hostname if empty.
+	InstanceID string `form:"instance_id"`
+	// StatusTimestamp and MetadataTimestamp are carried by replication, see Instance.
+	StatusTimestamp   int64 `form:"status_timestamp"`
+	MetadataTimestamp int64 `form:"metadata_timestamp"`
 }
 
 // ArgRenew define renew params.
@@ -26,6 +31,12 @@ type ArgRenew struct {
 	Replication    bool   `form:"replication"`
 	DirtyTimestamp int64  `form:"dirty_timestamp"`
 	FromZone       bool   `form:"from_zone"`
+	InstanceID     string `form:"instance_id"`
+}
+
+// ID returns the instance id to renew.
+func (arg *ArgRenew) ID() string {
+	return instanceID(arg.InstanceID, arg.Hostname)
 }
 
 // ArgCancel define cancel params.
@@ -37,6 +48,12 @@ type ArgCancel struct {
 	FromZone        bool   `form:"from_zone"`
 	Replication     bool   `form:"replication"`
 	LatestTimestamp int64  `form:"latest_timestamp"`
+	InstanceID      string `form:"instance_id"`
+}
+
+// ID returns the instance id to cancel.
+func (arg *ArgCancel) ID() string {
+	return instanceID(arg.InstanceID, arg.Hostname)
 }
 
 // ArgFetch define fetch param.
@@ -45,6 +62,8 @@ type ArgFetch struct {
 	Env    string `form:"env" validate:"required"`
 	AppID  string `form:"appid" validate:"required"`
 	Status uint32 `form:"status" validate:"required"`
+	// Scheme keeps only the addrs of schemes if not empty.
+	Scheme []string `form:"scheme,split"`
 }
 
 // ArgFetchs define fetchs arg.
@@ -53,6 +72,8 @@ type ArgFetchs struct {
 	Env    string   `form:"env" validate:"required"`
 	AppID  []string `form:"appid" validate:"gt=0"`
 	Status uint32   `form:"status" validate:"required"`
+	// Scheme keeps only the addrs of schemes if not empty.
+	Scheme []string `form:"scheme,split"`
 }
 
 // ArgPoll define poll param.
@@ -62,6 +83,7 @@ type ArgPoll struct {
 	AppID           string `form:"appid" validate:"required"`
 	Hostname        string `form:"hostname" validate:"required"`
 	LatestTimestamp int64  `form:"latest_timestamp"`
+	InstanceID      string `form:"instance_id"`
 }
 
 // ArgPolls define poll param.
@@ -71,6 +93,14 @@ type ArgPolls struct {
 	AppID           []string `form:"appid" validate:"gt=0"`
 	Hostname        string   `form:"hostname" validate:"required"`
 	LatestTimestamp []int64  `form:"latest_timestamp"`
+	InstanceID      string   `form:"instance_id"`
+	// Scheme keeps only the addrs of schemes if not empty.
+	Scheme []string `form:"scheme,split"`
+}
+
+// ID returns the instance id of poller, connections of the same id share a channel.
+func (arg *ArgPolls) ID() string {
+	return instanceID(arg.InstanceID, arg.Hostname)
 }
 
 // ArgSet define set param.
@@ -85,4 +115,71 @@ type ArgSet struct {
 	Replication  bool     `form:"replication"`
 	FromZone     bool     `form:"from_zone"`
 	SetTimestamp int64    `form:"set_timestamp"`
+	// MetadataOp is how metadata is applied: merge by default, replace, or delete the keys in json array.
+	MetadataOp string `form:"metadata_op"`
+	// Override keeps the status and metadata set over the next registrations, until cleared.
+	Override bool `form:"override"`
+	// InstanceID are the instances to set instead of hostnames, with the same length of hostname if both given.
+	InstanceID []string `form:"instance_id"`
+	// ResultMetadata are the metadata of instances after the set, filled by the node set for replication.
+	ResultMetadata []string `form:"result_metadata"`
+}
+
+// IDs returns the ids of instances to set.
+func (arg *ArgSet) IDs() []string {
+	if len(arg.InstanceID) != 0 {
+		return arg.InstanceID
+	}
+	return arg.Hostname
+}
+
+// ArgOverrides define list overrides param, all overrides if empty.
+type ArgOverrides struct {
+	AppID string `form:"appid"`
+	Env   string `form:"env"`
+	// Cleared lists the tombstones of cleared overrides too, for peers to sync.
+	Cleared bool `form:"cleared"`
+}
+
+// ArgClearOverride define clear override param.
+type ArgClearOverride struct {
+	AppID       string `form:"appid" validate:"required"`
+	Env         string `form:"env" validate:"required"`
+	Hostname    string `form:"hostname" validate:"required"`
+	Replication bool   `form:"replication"`
+	FromZone    bool   `form:"from_zone"`
+	InstanceID  string `form:"instance_id"`
+	// ClearTimestamp is when the override is cleared, filled by the node cleared for replication.
+	ClearTimestamp int64 `form:"clear_timestamp"`
+}
+
+// ID returns the instance id of override to clear.
+func (arg *ArgClearOverride) ID() string {
+	return instanceID(arg.InstanceID, arg.Hostname)
+}
+
+// ArgMember define member param.
+type ArgMember struct {
+	Zone        string `form:"zone"`
+	Addr        string `form:"addr" validate:"required"`
+	Replication bool   `form:"replication"`
+	FromZone    bool   `form:"from_zone"`
+}
+
+// ArgChanges define change feed param, negative cursor gets the current cursor.
+type ArgChanges struct {
+	Cursor int64 `form:"cursor" default:"-1"`
+	Ps     int   `form:"ps"`
+}
+
+// ArgSyncApps define sync apps param.
+type ArgSyncApps struct {
+	Cursor string `form:"cursor"`
+	Ps     int    `form:"ps"`
+}
+
+// ArgSyncApp define sync app param.
+type ArgSyncApp struct {
+	Env   string `form:"env" validate:"required"`
+	AppID string `form:"appid" validate:"required"`
 }
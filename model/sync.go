@@ -0,0 +1,44 @@
+package model
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// AppSummary is the summary of an app used to sync registry between nodes.
+type AppSummary struct {
+	AppID    string `json:"appid"`
+	Env      string `json:"env"`
+	Count    int    `json:"count"`
+	Checksum string `json:"checksum"`
+}
+
+// SyncApps is a page of app summaries, Cursor is empty on the last page.
+type SyncApps struct {
+	Apps   []*AppSummary `json:"apps"`
+	Cursor string        `json:"cursor"`
+	Total  int           `json:"total"`
+}
+
+// SyncApp is all instances of an app with their checksum.
+type SyncApp struct {
+	Instances []*Instance `json:"instances"`
+	Checksum  string      `json:"checksum"`
+}
+
+// Checksum returns the checksum of instances, which only depends on the identity
+// and dirty timestamp of instances, so renews do not change it.
+func Checksum(is []*Instance) string {
+	keys := make([]string, 0, len(is))
+	for _, i := range is {
+		keys = append(keys, fmt.Sprintf("%s/%s/%s/%d", i.Zone, i.Env, i.ID(), i.DirtyTimestamp))
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{'\n'})
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
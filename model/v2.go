@@ -0,0 +1,98 @@
+package model
+
+import "encoding/json"
+
+// ArgRegisterV2 define register document of v2 api.
+type ArgRegisterV2 struct {
+	Region   string            `json:"region"`
+	Zone     string            `json:"zone" validate:"required"`
+	Env      string            `json:"env" validate:"required"`
+	AppID    string            `json:"appid" validate:"required"`
+	Hostname string            `json:"hostname" validate:"required"`
+	Status   uint32            `json:"status" validate:"required"`
+	Addrs    []string          `json:"addrs" validate:"gt=0"`
+	Version  string            `json:"version"`
+	Metadata map[string]string `json:"metadata"`
+	// InstanceID distinguishes the instances on the same hostname, the hostname if empty.
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+// ArgInstanceV2 define renew and cancel document of v2 api.
+type ArgInstanceV2 struct {
+	Zone     string `json:"zone" validate:"required"`
+	Env      string `json:"env" validate:"required"`
+	AppID    string `json:"appid" validate:"required"`
+	Hostname string `json:"hostname" validate:"required"`
+	// InstanceID is the instance id registered, the hostname if empty.
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+// ArgSetV2 define set document of v2 api, hosts are changed all or nothing.
+type ArgSetV2 struct {
+	Region string       `json:"region"`
+	Zone   string       `json:"zone" validate:"required"`
+	Env    string       `json:"env" validate:"required"`
+	AppID  string       `json:"appid" validate:"required"`
+	Hosts  []*HostSetV2 `json:"hosts" validate:"gt=0,dive,required"`
+	// MetadataOp is how metadata of hosts is applied: merge by default, replace, or delete the keys.
+	MetadataOp string `json:"metadata_op,omitempty"`
+}
+
+// HostSetV2 is the change of one host, fields not set are unchanged.
+type HostSetV2 struct {
+	Hostname string            `json:"hostname" validate:"required"`
+	Status   uint32            `json:"status,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Keys are the metadata keys to delete.
+	Keys []string `json:"keys,omitempty"`
+	// InstanceID is the instance to change, the hostname if empty.
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+// ErrorV2 is the error object of v2 api.
+type ErrorV2 struct {
+	// Code is the ecode of v1 api.
+	Code int `json:"code"`
+	// Status is the http status of response.
+	Status  int    `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// ArgSet converts to the set param of v1 api, in which zero status and empty metadata keep the host unchanged.
+func (a *ArgSetV2) ArgSet() (arg *ArgSet) {
+	arg = &ArgSet{
+		Region:     a.Region,
+		Zone:       a.Zone,
+		Env:        a.Env,
+		AppID:      a.AppID,
+		MetadataOp: a.MetadataOp,
+	}
+	var status, metadata, id bool
+	for _, h := range a.Hosts {
+		status = status || h.Status != 0
+		metadata = metadata || h.Metadata != nil || h.Keys != nil
+		id = id || h.InstanceID != ""
+	}
+	for _, h := range a.Hosts {
+		arg.Hostname = append(arg.Hostname, h.Hostname)
+		if id {
+			arg.InstanceID = append(arg.InstanceID, instanceID(h.InstanceID, h.Hostname))
+		}
+		if status {
+			arg.Status = append(arg.Status, int64(h.Status))
+		}
+		if metadata {
+			var md string
+			if a.MetadataOp == MetadataDelete && h.Keys != nil {
+				bs, _ := json.Marshal(h.Keys)
+				md = string(bs)
+			} else if a.MetadataOp != MetadataDelete && h.Metadata != nil {
+				bs, _ := json.Marshal(h.Metadata)
+				md = string(bs)
+			}
+			arg.Metadata = append(arg.Metadata, md)
+		}
+	}
+	return
+}
@@ -0,0 +1,45 @@
+package naming
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// cacheFile returns the name of cache file of appid in env.
+func cacheFile(env, appid string) string {
+	return fmt.Sprintf("%s_%s.json", env, url.PathEscape(appid))
+}
+
+// loadCache returns the instances of appid cached in dir, which are marked stale
+// until fresh ones are polled from discovery.
+func loadCache(dir, env, appid string) (info *InstancesInfo, err error) {
+	bs, err := ioutil.ReadFile(filepath.Join(dir, cacheFile(env, appid)))
+	if err != nil {
+		return
+	}
+	info = new(InstancesInfo)
+	if err = json.Unmarshal(bs, info); err != nil {
+		return nil, err
+	}
+	info.Stale = true
+	return
+}
+
+// saveCache replaces the instances of appid cached in dir.
+func saveCache(dir, env, appid string, info *InstancesInfo) (err error) {
+	bs, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	name := filepath.Join(dir, cacheFile(env, appid))
+	// NOTE: write a temp file then rename, so the cache is never read half written.
+	tmp := name + ".tmp"
+	if err = ioutil.WriteFile(tmp, bs, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, name)
+}
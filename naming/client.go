@@ -2,10 +2,15 @@ package naming
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net"
+	xhttp "net/http"
 	"net/url"
 	"os"
 	"strconv"
@@ -20,11 +25,11 @@ import (
 )
 
 const (
-	_registerURL = "http://%s/discovery/register"
-	_setURL      = "http://%s/discovery/set"
-	_cancelURL   = "http://%s/discovery/cancel"
-	_renewURL    = "http://%s/discovery/renew"
-	_pollURL     = "http://%s/discovery/polls"
+	_registerURL = "%s://%s/discovery/register"
+	_setURL      = "%s://%s/discovery/set"
+	_cancelURL   = "%s://%s/discovery/cancel"
+	_renewURL    = "%s://%s/discovery/renew"
+	_pollURL     = "%s://%s/discovery/polls"
 
 	_registerGap = 30 * time.Second
 
@@ -39,6 +44,10 @@ var (
 
 	// ErrDuplication duplication treeid.
 	ErrDuplication = errors.New("discovery: instance duplicate registration")
+
+	errStale = errors.New("discovery: stale instances")
+	// errGoAway the discovery node is shutting down.
+	errGoAway = errors.New("discovery: node go away")
 )
 
 // Config discovery configures.
@@ -48,6 +57,52 @@ type Config struct {
 	Zone   string
 	Env    string
 	Host   string
+	// InstanceID distinguishes the processes on the same Host, such as instances listening on different ports,
+	// Host is used if empty.
+	InstanceID string
+	// TLS if not nil, discovery nodes are called over https.
+	TLS *TLSConfig
+	// Token authorizes register/renew/cancel/set of the appid, a static or signed token
+	// issued by discovery operators.
+	Token string
+	// CacheDir persists the last instances of watched apps, including the discovery nodes,
+	// which are loaded at startup so that services boot while discovery is unreachable.
+	// Nothing is cached if empty.
+	CacheDir string
+}
+
+// TLSConfig tls configures of discovery client.
+type TLSConfig struct {
+	// CAFile is the PEM bundle used to verify discovery nodes, system roots are used if empty.
+	CAFile string
+	// CertFile and KeyFile are the client certificate presented to discovery nodes.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name used to verify discovery node certificates.
+	ServerName string
+}
+
+func (t *TLSConfig) config() (c *tls.Config, err error) {
+	c = &tls.Config{ServerName: t.ServerName}
+	if t.CAFile != "" {
+		var pem []byte
+		if pem, err = ioutil.ReadFile(t.CAFile); err != nil {
+			return
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("discovery: tls caFile(%s) contains no certificate", t.CAFile)
+			return
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			return
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return
 }
 
 type appData struct {
@@ -62,9 +117,10 @@ type Discovery struct {
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 	httpClient *http.Client
+	scheme     string
 
-	node    atomic.Value
-	nodeIdx uint64
+	node   atomic.Value
+	health health
 
 	mutex       sync.RWMutex
 	apps        map[string]*appInfo
@@ -99,6 +155,17 @@ func fixConfig(c *Config) {
 	}
 }
 
+// tokenTransport presents Config.Token to discovery nodes.
+type tokenTransport struct {
+	token string
+	xhttp.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *xhttp.Request) (*xhttp.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.RoundTripper.RoundTrip(req)
+}
+
 // New new a discovery client.
 func New(c *Config) (d *Discovery) {
 	fixConfig(c)
@@ -110,6 +177,7 @@ func New(c *Config) (d *Discovery) {
 		apps:       map[string]*appInfo{},
 		registry:   map[string]struct{}{},
 		delete:     make(chan *appInfo, 10),
+		health:     health{nodes: make(map[string]*Node)},
 	}
 	// httpClient
 	cfg := &http.ClientConfig{
@@ -118,6 +186,32 @@ func New(c *Config) (d *Discovery) {
 		Timeout:   xtime.Duration(40 * time.Second),
 	}
 	d.httpClient = http.NewClient(cfg)
+	d.scheme = "http"
+	if c.TLS != nil || c.Token != "" {
+		dialer := &net.Dialer{
+			Timeout:   time.Duration(cfg.Dial),
+			KeepAlive: time.Duration(cfg.KeepAlive),
+		}
+		transport := &xhttp.Transport{DialContext: dialer.DialContext}
+		if c.TLS != nil {
+			tc, err := c.TLS.config()
+			if err != nil {
+				panic(fmt.Sprintf("discovery tls config error(%v)", err))
+			}
+			transport.TLSClientConfig = tc
+			d.scheme = "https"
+		}
+		var rt xhttp.RoundTripper = transport
+		if c.Token != "" {
+			rt = &tokenTransport{token: c.Token, RoundTripper: transport}
+		}
+		d.httpClient.SetTransport(&http.TraceTransport{RoundTripper: rt})
+	}
+	if c.CacheDir != "" {
+		if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+			log.Error("discovery: create cache dir(%s) error(%v)", c.CacheDir, err)
+		}
+	}
 	// discovery self
 	resolver := d.Build(_appid)
 	event := resolver.Watch()
@@ -146,22 +240,24 @@ func (d *Discovery) selfproc(resolver Resolver, event <-chan struct{}) {
 	}
 }
 
+// newSelf updates the discovery nodes of all zones, nodes in the same zone are preferred by pickNode.
 func (d *Discovery) newSelf(zones map[string][]*Instance) {
-	d.mutex.Lock()
-	ins, ok := zones[d.c.Zone]
-	d.mutex.Unlock()
-	if !ok {
-		return
-	}
-	var nodes []string
-	for _, in := range ins {
-		for _, addr := range in.Addrs {
-			u, err := url.Parse(addr)
-			if err == nil && u.Scheme == "http" {
-				nodes = append(nodes, u.Host)
+	var (
+		nodes  []string
+		nzones = make(map[string]string)
+	)
+	for zone, ins := range zones {
+		for _, in := range ins {
+			for _, e := range in.Endpoints(d.scheme) {
+				nodes = append(nodes, e.Addr())
+				nzones[e.Addr()] = zone
 			}
 		}
 	}
+	if len(nodes) == 0 {
+		return
+	}
+	d.setZones(nzones)
 	// diff old nodes
 	var olds int
 	for _, n := range nodes {
@@ -191,12 +287,21 @@ func (d *Discovery) Build(appid string) Resolver {
 		d:     d,
 		event: make(chan struct{}, 1),
 	}
+	var cached bool
 	d.mutex.Lock()
 	app, ok := d.apps[appid]
 	if !ok {
 		app = &appInfo{
 			resolver: make(map[*Resolve]struct{}),
 		}
+		if d.c.CacheDir != "" {
+			if info, err := loadCache(d.c.CacheDir, d.c.Env, appid); err == nil {
+				app.zoneIns.Store(info)
+				cached = true
+			} else if !os.IsNotExist(err) {
+				log.Error("discovery: load cache of appid(%s) error(%v)", appid, err)
+			}
+		}
 		d.apps[appid] = app
 		cancel := d.cancelPolls
 		if cancel != nil {
@@ -205,13 +310,13 @@ func (d *Discovery) Build(appid string) Resolver {
 	}
 	app.resolver[r] = struct{}{}
 	d.mutex.Unlock()
-	if ok {
+	if ok || cached {
 		select {
 		case r.event <- struct{}{}:
 		default:
 		}
 	}
-	log.Info("discovery: AddWatch(%s) already watch(%v)", appid, ok)
+	log.Info("discovery: AddWatch(%s) already watch(%v) cached(%v)", appid, ok, cached)
 	d.once.Do(func() {
 		go d.serverproc()
 	})
@@ -333,7 +438,8 @@ func (d *Discovery) register(ctx context.Context, ins *Instance) (err error) {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 	})
-	uri := fmt.Sprintf(_registerURL, d.pickNode())
+	host := d.pickNode()
+	uri := fmt.Sprintf(_registerURL, d.scheme, host)
 	params := d.newParams(c)
 	params.Set("appid", ins.AppID)
 	for _, addr := range ins.Addrs {
@@ -342,12 +448,14 @@ func (d *Discovery) register(ctx context.Context, ins *Instance) (err error) {
 	params.Set("version", ins.Version)
 	params.Set("status", _statusUP)
 	params.Set("metadata", string(metadata))
+	start := time.Now()
 	if err = d.httpClient.Post(ctx, uri, "", params, &res); err != nil {
-		d.switchNode()
+		d.failNode(host, err)
 		log.Error("discovery: register client.Get(%v)  zone(%s) env(%s) appid(%s) addrs(%v) error(%v)",
 			uri, c.Zone, c.Env, ins.AppID, ins.Addrs, err)
 		return
 	}
+	d.succeedNode(host, time.Since(start))
 	if ec := ecode.Int(res.Code); !ecode.EqualError(ecode.OK, ec) {
 		log.Warn("discovery: register client.Get(%v)  env(%s) appid(%s) addrs(%v) code(%v)", uri, c.Env, ins.AppID, ins.Addrs, res.Code)
 		err = ec
@@ -367,15 +475,18 @@ func (d *Discovery) renew(ctx context.Context, ins *Instance) (err error) {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 	})
-	uri := fmt.Sprintf(_renewURL, d.pickNode())
+	host := d.pickNode()
+	uri := fmt.Sprintf(_renewURL, d.scheme, host)
 	params := d.newParams(c)
 	params.Set("appid", ins.AppID)
+	start := time.Now()
 	if err = d.httpClient.Post(ctx, uri, "", params, &res); err != nil {
-		d.switchNode()
+		d.failNode(host, err)
 		log.Error("discovery: renew client.Get(%v)  env(%s) appid(%s) hostname(%s) error(%v)",
 			uri, c.Env, ins.AppID, c.Host, err)
 		return
 	}
+	d.succeedNode(host, time.Since(start))
 	if ec := ecode.Int(res.Code); !ecode.EqualError(ecode.OK, ec) {
 		err = ec
 		if ecode.EqualError(ecode.NothingFound, ec) {
@@ -398,16 +509,19 @@ func (d *Discovery) cancel(ins *Instance) (err error) {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 	})
-	uri := fmt.Sprintf(_cancelURL, d.pickNode())
+	host := d.pickNode()
+	uri := fmt.Sprintf(_cancelURL, d.scheme, host)
 	params := d.newParams(c)
 	params.Set("appid", ins.AppID)
 	// request
+	start := time.Now()
 	if err = d.httpClient.Post(context.TODO(), uri, "", params, &res); err != nil {
-		d.switchNode()
+		d.failNode(host, err)
 		log.Error("discovery cancel client.Get(%v) env(%s) appid(%s) hostname(%s) error(%v)",
 			uri, c.Env, ins.AppID, c.Host, err)
 		return
 	}
+	d.succeedNode(host, time.Since(start))
 	if ec := ecode.Int(res.Code); !ecode.EqualError(ecode.OK, ec) {
 		log.Warn("discovery cancel client.Get(%v)  env(%s) appid(%s) hostname(%s) code(%v)",
 			uri, c.Env, ins.AppID, c.Host, res.Code)
@@ -433,7 +547,8 @@ func (d *Discovery) set(ctx context.Context, ins *Instance) (err error) {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 	})
-	uri := fmt.Sprintf(_setURL, d.pickNode())
+	host := d.pickNode()
+	uri := fmt.Sprintf(_setURL, d.scheme, host)
 	params := d.newParams(conf)
 	params.Set("appid", ins.AppID)
 	params.Set("version", ins.Version)
@@ -446,12 +561,14 @@ func (d *Discovery) set(ctx context.Context, ins *Instance) (err error) {
 		}
 		params.Set("metadata", string(metadata))
 	}
+	start := time.Now()
 	if err = d.httpClient.Post(ctx, uri, "", params, &res); err != nil {
-		d.switchNode()
+		d.failNode(host, err)
 		log.Error("discovery: set client.Get(%v)  zone(%s) env(%s) appid(%s) addrs(%v) error(%v)",
 			uri, conf.Zone, conf.Env, ins.AppID, ins.Addrs, err)
 		return
 	}
+	d.succeedNode(host, time.Since(start))
 	if ec := ecode.Int(res.Code); !ecode.EqualError(ecode.OK, ec) {
 		log.Warn("discovery: set client.Get(%v)  env(%s) appid(%s) addrs(%v)  code(%v)",
 			uri, conf.Env, ins.AppID, ins.Addrs, res.Code)
@@ -464,7 +581,6 @@ func (d *Discovery) set(ctx context.Context, ins *Instance) (err error) {
 
 func (d *Discovery) serverproc() {
 	var (
-		retry  int
 		ctx    context.Context
 		cancel context.CancelFunc
 	)
@@ -481,67 +597,32 @@ func (d *Discovery) serverproc() {
 		case <-d.ctx.Done():
 			return
 		case <-ticker.C:
-			d.switchNode()
+			d.rebalanceNode()
 		default:
 		}
 		apps, err := d.polls(ctx)
 		if err != nil {
-			d.switchNode()
+			if err == errStale {
+				d.broadcast(apps)
+			}
 			if ctx.Err() == context.Canceled {
 				ctx = nil
 				continue
 			}
-			nodes, _ := d.node.Load().([]string)
-			if retry >= len(nodes) {
-				d.tryAppendSeedNodes()
-				retry = 0
+			d.failNode(d.lastHost, err)
+			// NOTE: poll other node at once, unless all nodes are backing off.
+			select {
+			case <-time.After(d.retryAfter()):
+			case <-d.ctx.Done():
+				return
 			}
-			time.Sleep(time.Second)
-			retry++
 			continue
 		}
-		retry = 0
+		d.succeedNode(d.lastHost, 0)
 		d.broadcast(apps)
 	}
 }
 
-func (d *Discovery) tryAppendSeedNodes() {
-	nodes, ok := d.node.Load().([]string)
-	if !ok {
-		return
-	}
-	exist := make(map[string]struct{}, len(nodes))
-	for _, node := range nodes {
-		exist[node] = struct{}{}
-	}
-	d.mutex.Lock()
-	seedNodes := d.c.Nodes
-	d.mutex.Unlock()
-	var changed bool
-	for _, node := range seedNodes {
-		if _, ok := exist[node]; !ok {
-			nodes = append(nodes, node)
-			changed = true
-		}
-	}
-	if changed {
-		d.node.Store(nodes)
-		log.Info("discovery: append seed nodes(%s)", nodes)
-	}
-}
-
-func (d *Discovery) pickNode() string {
-	nodes, ok := d.node.Load().([]string)
-	if !ok || len(nodes) == 0 {
-		return d.c.Nodes[rand.Intn(len(d.c.Nodes))]
-	}
-	return nodes[atomic.LoadUint64(&d.nodeIdx)%uint64(len(nodes))]
-}
-
-func (d *Discovery) switchNode() {
-	atomic.AddUint64(&d.nodeIdx, 1)
-}
-
 func (d *Discovery) polls(ctx context.Context) (apps map[string]*InstancesInfo, err error) {
 	var (
 		lastTss []int64
@@ -566,7 +647,7 @@ func (d *Discovery) polls(ctx context.Context) (apps map[string]*InstancesInfo,
 	if len(appIDs) == 0 {
 		return
 	}
-	uri := fmt.Sprintf(_pollURL, host)
+	uri := fmt.Sprintf(_pollURL, d.scheme, host)
 	res := new(struct {
 		Code int                       `json:"code"`
 		Data map[string]*InstancesInfo `json:"data"`
@@ -574,6 +655,9 @@ func (d *Discovery) polls(ctx context.Context) (apps map[string]*InstancesInfo,
 	params := url.Values{}
 	params.Set("env", c.Env)
 	params.Set("hostname", c.Host)
+	if c.InstanceID != "" {
+		params.Set("instance_id", c.InstanceID)
+	}
 	for _, appid := range appIDs {
 		params.Add("appid", appid)
 	}
@@ -587,6 +671,11 @@ func (d *Discovery) polls(ctx context.Context) (apps map[string]*InstancesInfo,
 		return
 	}
 	if ec := ecode.Int(res.Code); !ecode.EqualError(ecode.OK, ec) {
+		if ecode.EqualError(ecode.ServiceUnavailable, ec) {
+			log.Info("discovery: client.Get(%s) node go away, switch node", uri)
+			err = errGoAway
+			return
+		}
 		if !ecode.EqualError(ecode.NotModified, ec) {
 			log.Error("discovery: client.Get(%s) get error code(%d)", uri+"?"+params.Encode(), res.Code)
 			err = ec
@@ -603,6 +692,29 @@ func (d *Discovery) polls(ctx context.Context) (apps map[string]*InstancesInfo,
 	}
 	log.Info("discovery: successfully polls(%s) instances (%s)", uri+"?"+params.Encode(), info)
 	apps = res.Data
+	if d.dropStale(apps) {
+		log.Warn("discovery: client.Get(%s) stale instances from node in protect mode, switch node", uri+"?"+params.Encode())
+		err = errStale
+	}
+	return
+}
+
+// dropStale drops the stale apps which are already fetched from a complete node,
+// stale instances only fill apps without any. It returns whether there are stale apps.
+func (d *Discovery) dropStale(apps map[string]*InstancesInfo) (stale bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	for appID, info := range apps {
+		if !info.Stale {
+			continue
+		}
+		stale = true
+		if app, ok := d.apps[appID]; ok {
+			if cur, ok := app.zoneIns.Load().(*InstancesInfo); ok && !cur.Stale {
+				delete(apps, appID)
+			}
+		}
+	}
 	return
 }
 
@@ -620,10 +732,17 @@ func (d *Discovery) broadcast(apps map[string]*InstancesInfo) {
 		}
 		d.mutex.RLock()
 		app, ok := d.apps[appID]
+		dir, env := d.c.CacheDir, d.c.Env
 		d.mutex.RUnlock()
 		if ok {
 			app.lastTs = v.LastTs
 			app.zoneIns.Store(v)
+			// NOTE: write the cache out of lock, which is taken by Build and Close.
+			if dir != "" {
+				if err := saveCache(dir, env, appID, v); err != nil {
+					log.Error("discovery: save cache of appid(%s) error(%v)", appID, err)
+				}
+			}
 			d.mutex.RLock()
 			for rs := range app.resolver {
 				select {
@@ -642,6 +761,9 @@ func (d *Discovery) newParams(c *Config) url.Values {
 	params.Set("zone", c.Zone)
 	params.Set("env", c.Env)
 	params.Set("hostname", c.Host)
+	if c.InstanceID != "" {
+		params.Set("instance_id", c.InstanceID)
+	}
 	return params
 }
 
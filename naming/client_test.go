@@ -3,8 +3,10 @@ package naming
 import (
 	"context"
 	"flag"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -13,6 +15,7 @@ import (
 	"github.com/bilibili/discovery/conf"
 	"github.com/bilibili/discovery/discovery"
 	"github.com/bilibili/discovery/http"
+	"github.com/bilibili/discovery/model"
 
 	"github.com/go-kratos/kratos/pkg/conf/paladin"
 	xhttp "github.com/go-kratos/kratos/pkg/net/http/blademaster"
@@ -240,3 +243,117 @@ func logInss(t *testing.T, msg string, inss []*Instance) {
 		t.Logf("%+v", in)
 	}
 }
+
+func TestDropStale(t *testing.T) {
+	Convey("test drop stale instances already fetched", t, func() {
+		fetched, empty := new(appInfo), new(appInfo)
+		fetched.zoneIns.Store(&InstancesInfo{LastTs: 1})
+		d := &Discovery{apps: map[string]*appInfo{"fetched": fetched, "empty": empty}}
+		apps := map[string]*InstancesInfo{
+			"fetched": {LastTs: 2, Stale: true},
+			"empty":   {LastTs: 2, Stale: true},
+		}
+		So(d.dropStale(apps), ShouldBeTrue)
+		So(apps["fetched"], ShouldBeNil)
+		So(apps["empty"], ShouldNotBeNil)
+		So(d.dropStale(map[string]*InstancesInfo{"fetched": {LastTs: 3}}), ShouldBeFalse)
+	})
+}
+
+func TestEndpoints(t *testing.T) {
+	Convey("test typed endpoints of instance", t, func() {
+		ins := &Instance{Addrs: []string{"http://127.0.0.1", "grpc://127.0.0.1:9000?weight=20&tls=true", "grpc://127.0.0.1", "bad"}}
+		es := ins.Endpoints()
+		So(len(es), ShouldEqual, 2)
+		So(es[0].Addr(), ShouldEqual, "127.0.0.1:80")
+		So(es[0].TLS(), ShouldBeFalse)
+		e, ok := ins.Endpoint("grpc")
+		So(ok, ShouldBeTrue)
+		So(e.Port, ShouldEqual, 9000)
+		So(e.Weight(), ShouldEqual, 20)
+		So(e.TLS(), ShouldBeTrue)
+		_, ok = ins.Endpoint("thrift")
+		So(ok, ShouldBeFalse)
+		// NOTE: addrs are parsed by the same rule as discovery validates registrations.
+		for _, addr := range []string{"grpc://127.0.0.1", "127.0.0.1:9000", "grpc://127.0.0.1:0", "grpc://127.0.0.1:9000?weight=%zz", "https://host"} {
+			_, ok = ParseEndpoint(addr)
+			_, err := model.ParseEndpoint(addr)
+			So(ok, ShouldEqual, err == nil)
+		}
+	})
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Convey("test boot from cache while discovery is unreachable", t, func() {
+		dis := New(&Config{Nodes: []string{"127.0.0.1:7171"}, Region: "test", Zone: "test", Env: "test", Host: "test-cache", CacheDir: dir})
+		_, err := os.Stat(filepath.Join(dir, cacheFile("test", _appid)))
+		So(err, ShouldBeNil)
+		dis.Close()
+		info, err := loadCache(dir, "test", _appid)
+		So(err, ShouldBeNil)
+		So(info.Stale, ShouldBeTrue)
+		So(len(info.Instances["test"]), ShouldBeGreaterThan, 0)
+		_, err = loadCache(dir, "test", "not.cached")
+		So(os.IsNotExist(err), ShouldBeTrue)
+		// NOTE: no discovery node listens on 7172, neither the seed node nor the cached ones.
+		for _, ins := range info.Instances {
+			for _, in := range ins {
+				in.Addrs = []string{"http://127.0.0.1:7172"}
+			}
+		}
+		info.Stale = false
+		So(saveCache(dir, "test", _appid, info), ShouldBeNil)
+		dis = New(&Config{Nodes: []string{"127.0.0.1:7172"}, Region: "test", Zone: "test", Env: "test", Host: "test-cache", CacheDir: dir})
+		ins, ok := dis.Build(_appid).Fetch()
+		So(ok, ShouldBeTrue)
+		So(ins.Stale, ShouldBeTrue)
+		So(len(ins.Instances["test"]), ShouldBeGreaterThan, 0)
+		So(ins.Instances["test"][0].Addrs, ShouldResemble, []string{"http://127.0.0.1:7172"})
+		dis.Close()
+	})
+}
+
+func TestPickNode(t *testing.T) {
+	Convey("test pick node by zone, latency and backoff", t, func() {
+		d := &Discovery{c: &Config{Zone: "sh1", Nodes: []string{"seed:7171"}}, health: health{nodes: make(map[string]*Node)}}
+		d.node.Store([]string{"a:7171", "b:7171", "c:7171"})
+		d.setZones(map[string]string{"a:7171": "sh2", "b:7171": "sh1", "c:7171": "sh1"})
+		d.succeedNode("a:7171", time.Millisecond)
+		d.succeedNode("b:7171", 20*time.Millisecond)
+		d.succeedNode("c:7171", 5*time.Millisecond)
+		So(d.pickNode(), ShouldEqual, "c:7171")
+		// NOTE: the current node is kept while available.
+		d.succeedNode("b:7171", time.Millisecond)
+		d.succeedNode("c:7171", 50*time.Millisecond)
+		So(d.pickNode(), ShouldEqual, "c:7171")
+		d.rebalanceNode()
+		So(d.pickNode(), ShouldEqual, "b:7171")
+		d.failNode("b:7171", errGoAway)
+		So(d.pickNode(), ShouldEqual, "c:7171")
+		d.failNode("c:7171", errGoAway)
+		So(d.pickNode(), ShouldEqual, "a:7171")
+		d.failNode("a:7171", errGoAway)
+		So(d.pickNode(), ShouldEqual, "seed:7171")
+		So(d.retryAfter(), ShouldEqual, 0)
+		d.failNode("seed:7171", errGoAway)
+		So(d.pickNode(), ShouldEqual, "b:7171")
+		So(d.retryAfter(), ShouldBeGreaterThan, 0)
+		d.failNode("b:7171", errGoAway)
+		So(d.pickNode(), ShouldEqual, "c:7171")
+		s := d.NodeStatus()
+		So(s.Current, ShouldEqual, "c:7171")
+		So(s.Reason, ShouldContainSubstring, "backing off")
+		So(len(s.Nodes), ShouldEqual, 4)
+		So(s.Nodes[1].Addr, ShouldEqual, "b:7171")
+		So(s.Nodes[1].Fails, ShouldEqual, 2)
+		So(s.Nodes[1].Backoff.Sub(s.Nodes[2].Backoff), ShouldBeGreaterThan, time.Second/2)
+		d.succeedNode("a:7171", 0)
+		So(d.pickNode(), ShouldEqual, "a:7171")
+		So(d.NodeStatus().Nodes[0].Latency, ShouldEqual, time.Millisecond)
+	})
+}
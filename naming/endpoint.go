@@ -0,0 +1,77 @@
+package naming
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/bilibili/discovery/model"
+)
+
+// endpoint metadata common key
+const (
+	EndpointWeight = model.EndpointWeight
+	EndpointTLS    = model.EndpointTLS
+)
+
+// Endpoint is a typed addr of instance, like "grpc://10.0.0.1:9000?weight=20&tls=true",
+// in which the query is the metadata of endpoint.
+type Endpoint struct {
+	Scheme   string
+	Host     string
+	Port     int
+	Metadata map[string]string
+}
+
+// ParseEndpoint parses an addr of instance by the same rule as discovery validates registrations,
+// ok is false if the addr is invalid.
+func ParseEndpoint(addr string) (e *Endpoint, ok bool) {
+	me, err := model.ParseEndpoint(addr)
+	if err != nil {
+		return
+	}
+	return &Endpoint{Scheme: me.Scheme, Host: me.Host, Port: me.Port, Metadata: me.Metadata}, true
+}
+
+// Addr returns host:port to dial.
+func (e *Endpoint) Addr() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// Weight returns the weight of endpoint, zero if not set.
+func (e *Endpoint) Weight() int64 {
+	w, _ := strconv.ParseInt(e.Metadata[EndpointWeight], 10, 64)
+	return w
+}
+
+// TLS returns whether the endpoint requires tls, which is implied by https.
+func (e *Endpoint) TLS() bool {
+	tls, _ := strconv.ParseBool(e.Metadata[EndpointTLS])
+	return tls || e.Scheme == "https"
+}
+
+// Endpoints returns the valid endpoints of instance, of the schemes if any.
+func (ins *Instance) Endpoints(schemes ...string) (es []*Endpoint) {
+	for _, addr := range ins.Addrs {
+		e, ok := ParseEndpoint(addr)
+		if !ok {
+			continue
+		}
+		for _, s := range schemes {
+			if ok = s == e.Scheme; ok {
+				break
+			}
+		}
+		if ok {
+			es = append(es, e)
+		}
+	}
+	return
+}
+
+// Endpoint returns the first valid endpoint of scheme.
+func (ins *Instance) Endpoint(scheme string) (e *Endpoint, ok bool) {
+	if es := ins.Endpoints(scheme); len(es) > 0 {
+		return es[0], true
+	}
+	return
+}
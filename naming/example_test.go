@@ -40,9 +40,10 @@ type consumer struct {
 // This Example show how get watch a server provider and get provider instances.
 func ExampleResolver_Watch() {
 	conf := &naming.Config{
-		Nodes: []string{"127.0.0.1:7171"},
-		Zone:  "sh1",
-		Env:   "test",
+		Nodes:    []string{"127.0.0.1:7171"},
+		Zone:     "sh1",
+		Env:      "test",
+		CacheDir: "/data/discovery/cache", // NOTE: 缓存最近的实例，discovery不可用时可以使用缓存启动
 	}
 	dis := naming.New(conf)
 	c := &consumer{
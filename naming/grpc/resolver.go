@@ -159,10 +159,11 @@ func (r *Resolver) newAddress(instances []*naming.Instance) {
 func extractAddrs(ins *naming.Instance) (addr, color string, weight int64) {
 	color = ins.Metadata[naming.MetaColor]
 	weight, _ = strconv.ParseInt(ins.Metadata[naming.MetaWeight], 10, 64)
-	for _, a := range ins.Addrs {
-		u, err := url.Parse(a)
-		if err == nil && u.Scheme == Scheme {
-			addr = u.Host
+	if e, ok := ins.Endpoint(Scheme); ok {
+		addr = e.Addr()
+		// NOTE: the weight of endpoint overrides the one of instance.
+		if w := e.Weight(); w > 0 {
+			weight = w
 		}
 	}
 	return
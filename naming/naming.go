@@ -25,6 +25,8 @@ type Instance struct {
 	AppID string `json:"appid"`
 	// Hostname is hostname from docker.
 	Hostname string `json:"hostname"`
+	// InstanceID distinguishes the instances on the same hostname, which is the hostname by default.
+	InstanceID string `json:"instance_id"`
 	// Addrs is the address of app instance
 	// format: scheme://host
 	Addrs []string `json:"addrs"`
@@ -61,6 +63,8 @@ type InstancesInfo struct {
 	Instances map[string][]*Instance `json:"instances"`
 	LastTs    int64                  `json:"latest_timestamp"`
 	Scheduler []Zone                 `json:"scheduler"`
+	// Stale instances may be incomplete, served by a discovery node in protect mode.
+	Stale bool `json:"stale,omitempty"`
 }
 
 // Zone zone scheduler info.
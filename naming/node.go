@@ -0,0 +1,219 @@
+package naming
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/go-kratos/kratos/pkg/log"
+)
+
+const (
+	_backoffBase = time.Second
+	_backoffMax  = time.Minute
+)
+
+// Node is the health of a discovery node seen by the client.
+type Node struct {
+	Addr string
+	// Zone is empty for seed nodes not discovered yet.
+	Zone string
+	// Latency is the moving average of response time of register, renew, cancel and set, zero if not measured.
+	Latency time.Duration
+	// Fails is the count of consecutive failures, the node is not picked before Backoff.
+	Fails   int
+	Backoff time.Time
+}
+
+// NodeStatus is the discovery node used by the client and why it is picked, with the health of nodes known.
+type NodeStatus struct {
+	Current string
+	Reason  string
+	Nodes   []*Node
+}
+
+// health tracks the discovery nodes called by the client.
+type health struct {
+	mu      sync.Mutex
+	nodes   map[string]*Node
+	current string
+	reason  string
+}
+
+func (h *health) node(addr string) (n *Node) {
+	if n = h.nodes[addr]; n == nil {
+		n = &Node{Addr: addr}
+		h.nodes[addr] = n
+	}
+	return
+}
+
+func (h *health) available(addr string, now time.Time) bool {
+	return !now.Before(h.node(addr).Backoff)
+}
+
+// best returns the available node of addrs in the same zone first and then with the lowest latency,
+// unmeasured nodes are taken as the fastest to be tried. Ties are broken by the order of addrs from start.
+func (h *health) best(addrs []string, zone string, start int, now time.Time) (best *Node) {
+	for i := range addrs {
+		n := h.node(addrs[(start+i)%len(addrs)])
+		if !h.available(n.Addr, now) {
+			continue
+		}
+		if best == nil {
+			best = n
+			continue
+		}
+		if same, bestSame := n.Zone == zone, best.Zone == zone; same != bestSame {
+			if same {
+				best = n
+			}
+			continue
+		}
+		if n.Latency < best.Latency {
+			best = n
+		}
+	}
+	return
+}
+
+// setZones sets the zone of nodes discovered.
+func (d *Discovery) setZones(zones map[string]string) {
+	d.health.mu.Lock()
+	for addr, zone := range zones {
+		d.health.node(addr).Zone = zone
+	}
+	d.health.mu.Unlock()
+}
+
+// pickNode returns the node to call: the current one while it is available, otherwise the available node
+// preferring the same zone and then the lowest latency. Seed nodes are picked if all nodes discovered are
+// backing off, and the node backing off shortest if seed nodes are too.
+func (d *Discovery) pickNode() string {
+	addrs, _ := d.node.Load().([]string)
+	d.mutex.RLock()
+	zone, seeds := d.c.Zone, d.c.Nodes
+	d.mutex.RUnlock()
+	h := &d.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	cands, start, fallback := addrs, 0, false
+	if h.best(addrs, zone, 0, now) == nil {
+		// NOTE: start from a random seed node to spread clients.
+		cands, start, fallback = seeds, rand.Intn(len(seeds)), true
+	}
+	for _, addr := range cands {
+		if addr == h.current && h.available(addr, now) {
+			return addr
+		}
+	}
+	var reason string
+	n := h.best(cands, zone, start, now)
+	if n != nil {
+		reason = "available node"
+		if fallback {
+			reason = "all nodes discovered are failing, seed node"
+		}
+		if n.Zone != "" && n.Zone == zone {
+			reason += " in the same zone"
+		}
+		if n.Latency > 0 {
+			reason += fmt.Sprintf(" with the lowest latency(%v)", n.Latency)
+		}
+	} else {
+		for _, addr := range append(append([]string{}, addrs...), seeds...) {
+			if m := h.node(addr); n == nil || m.Backoff.Before(n.Backoff) {
+				n = m
+			}
+		}
+		reason = fmt.Sprintf("all nodes are failing, retry the one backing off shortest(%v)", n.Backoff.Sub(now))
+	}
+	if n.Addr != h.current {
+		log.Info("discovery: switch node from(%s) to(%s), %s", h.current, n.Addr, reason)
+	}
+	h.current, h.reason = n.Addr, reason
+	return n.Addr
+}
+
+// failNode backs off the node exponentially by its consecutive failures.
+func (d *Discovery) failNode(addr string, err error) {
+	h := &d.health
+	h.mu.Lock()
+	n := h.node(addr)
+	n.Fails++
+	backoff := _backoffMax
+	if n.Fails <= 6 {
+		backoff = _backoffBase << uint(n.Fails-1)
+	}
+	n.Backoff = time.Now().Add(backoff)
+	if h.current == addr {
+		h.current = ""
+	}
+	fails := n.Fails
+	h.mu.Unlock()
+	log.Warn("discovery: node(%s) failed %d times, back off %v error(%v)", addr, fails, backoff, err)
+}
+
+// succeedNode resets the failures of node, and measures its latency if not zero.
+func (d *Discovery) succeedNode(addr string, latency time.Duration) {
+	h := &d.health
+	h.mu.Lock()
+	n := h.node(addr)
+	n.Fails, n.Backoff = 0, time.Time{}
+	if latency > 0 {
+		if n.Latency == 0 {
+			n.Latency = latency
+		} else {
+			n.Latency = (n.Latency*7 + latency*3) / 10
+		}
+	}
+	h.mu.Unlock()
+}
+
+// rebalanceNode picks the node again on the next call, in case a better one is available.
+func (d *Discovery) rebalanceNode() {
+	d.health.mu.Lock()
+	d.health.current = ""
+	d.health.mu.Unlock()
+}
+
+// retryAfter returns how long to wait before calling the node picked, zero if it is available.
+func (d *Discovery) retryAfter() time.Duration {
+	addr := d.pickNode()
+	d.health.mu.Lock()
+	wait := time.Until(d.health.node(addr).Backoff)
+	d.health.mu.Unlock()
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// NodeStatus returns the discovery node currently used and why, with the health of nodes discovered and seed nodes.
+func (d *Discovery) NodeStatus() (s *NodeStatus) {
+	addrs, _ := d.node.Load().([]string)
+	d.mutex.RLock()
+	seeds := d.c.Nodes
+	d.mutex.RUnlock()
+	h := &d.health
+	h.mu.Lock()
+	s = &NodeStatus{Current: h.current, Reason: h.reason}
+	// NOTE: seed nodes may be discovered too.
+	seen := make(map[string]struct{}, len(addrs)+len(seeds))
+	for _, addr := range append(append([]string{}, addrs...), seeds...) {
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+		seen[addr] = struct{}{}
+		if n, ok := h.nodes[addr]; ok {
+			nn := *n
+			s.Nodes = append(s.Nodes, &nn)
+		}
+	}
+	h.mu.Unlock()
+	sort.Slice(s.Nodes, func(i, j int) bool { return s.Nodes[i].Addr < s.Nodes[j].Addr })
+	return
+}
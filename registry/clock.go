@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/go-kratos/kratos/pkg/log"
+)
+
+const (
+	_logicalBits = 16
+	_logicalMask = int64(1)<<_logicalBits - 1
+	// _maxClockSkew is the max offset of peer timestamps merged into the clock,
+	// timestamps further ahead are considered broken clocks and ignored.
+	_maxClockSkew = int64(10 * time.Second)
+)
+
+// clock is a hybrid logical clock.
+// Timestamps keep the unix nanosecond format so that they stay comparable with wall-clock
+// timestamps of older nodes: the high bits are physical time and the low 16 bits a logical counter.
+type clock struct {
+	lock sync.Mutex
+	last int64
+	wall func() int64
+}
+
+func newClock() *clock {
+	return &clock{
+		wall: func() int64 { return time.Now().UnixNano() },
+	}
+}
+
+// Now returns a timestamp greater than any timestamp returned or merged before.
+func (c *clock) Now() (ts int64) {
+	pt := c.wall() &^ _logicalMask
+	c.lock.Lock()
+	if pt > c.last {
+		c.last = pt
+	} else {
+		c.last++
+	}
+	ts = c.last
+	c.lock.Unlock()
+	return
+}
+
+// Update merges a timestamp received from peer node, timestamps returned later are greater than it.
+func (c *clock) Update(ts int64) {
+	if ts <= 0 {
+		return
+	}
+	if skew := ts - c.wall(); skew > _maxClockSkew {
+		log.Warn("clock update timestamp(%d) ahead of wall clock(%v), ignored", ts, time.Duration(skew))
+		return
+	}
+	c.lock.Lock()
+	if ts > c.last {
+		c.last = ts
+	}
+	c.lock.Unlock()
+}
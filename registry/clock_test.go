@@ -0,0 +1,38 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClockNow(t *testing.T) {
+	Convey("test clock now monotonic with frozen wall clock", t, func() {
+		c := newClock()
+		wall := time.Now().UnixNano()
+		c.wall = func() int64 { return wall }
+		t1 := c.Now()
+		t2 := c.Now()
+		So(t1, ShouldEqual, wall&^_logicalMask)
+		So(t2, ShouldEqual, t1+1)
+	})
+}
+
+func TestClockUpdate(t *testing.T) {
+	Convey("test clock merge peer timestamp", t, func() {
+		c := newClock()
+		wall := time.Now().UnixNano()
+		c.wall = func() int64 { return wall }
+		peer := wall + int64(time.Second)
+		c.Update(peer)
+		So(c.Now(), ShouldBeGreaterThan, peer)
+	})
+	Convey("test clock ignore skewed peer timestamp", t, func() {
+		c := newClock()
+		wall := time.Now().UnixNano()
+		c.wall = func() int64 { return wall }
+		c.Update(wall + 2*_maxClockSkew)
+		So(c.Now(), ShouldBeLessThan, wall+_maxClockSkew)
+	})
+}
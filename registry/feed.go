@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"sync"
+
+	"github.com/bilibili/discovery/model"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+)
+
+const (
+	_feedSize     = 10000
+	_feedPageSize = 500
+)
+
+// feed keeps the latest mutations of registry in a ring, ordered by seq.
+// NOTE: seq starts from the clock of startup, so cursors of a former run or other nodes are always out of range.
+type feed struct {
+	lock    sync.RWMutex
+	changes []*model.Change
+	start   int64
+	seq     int64
+	notify  chan struct{}
+}
+
+func newFeed(size int, start int64) *feed {
+	if size <= 0 {
+		size = _feedSize
+	}
+	return &feed{
+		changes: make([]*model.Change, size),
+		start:   start,
+		seq:     start,
+		notify:  make(chan struct{}),
+	}
+}
+
+// add appends a change of instance and wakes up the waiters.
+func (f *feed) add(action string, i *model.Instance) {
+	f.lock.Lock()
+	f.seq++
+	f.changes[f.seq%int64(len(f.changes))] = &model.Change{Seq: f.seq, Action: action, Instance: i}
+	close(f.notify)
+	f.notify = make(chan struct{})
+	f.lock.Unlock()
+}
+
+// since returns at most ps changes after cursor, and a channel closed on the next change.
+// The current cursor is returned if cursor is negative, and ecode.NothingFound if changes after cursor are dropped.
+func (f *feed) since(cursor int64, ps int) (cs *model.Changes, notify <-chan struct{}, err error) {
+	if ps <= 0 {
+		ps = _feedPageSize
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	notify = f.notify
+	cs = &model.Changes{Changes: make([]*model.Change, 0), Cursor: f.seq}
+	if cursor < 0 {
+		return
+	}
+	oldest := f.seq - int64(len(f.changes))
+	if oldest < f.start {
+		oldest = f.start
+	}
+	if cursor < oldest || cursor > f.seq {
+		return nil, notify, ecode.NothingFound
+	}
+	cs.Cursor = cursor
+	for seq := cursor + 1; seq <= f.seq && len(cs.Changes) < ps; seq++ {
+		c := f.changes[seq%int64(len(f.changes))]
+		cs.Changes = append(cs.Changes, c)
+		cs.Cursor = c.Seq
+	}
+	cs.More = cs.Cursor < f.seq
+	return
+}
+
+// removed returns the instances cancelled or evicted after ts which are still in the ring.
+func (f *feed) removed(ts int64) (is []*model.Instance) {
+	f.lock.RLock()
+	for _, c := range f.changes {
+		if c != nil && (c.Action == model.ChangeCancel || c.Action == model.ChangeEvict) && c.Instance.LatestTimestamp > ts {
+			is = append(is, c.Instance)
+		}
+	}
+	f.lock.RUnlock()
+	return
+}
@@ -17,20 +17,36 @@ type Guard struct {
 	expThreshold int64
 	facInMin     int64
 	facLastMin   int64
+	threshold    float64 // _percentThreshold if zero
 	lock         sync.RWMutex
 }
 
+// setThreshold sets the percent of expected renews below which eviction stops.
+func (g *Guard) setThreshold(threshold float64) {
+	g.lock.Lock()
+	g.threshold = threshold
+	g.expThreshold = int64(float64(g.expPerMin) * g.percent())
+	g.lock.Unlock()
+}
+
+func (g *Guard) percent() float64 {
+	if g.threshold == 0 {
+		return _percentThreshold
+	}
+	return g.threshold
+}
+
 func (g *Guard) setExp(cnt int64) {
 	g.lock.Lock()
 	g.expPerMin = cnt * 2
-	g.expThreshold = int64(float64(g.expPerMin) * _percentThreshold)
+	g.expThreshold = int64(float64(g.expPerMin) * g.percent())
 	g.lock.Unlock()
 }
 
 func (g *Guard) incrExp() {
 	g.lock.Lock()
 	g.expPerMin = g.expPerMin + 2
-	g.expThreshold = int64(float64(g.expPerMin) * _percentThreshold)
+	g.expThreshold = int64(float64(g.expPerMin) * g.percent())
 	g.lock.Unlock()
 }
 
@@ -42,7 +58,7 @@ func (g *Guard) decrExp() {
 	g.lock.Lock()
 	if g.expPerMin > 0 {
 		g.expPerMin = g.expPerMin - 2
-		g.expThreshold = int64(float64(g.expPerMin) * _percentThreshold)
+		g.expThreshold = int64(float64(g.expPerMin) * g.percent())
 	}
 	g.lock.Unlock()
 }
@@ -52,9 +68,13 @@ func (g *Guard) incrFac() {
 }
 
 func (g *Guard) ok() (is bool) {
-	is = atomic.LoadInt64(&g.facLastMin) < atomic.LoadInt64(&g.expThreshold)
-	if is {
+	if is = g.protected(); is {
 		log.Warn("discovery is protected, the factual renews(%d) less than expected renews(%d)", atomic.LoadInt64(&g.facLastMin), atomic.LoadInt64(&g.expThreshold))
 	}
 	return
 }
+
+// protected returns whether the factual renews of last minute are less than expected.
+func (g *Guard) protected() bool {
+	return atomic.LoadInt64(&g.facLastMin) < atomic.LoadInt64(&g.expThreshold)
+}
@@ -64,3 +64,15 @@ func TestIsProtected(t *testing.T) {
 		So(re.ok(), ShouldBeFalse)
 	})
 }
+
+func TestSetThreshold(t *testing.T) {
+	Convey("test SetThreshold", t, func() {
+		re := new(Guard)
+		re.setExp(50)
+		So(re.expThreshold, ShouldResemble, int64(85))
+		re.setThreshold(0.5)
+		So(re.expThreshold, ShouldResemble, int64(50))
+		re.incrExp()
+		So(re.expThreshold, ShouldResemble, int64(51))
+	})
+}
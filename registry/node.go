@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	xhttp "net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bilibili/discovery/conf"
 	"github.com/bilibili/discovery/model"
@@ -20,8 +24,16 @@ const (
 	_cancelURL   = "/discovery/cancel"
 	_renewURL    = "/discovery/renew"
 	_setURL      = "/discovery/set"
+	_clearURL    = "/discovery/overrides/clear"
 )
 
+// _memberURLs are the admin api of member changes by the state changed to.
+var _memberURLs = map[string]string{
+	model.MemberActive:         "/discovery/members/add",
+	model.MemberRemoved:        "/discovery/members/remove",
+	model.MemberDecommissioned: "/discovery/members/decommission",
+}
+
 // Node represents a peer node to which information should be shared from this node.
 //
 // This struct handles replicating all update operations like 'Register,Renew,Cancel,Expiration and Status Changes'
@@ -36,30 +48,74 @@ type Node struct {
 	cancelURL    string
 	renewURL     string
 	setURL       string
+	clearURL     string
 
 	addr      string
+	scheme    string
 	status    model.NodeStatus
+	sLock     sync.RWMutex
 	zone      string
 	otherZone bool
 }
 
 // newNode return a node.
 func newNode(c *conf.Config, addr string) (n *Node) {
+	scheme, addr := c.SplitAddr(addr)
 	n = &Node{
 		c: c,
 		// url
-		client:      http.NewClient(c.HTTPClient),
-		registerURL: fmt.Sprintf("http://%s%s", addr, _registerURL),
-		cancelURL:   fmt.Sprintf("http://%s%s", addr, _cancelURL),
-		renewURL:    fmt.Sprintf("http://%s%s", addr, _renewURL),
-		setURL:      fmt.Sprintf("http://%s%s", addr, _setURL),
+		client:      NewClient(c),
+		registerURL: fmt.Sprintf("%s://%s%s", scheme, addr, _registerURL),
+		cancelURL:   fmt.Sprintf("%s://%s%s", scheme, addr, _cancelURL),
+		renewURL:    fmt.Sprintf("%s://%s%s", scheme, addr, _renewURL),
+		setURL:      fmt.Sprintf("%s://%s%s", scheme, addr, _setURL),
+		clearURL:    fmt.Sprintf("%s://%s%s", scheme, addr, _clearURL),
 
 		addr:   addr,
+		scheme: scheme,
 		status: model.NodeStatusLost,
 	}
 	return
 }
 
+// NewClient new a http client used to call peer nodes, verifying them with the tls config if any.
+func NewClient(c *conf.Config) (client *http.Client) {
+	client = http.NewClient(c.HTTPClient)
+	if c.TLS == nil && !c.Auth.Enabled() {
+		return
+	}
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(c.HTTPClient.Dial),
+		KeepAlive: time.Duration(c.HTTPClient.KeepAlive),
+	}
+	transport := &xhttp.Transport{DialContext: dialer.DialContext}
+	if c.TLS != nil {
+		tc, err := c.TLS.Client()
+		if err != nil {
+			log.Error("c.TLS.Client() error(%v)", err)
+			panic(err)
+		}
+		transport.TLSClientConfig = tc
+	}
+	var rt xhttp.RoundTripper = transport
+	if token := c.Auth.PeerToken(); token != "" {
+		rt = &tokenTransport{token: token, RoundTripper: transport}
+	}
+	client.SetTransport(&http.TraceTransport{RoundTripper: rt})
+	return
+}
+
+// tokenTransport presents the token of this node to peers.
+type tokenTransport struct {
+	token string
+	xhttp.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *xhttp.Request) (*xhttp.Response, error) {
+	req.Header.Set(model.AuthHeader, model.AuthBearer+t.token)
+	return t.RoundTripper.RoundTrip(req)
+}
+
 // Register send the registration information of Instance receiving by this node to the peer node represented.
 func (n *Node) Register(c context.Context, i *model.Instance) (err error) {
 	err = n.call(c, model.Register, i, n.registerURL, nil)
@@ -85,10 +141,9 @@ func (n *Node) Renew(c context.Context, i *model.Instance) (err error) {
 	err = n.call(c, model.Renew, i, n.renewURL, &res)
 	if err == ecode.ServerErr {
 		log.Warn("node be called(%s) instance(%v) error(%v)", n.renewURL, i, err)
-		n.status = model.NodeStatusLost
+		n.setStatus(model.NodeStatusLost)
 		return
 	}
-	n.status = model.NodeStatusUP
 	if err == ecode.NothingFound {
 		log.Warn("node be called(%s) instance(%v) error(%v)", n.renewURL, i, err)
 		err = n.call(c, model.Register, i, n.registerURL, nil)
@@ -102,10 +157,107 @@ func (n *Node) Renew(c context.Context, i *model.Instance) (err error) {
 }
 
 // Set the infomation of instance by this node to the peer node represented
-func (n *Node) Set(c context.Context, arg *model.ArgSet) (err error) {
-	err = n.setCall(c, arg, n.setURL)
+// Newer instances of the peer node are returned with ecode.Conflict.
+func (n *Node) Set(c context.Context, arg *model.ArgSet) (conflicts []*model.Instance, err error) {
+	return n.setCall(c, arg, n.setURL)
+}
+
+// ClearOverride clears the override of instance by this node on the peer node represented.
+func (n *Node) ClearOverride(c context.Context, arg *model.ArgClearOverride) (err error) {
+	params := url.Values{}
+	params.Set("appid", arg.AppID)
+	params.Set("env", arg.Env)
+	params.Set("hostname", arg.Hostname)
+	params.Set("instance_id", arg.ID())
+	params.Set("clear_timestamp", strconv.FormatInt(arg.ClearTimestamp, 10))
+	params.Set("from_zone", "true")
+	if n.otherZone {
+		params.Set("replication", "false")
+	} else {
+		params.Set("replication", "true")
+	}
+	var res struct {
+		Code int `json:"code"`
+	}
+	if err = n.client.Post(c, n.clearURL, "", params, &res); err != nil {
+		n.setStatus(model.NodeStatusLost)
+		log.Error("node be called(%s) appid(%s) env(%s) hostname(%s) error(%v)", n.clearURL, arg.AppID, arg.Env, arg.Hostname, err)
+		return
+	}
+	n.setStatus(model.NodeStatusUP)
+	if res.Code != 0 && res.Code != ecode.NothingFound.Code() {
+		log.Error("node be called(%s) appid(%s) env(%s) hostname(%s) response code(%v)", n.clearURL, arg.AppID, arg.Env, arg.Hostname, res.Code)
+		err = ecode.Int(res.Code)
+	}
+	return
+}
+
+// Member changes the member of cluster by this node on the peer node represented.
+func (n *Node) Member(c context.Context, arg *model.ArgMember, state string) (err error) {
+	uri := fmt.Sprintf("%s://%s%s", n.scheme, n.addr, _memberURLs[state])
+	params := url.Values{}
+	params.Set("zone", arg.Zone)
+	params.Set("addr", arg.Addr)
+	params.Set("from_zone", "true")
+	if n.otherZone {
+		params.Set("replication", "false")
+	} else {
+		params.Set("replication", "true")
+	}
+	var res struct {
+		Code int `json:"code"`
+	}
+	if err = n.client.Post(c, uri, "", params, &res); err != nil {
+		n.setStatus(model.NodeStatusLost)
+		log.Error("node be called(%s) zone(%s) addr(%s) error(%v)", uri, arg.Zone, arg.Addr, err)
+		return
+	}
+	n.setStatus(model.NodeStatusUP)
+	if res.Code != 0 {
+		log.Error("node be called(%s) zone(%s) addr(%s) response code(%v)", uri, arg.Zone, arg.Addr, res.Code)
+		err = ecode.Int(res.Code)
+	}
+	return
+}
+
+// replicate send the action of instance to the peer node represented.
+func (n *Node) replicate(c context.Context, action model.Action, i *model.Instance) (err error) {
+	switch action {
+	case model.Register:
+		err = n.Register(c, i)
+	case model.Renew:
+		err = n.Renew(c, i)
+	case model.Cancel:
+		err = n.Cancel(c, i)
+	}
+	return
+}
+
+// Status returns the status of the peer node represented.
+func (n *Node) Status() (s model.NodeStatus) {
+	n.sLock.RLock()
+	s = n.status
+	n.sLock.RUnlock()
 	return
 }
+
+func (n *Node) setStatus(s model.NodeStatus) {
+	n.sLock.Lock()
+	n.status = s
+	n.sLock.Unlock()
+}
+
+// unreachable returns whether the error means the peer node did not handle the request,
+// other errors are answers of the peer node.
+func unreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(ecode.Codes); !ok {
+		return true
+	}
+	return ecode.EqualError(ecode.ServerErr, err) || ecode.EqualError(ecode.ServiceUnavailable, err)
+}
 func (n *Node) call(c context.Context, action model.Action, i *model.Instance, uri string, data interface{}) (err error) {
 	params := url.Values{}
 	params.Set("region", i.Region)
@@ -113,6 +265,7 @@ func (n *Node) call(c context.Context, action model.Action, i *model.Instance, u
 	params.Set("env", i.Env)
 	params.Set("appid", i.AppID)
 	params.Set("hostname", i.Hostname)
+	params.Set("instance_id", i.ID())
 	params.Set("from_zone", "true")
 	if n.otherZone {
 		params.Set("replication", "false")
@@ -121,14 +274,18 @@ func (n *Node) call(c context.Context, action model.Action, i *model.Instance, u
 	}
 	switch action {
 	case model.Register:
+		// NOTE: peers apply their overrides on the status and metadata registered.
+		status, md := i.Origin()
 		params.Set("addrs", strings.Join(i.Addrs, ","))
-		params.Set("status", strconv.FormatUint(uint64(i.Status), 10))
+		params.Set("status", strconv.FormatUint(uint64(status), 10))
 		params.Set("version", i.Version)
-		meta, _ := json.Marshal(i.Metadata)
+		meta, _ := json.Marshal(md)
 		params.Set("metadata", string(meta))
 		params.Set("reg_timestamp", strconv.FormatInt(i.RegTimestamp, 10))
 		params.Set("dirty_timestamp", strconv.FormatInt(i.DirtyTimestamp, 10))
 		params.Set("latest_timestamp", strconv.FormatInt(i.LatestTimestamp, 10))
+		params.Set("status_timestamp", strconv.FormatInt(i.StatusTimestamp, 10))
+		params.Set("metadata_timestamp", strconv.FormatInt(i.MetadataTimestamp, 10))
 	case model.Renew:
 		params.Set("dirty_timestamp", strconv.FormatInt(i.DirtyTimestamp, 10))
 	case model.Cancel:
@@ -139,9 +296,11 @@ func (n *Node) call(c context.Context, action model.Action, i *model.Instance, u
 		Data json.RawMessage `json:"data"`
 	}
 	if err = n.client.Post(c, uri, "", params, &res); err != nil {
+		n.setStatus(model.NodeStatusLost)
 		log.Error("node be called(%s) instance(%v) error(%v)", uri, i, err)
 		return
 	}
+	n.setStatus(model.NodeStatusUP)
 	if res.Code != 0 {
 		log.Error("node be called(%s) instance(%v) response code(%v)", uri, i, res.Code)
 		if err = ecode.Int(res.Code); err == ecode.Conflict {
@@ -151,7 +310,7 @@ func (n *Node) call(c context.Context, action model.Action, i *model.Instance, u
 	return
 }
 
-func (n *Node) setCall(c context.Context, arg *model.ArgSet, uri string) (err error) {
+func (n *Node) setCall(c context.Context, arg *model.ArgSet, uri string) (conflicts []*model.Instance, err error) {
 	params := url.Values{}
 	params.Set("region", arg.Region)
 	params.Set("zone", arg.Zone)
@@ -169,6 +328,9 @@ func (n *Node) setCall(c context.Context, arg *model.ArgSet, uri string) (err er
 			params.Add("hostname", name)
 		}
 	}
+	for _, id := range arg.InstanceID {
+		params.Add("instance_id", id)
+	}
 	if len(arg.Status) != 0 {
 		for _, status := range arg.Status {
 			params.Add("status", strconv.FormatInt(status, 10))
@@ -178,17 +340,32 @@ func (n *Node) setCall(c context.Context, arg *model.ArgSet, uri string) (err er
 		for _, metadata := range arg.Metadata {
 			params.Add("metadata", metadata)
 		}
+		if arg.MetadataOp != "" {
+			params.Set("metadata_op", arg.MetadataOp)
+		}
+		for _, metadata := range arg.ResultMetadata {
+			params.Add("result_metadata", metadata)
+		}
+	}
+	if arg.Override {
+		params.Set("override", "true")
 	}
 	var res struct {
-		Code int `json:"code"`
+		Code int               `json:"code"`
+		Data []*model.Instance `json:"data"`
 	}
 	if err = n.client.Post(c, uri, "", params, &res); err != nil {
+		n.setStatus(model.NodeStatusLost)
 		log.Error("node be setCalled(%s) appid(%s) env (%s) error(%v)", uri, arg.AppID, arg.Env, err)
 		return
 	}
+	n.setStatus(model.NodeStatusUP)
 	if res.Code != 0 {
 		log.Error("node be setCalled(%s) appid(%s) env (%s) responce code(%v)", uri, arg.AppID, arg.Env, res.Code)
 		err = ecode.Int(res.Code)
 	}
+	if err == ecode.Conflict {
+		conflicts = res.Data
+	}
 	return
 }
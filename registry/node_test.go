@@ -3,7 +3,10 @@ package registry
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -51,6 +54,67 @@ func TestReplicate(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 }
+func TestReplicateAuth(t *testing.T) {
+	Convey("test replicate to peer with app tokens and admin tokens", t, func() {
+		auth := &dc.AuthConfig{Tokens: map[string][]string{"main.arch.other": {"app"}}, AdminTokens: []string{"admin"}}
+		var denied int32
+		peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			token := strings.TrimPrefix(r.Header.Get(model.AuthHeader), model.AuthBearer)
+			if err := auth.Verify(token, r.FormValue("appid"), r.FormValue("env")); err != nil {
+				atomic.AddInt32(&denied, 1)
+				w.Write([]byte(`{"code":-403}`))
+				return
+			}
+			w.Write([]byte(`{"code":0}`))
+		}))
+		defer peer.Close()
+		cfg := newConfig()
+		cfg.Auth = auth
+		cfg.Nodes = []string{strings.TrimPrefix(peer.URL, "http://")}
+		nodes := NewNodes(cfg)
+		i := model.NewInstance(reg)
+		So(nodes.nodes[0].Register(context.TODO(), i), ShouldBeNil)
+		So(nodes.nodes[0].Renew(context.TODO(), i), ShouldBeNil)
+		So(nodes.nodes[0].Cancel(context.TODO(), i), ShouldBeNil)
+		So(atomic.LoadInt32(&denied), ShouldEqual, 0)
+		cfg.Auth = &dc.AuthConfig{AdminTokens: []string{"forged"}}
+		nodes = NewNodes(cfg)
+		So(nodes.nodes[0].Register(context.TODO(), i), ShouldNotBeNil)
+		So(atomic.LoadInt32(&denied), ShouldEqual, 1)
+	})
+}
+
+func TestReplicateTimestamps(t *testing.T) {
+	Convey("test replicate register with status and metadata timestamps", t, func() {
+		var form url.Values
+		peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if r.URL.Path == "/discovery/register" {
+				form = r.Form
+			}
+			w.Write([]byte(`{"code":0}`))
+		}))
+		defer peer.Close()
+		cfg := newConfig()
+		cfg.Nodes = []string{strings.TrimPrefix(peer.URL, "http://")}
+		nodes := NewNodes(cfg)
+		i := model.NewInstance(reg)
+		i.Addrs = []string{"http://127.0.0.1:8000"}
+		i.StatusTimestamp, i.MetadataTimestamp = 100, 200
+		So(nodes.nodes[0].Register(context.TODO(), i), ShouldBeNil)
+		So(form, ShouldNotBeNil)
+		So(form.Get("status_timestamp"), ShouldEqual, "100")
+		So(form.Get("metadata_timestamp"), ShouldEqual, "200")
+		arg := new(model.ArgRegister)
+		req, _ := http.NewRequest("POST", "/discovery/register", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		So(binding.Form.Bind(req, arg), ShouldBeNil)
+		So(arg.StatusTimestamp, ShouldEqual, 100)
+		So(arg.MetadataTimestamp, ShouldEqual, 200)
+	})
+}
+
 func match(h *http.Request, mock *gock.Request) (ok bool, err error) {
 	ok = true
 	err = nil
@@ -71,6 +135,62 @@ func match(h *http.Request, mock *gock.Request) (ok bool, err error) {
 	return
 }
 
+func TestReplicateZone(t *testing.T) {
+	Convey("test replicate other zone failover", t, func() {
+		i := model.NewInstance(reg)
+		cfg := newConfig()
+		cfg.Nodes = []string{"127.0.0.1:7171"}
+		cfg.Zones = map[string][]string{"sh002": {"127.0.0.1:7181", "127.0.0.1:7182"}}
+		nodes := NewNodes(cfg)
+		for _, n := range nodes.zones["sh002"] {
+			n.client.SetTransport(gock.DefaultTransport)
+		}
+		bad, good := nodes.zones["sh002"][0], nodes.zones["sh002"][1]
+		bad.setStatus(model.NodeStatusUP)
+		So(nodes.zoneNodes("sh002")[0], ShouldEqual, bad)
+		httpMock("POST", "http://127.0.0.1:7181/discovery/register").Reply(500)
+		httpMock("POST", "http://127.0.0.1:7182/discovery/register").Reply(200).JSON(`{"code":0}`)
+		err := nodes.Replicate(context.TODO(), model.Register, i, false)
+		So(err, ShouldBeNil)
+		So(bad.Status(), ShouldEqual, model.NodeStatusLost)
+		So(good.Status(), ShouldEqual, model.NodeStatusUP)
+		So(nodes.zoneNodes("sh002")[0], ShouldEqual, good)
+	})
+	Convey("test replicate other zone failover not canceled by errors of other nodes", t, func() {
+		var hits int32
+		denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"code":-400}`))
+		}))
+		defer denied.Close()
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer slow.Close()
+		good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Write([]byte(`{"code":0}`))
+		}))
+		defer good.Close()
+		cfg := newConfig()
+		cfg.Nodes = []string{"127.0.0.1:7171", strings.TrimPrefix(denied.URL, "http://")}
+		cfg.Zones = map[string][]string{"sh002": {strings.TrimPrefix(slow.URL, "http://"), strings.TrimPrefix(good.URL, "http://")}}
+		nodes := NewNodes(cfg)
+		nodes.zones["sh002"][0].setStatus(model.NodeStatusUP)
+		arg := &model.ArgSet{Zone: "sh001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"reg"}, Status: []int64{1}}
+		_, err := nodes.ReplicateSet(context.TODO(), arg, false)
+		So(err, ShouldNotBeNil)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 1)
+	})
+	Convey("test replicate other zone load balancer", t, func() {
+		cfg := newConfig()
+		cfg.Zones = map[string][]string{"sh002": {"sh002.discovery.bilibili.com"}}
+		cfg.LBZones = []string{"sh002"}
+		nodes := NewNodes(cfg)
+		So(len(nodes.zoneNodes("sh002")), ShouldEqual, _lbRetry)
+	})
+}
+
 func TestReplicateSet(t *testing.T) {
 	Convey("test replicate set", t, func(c C) {
 		nodes := NewNodes(newConfig())
@@ -85,7 +205,7 @@ func TestReplicateSet(t *testing.T) {
 			Status:   []int64{1, 1},
 			Metadata: []string{`{"aa":1,"bb:2"}`, `{"aa":1,"bb:3"}`},
 		}
-		err := nodes.ReplicateSet(context.TODO(), set, false)
+		_, err := nodes.ReplicateSet(context.TODO(), set, false)
 		c.So(err, ShouldBeNil)
 		set = &model.ArgSet{
 			Region:   "shsb",
@@ -96,11 +216,34 @@ func TestReplicateSet(t *testing.T) {
 			Status:   []int64{1, 1},
 			Metadata: []string{`{"aa":1,"bb:2"}`},
 		}
-		err = nodes.ReplicateSet(context.TODO(), set, false)
+		_, err = nodes.ReplicateSet(context.TODO(), set, false)
 		c.So(err, ShouldNotBeNil)
 	})
 }
 
+func TestReplicateSetConflict(t *testing.T) {
+	Convey("test replicate set returns the newer instances of peers in conflict", t, func() {
+		var paths []string
+		peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			w.Write([]byte(`{"code":-409,"data":[{"appid":"main.arch.test","hostname":"test1","status":2,"dirty_timestamp":2}]}`))
+		}))
+		defer peer.Close()
+		cfg := newConfig()
+		cfg.HTTPServer.Addr = strings.TrimPrefix(peer.URL, "http://")
+		cfg.Nodes = []string{"127.0.0.1:7171", cfg.HTTPServer.Addr}
+		nodes := NewNodes(cfg)
+		nodes.selfAddr = "127.0.0.1:7171"
+		set := &model.ArgSet{Zone: "sh001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"test1"}, Status: []int64{1}, SetTimestamp: 1}
+		conflicts, err := nodes.ReplicateSet(context.TODO(), set, false)
+		So(err, ShouldBeNil)
+		So(len(conflicts), ShouldEqual, 1)
+		So(conflicts[0].Status, ShouldEqual, model.InstancestatusWating)
+		// NOTE: the peer listens on the register url of this node, which is not called.
+		So(paths, ShouldResemble, []string{"/discovery/set"})
+	})
+}
+
 func TestNodes(t *testing.T) {
 	Convey("test nodes", t, func() {
 		nodes := NewNodes(config)
@@ -116,6 +259,26 @@ func TestNodes(t *testing.T) {
 	})
 }
 
+func TestInherit(t *testing.T) {
+	Convey("test inherit status of rebuilt nodes", t, func() {
+		cfg := newConfig()
+		cfg.Nodes = []string{"127.0.0.1:7171", "127.0.0.1:7172"}
+		cfg.Zones = map[string][]string{"zone": []string{"127.0.0.1:7173", "127.0.0.1:7174"}}
+		old := NewNodes(cfg)
+		old.nodes[1].setStatus(model.NodeStatusUP)
+		old.zones["zone"][1].setStatus(model.NodeStatusUP)
+		cfg.Nodes = append(cfg.Nodes, "127.0.0.1:7175")
+		nodes := NewNodes(cfg)
+		nodes.Inherit(old)
+		So(nodes.nodes[0].Status(), ShouldEqual, model.NodeStatusLost)
+		So(nodes.nodes[1].Status(), ShouldEqual, model.NodeStatusUP)
+		So(nodes.nodes[2].Status(), ShouldEqual, model.NodeStatusLost)
+		So(nodes.zones["zone"][0].Status(), ShouldEqual, model.NodeStatusLost)
+		So(nodes.zones["zone"][1].Status(), ShouldEqual, model.NodeStatusUP)
+		So(nodes.zoneNodes("zone")[0].addr, ShouldEqual, "127.0.0.1:7174")
+	})
+}
+
 func TestUp(t *testing.T) {
 	Convey("test up", t, func() {
 		nodes := NewNodes(config)
@@ -141,6 +304,20 @@ func TestCall(t *testing.T) {
 	})
 }
 
+func TestNodeScheme(t *testing.T) {
+	Convey("test node scheme", t, func() {
+		node := newNode(newConfig(), "https://127.0.0.1:7172")
+		So(node.addr, ShouldEqual, "127.0.0.1:7172")
+		So(node.registerURL, ShouldEqual, "https://127.0.0.1:7172/discovery/register")
+		node = newNode(newConfig(), "127.0.0.1:7172")
+		So(node.registerURL, ShouldEqual, "http://127.0.0.1:7172/discovery/register")
+		cfg := newConfig()
+		cfg.Nodes = []string{"https://127.0.0.1:7171", "https://127.0.0.1:7172"}
+		nodes := NewNodes(cfg)
+		So(nodes.Myself(nodes.nodes[0].addr), ShouldBeTrue)
+	})
+}
+
 func TestNodeCancel(t *testing.T) {
 	Convey("test node renew 409 error", t, func() {
 		i := model.NewInstance(reg)
@@ -4,17 +4,28 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"net"
+	"sync"
 
 	"github.com/bilibili/discovery/conf"
 	"github.com/bilibili/discovery/model"
+	"github.com/go-kratos/kratos/pkg/ecode"
+	log "github.com/go-kratos/kratos/pkg/log"
 
 	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// _lbRetry is the number of attempts on a zone configured as load balancer,
+	// each attempt is expected to reach another node behind the load balancer.
+	_lbRetry = 3
+)
+
 // Nodes is helper to manage lifecycle of a collection of Nodes.
 type Nodes struct {
 	nodes    []*Node
 	zones    map[string][]*Node
+	lbZones  map[string]bool
 	selfAddr string
 }
 
@@ -24,7 +35,7 @@ func NewNodes(c *conf.Config) *Nodes {
 	for _, addr := range c.Nodes {
 		n := newNode(c, addr)
 		n.zone = c.Env.Zone
-		n.pRegisterURL = fmt.Sprintf("http://%s%s", c.HTTPServer.Addr, _registerURL)
+		n.pRegisterURL = fmt.Sprintf("%s://%s%s", c.Scheme(), c.HTTPServer.Addr, _registerURL)
 		nodes = append(nodes, n)
 	}
 	zones := make(map[string][]*Node)
@@ -34,14 +45,19 @@ func NewNodes(c *conf.Config) *Nodes {
 			n := newNode(c, addr)
 			n.otherZone = true
 			n.zone = name
-			n.pRegisterURL = fmt.Sprintf("http://%s%s", c.HTTPServer.Addr, _registerURL)
+			n.pRegisterURL = fmt.Sprintf("%s://%s%s", c.Scheme(), c.HTTPServer.Addr, _registerURL)
 			znodes = append(znodes, n)
 		}
 		zones[name] = znodes
 	}
+	lbZones := make(map[string]bool, len(c.LBZones))
+	for _, name := range c.LBZones {
+		lbZones[name] = true
+	}
 	return &Nodes{
 		nodes:    nodes,
 		zones:    zones,
+		lbZones:  lbZones,
 		selfAddr: c.HTTPServer.Addr,
 	}
 }
@@ -51,17 +67,22 @@ func (ns *Nodes) Replicate(c context.Context, action model.Action, i *model.Inst
 	if len(ns.nodes) == 0 {
 		return
 	}
-	eg, c := errgroup.WithContext(c)
+	// NOTE: errors of some nodes do not cancel the failover of other zones.
+	var eg errgroup.Group
 	for _, n := range ns.nodes {
 		if !ns.Myself(n.addr) {
-			ns.action(c, eg, action, n, i)
+			ns.action(c, &eg, action, n, i)
 		}
 	}
 	if !otherZone {
-		for _, zns := range ns.zones {
-			if n := len(zns); n > 0 {
-				ns.action(c, eg, action, zns[rand.Intn(n)], i)
-			}
+		for zone := range ns.zones {
+			zone := zone
+			eg.Go(func() error {
+				_ = ns.zoneCall(zone, func(n *Node) error {
+					return n.replicate(c, action, i)
+				})
+				return nil
+			})
 		}
 	}
 	err = eg.Wait()
@@ -69,50 +90,140 @@ func (ns *Nodes) Replicate(c context.Context, action model.Action, i *model.Inst
 }
 
 // ReplicateSet replicate set information to all nodes except for this node.
-func (ns *Nodes) ReplicateSet(c context.Context, arg *model.ArgSet, otherZone bool) (err error) {
+// The newer instances returned by nodes in conflict are returned, which are to be resolved by this node.
+func (ns *Nodes) ReplicateSet(c context.Context, arg *model.ArgSet, otherZone bool) (conflicts []*model.Instance, err error) {
+	if len(ns.nodes) == 0 {
+		return
+	}
+	var mu sync.Mutex
+	set := func(n *Node) error {
+		is, err := n.Set(c, arg)
+		if len(is) != 0 {
+			mu.Lock()
+			conflicts = append(conflicts, is...)
+			mu.Unlock()
+		}
+		// NOTE: conflicts are handled by the node.
+		if err == ecode.Conflict {
+			err = nil
+		}
+		return err
+	}
+	var eg errgroup.Group
+	for _, n := range ns.nodes {
+		if !ns.Myself(n.addr) {
+			node := n
+			eg.Go(func() error {
+				return set(node)
+			})
+		}
+	}
+	if !otherZone {
+		for zone := range ns.zones {
+			zone := zone
+			eg.Go(func() error {
+				return ns.zoneCall(zone, set)
+			})
+		}
+	}
+	err = eg.Wait()
+	return
+}
+
+// ReplicateClearOverride replicate the clear of override to all nodes except for this node.
+func (ns *Nodes) ReplicateClearOverride(c context.Context, arg *model.ArgClearOverride, otherZone bool) (err error) {
 	if len(ns.nodes) == 0 {
 		return
 	}
-	eg, c := errgroup.WithContext(c)
+	var eg errgroup.Group
 	for _, n := range ns.nodes {
 		if !ns.Myself(n.addr) {
 			node := n
 			eg.Go(func() error {
-				return node.Set(c, arg)
+				return node.ClearOverride(c, arg)
 			})
 		}
 	}
 	if !otherZone {
-		for _, zns := range ns.zones {
-			if n := len(zns); n > 0 {
-				node := zns[rand.Intn(n)]
-				eg.Go(func() error {
-					return node.Set(c, arg)
+		for zone := range ns.zones {
+			zone := zone
+			eg.Go(func() error {
+				return ns.zoneCall(zone, func(n *Node) error {
+					return n.ClearOverride(c, arg)
 				})
-			}
+			})
+		}
+	}
+	err = eg.Wait()
+	return
+}
+
+// ReplicateMember replicate the member change to all nodes except for this node.
+func (ns *Nodes) ReplicateMember(c context.Context, arg *model.ArgMember, state string, otherZone bool) (err error) {
+	if len(ns.nodes) == 0 {
+		return
+	}
+	var eg errgroup.Group
+	for _, n := range ns.nodes {
+		if !ns.Myself(n.addr) {
+			node := n
+			eg.Go(func() error {
+				return node.Member(c, arg, state)
+			})
+		}
+	}
+	if !otherZone {
+		for zone := range ns.zones {
+			zone := zone
+			eg.Go(func() error {
+				return ns.zoneCall(zone, func(n *Node) error {
+					return n.Member(c, arg, state)
+				})
+			})
 		}
 	}
 	err = eg.Wait()
 	return
 }
+
 func (ns *Nodes) action(c context.Context, eg *errgroup.Group, action model.Action, n *Node, i *model.Instance) {
-	switch action {
-	case model.Register:
-		eg.Go(func() error {
-			_ = n.Register(c, i)
-			return nil
-		})
-	case model.Renew:
-		eg.Go(func() error {
-			_ = n.Renew(c, i)
-			return nil
-		})
-	case model.Cancel:
-		eg.Go(func() error {
-			_ = n.Cancel(c, i)
-			return nil
-		})
+	eg.Go(func() error {
+		_ = n.replicate(c, action, i)
+		return nil
+	})
+}
+
+// zoneCall calls fn on the nodes of other zone one by one, until one of them handles it.
+func (ns *Nodes) zoneCall(zone string, fn func(n *Node) error) (err error) {
+	for _, n := range ns.zoneNodes(zone) {
+		if err = fn(n); !unreachable(err) {
+			return
+		}
+		log.Warn("replicate to zone(%s) node(%s) failed, try next node error(%v)", zone, n.addr, err)
 	}
+	log.Error("replicate to zone(%s) failed on all nodes error(%v)", zone, err)
+	return
+}
+
+// zoneNodes returns the nodes of other zone in the order to try, nodes which are UP come first.
+func (ns *Nodes) zoneNodes(zone string) (nodes []*Node) {
+	zns := ns.zones[zone]
+	var lost []*Node
+	for _, idx := range rand.Perm(len(zns)) {
+		if n := zns[idx]; n.Status() == model.NodeStatusUP {
+			nodes = append(nodes, n)
+		} else {
+			lost = append(lost, n)
+		}
+	}
+	nodes = append(nodes, lost...)
+	if ns.lbZones[zone] {
+		lb := nodes
+		for i := 1; i < _lbRetry; i++ {
+			nodes = append(nodes, lb...)
+		}
+	}
+	return
 }
 
 // Nodes returns nodes of local zone.
@@ -124,7 +235,8 @@ func (ns *Nodes) Nodes() (nsi []*model.Node) {
 		}
 		node := &model.Node{
 			Addr:   nd.addr,
-			Status: nd.status,
+			Scheme: nd.scheme,
+			Status: nd.Status(),
 			Zone:   nd.zone,
 		}
 		nsi = append(nsi, node)
@@ -138,17 +250,19 @@ func (ns *Nodes) AllNodes() (nsi []*model.Node) {
 	for _, nd := range ns.nodes {
 		node := &model.Node{
 			Addr:   nd.addr,
-			Status: nd.status,
+			Scheme: nd.scheme,
+			Status: nd.Status(),
 			Zone:   nd.zone,
 		}
 		nsi = append(nsi, node)
 	}
-	for _, zns := range ns.zones {
-		if n := len(zns); n > 0 {
-			nd := zns[rand.Intn(n)]
+	for zone := range ns.zones {
+		if zns := ns.zoneNodes(zone); len(zns) > 0 {
+			nd := zns[0]
 			node := &model.Node{
 				Addr:   nd.addr,
-				Status: nd.status,
+				Scheme: nd.scheme,
+				Status: nd.Status(),
 				Zone:   nd.zone,
 			}
 			nsi = append(nsi, node)
@@ -157,16 +271,77 @@ func (ns *Nodes) AllNodes() (nsi []*model.Node) {
 	return
 }
 
+// Peer returns whether host is the host of a node of any zone, hostnames of nodes are resolved.
+func (ns *Nodes) Peer(host string) bool {
+	nodes := ns.nodes
+	for _, zns := range ns.zones {
+		nodes = append(nodes[:len(nodes):len(nodes)], zns...)
+	}
+	ip := net.ParseIP(host)
+	for _, n := range nodes {
+		h, _, err := net.SplitHostPort(n.addr)
+		if err != nil {
+			h = n.addr
+		}
+		if h == host {
+			return true
+		}
+		if ip == nil || net.ParseIP(h) != nil {
+			continue
+		}
+		ips, err := net.LookupIP(h)
+		if err != nil {
+			log.Warn("lookup node(%s) error(%v)", h, err)
+			continue
+		}
+		for _, nip := range ips {
+			if nip.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Myself returns whether or not myself.
 func (ns *Nodes) Myself(addr string) bool {
 	return ns.selfAddr == addr
 }
 
+// Inherit carries the status of nodes over from old, which the nodes are rebuilt from.
+func (ns *Nodes) Inherit(old *Nodes) {
+	if old == nil {
+		return
+	}
+	status := make(map[string]model.NodeStatus)
+	for _, nd := range old.nodes {
+		status[nd.scheme+"://"+nd.addr] = nd.Status()
+	}
+	for _, zns := range old.zones {
+		for _, nd := range zns {
+			status[nd.scheme+"://"+nd.addr] = nd.Status()
+		}
+	}
+	inherit := func(nd *Node) {
+		if s, ok := status[nd.scheme+"://"+nd.addr]; ok {
+			nd.setStatus(s)
+		}
+	}
+	for _, nd := range ns.nodes {
+		inherit(nd)
+	}
+	for _, zns := range ns.zones {
+		for _, nd := range zns {
+			inherit(nd)
+		}
+	}
+}
+
 // UP marks status of myself node up.
 func (ns *Nodes) UP() {
 	for _, nd := range ns.nodes {
 		if ns.Myself(nd.addr) {
-			nd.status = model.NodeStatusUP
+			nd.setStatus(model.NodeStatusUP)
 		}
 	}
 }
@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bilibili/discovery/model"
+)
+
+// _overrideTTL is how long overrides of instances not registered and tombstones of cleared overrides are kept.
+const _overrideTTL = 24 * time.Hour
+
+func overrideKey(appid, env, id string) string {
+	return appsKey(appid, env) + "/" + id
+}
+
+// override applies the override of operator on the instance to register.
+func (r *Registry) override(i *model.Instance) {
+	r.oLock.RLock()
+	o, ok := r.overrides[overrideKey(i.AppID, i.Env, i.ID())]
+	r.oLock.RUnlock()
+	if ok && !o.Cleared {
+		o.Apply(i)
+	}
+}
+
+// setOverrides keeps the changes of set as the overrides of instances.
+func (r *Registry) setOverrides(arg *model.ArgSet) (err error) {
+	r.oLock.Lock()
+	defer r.oLock.Unlock()
+	ids := arg.IDs()
+	for n, id := range ids {
+		key := overrideKey(arg.AppID, arg.Env, id)
+		o, ok := r.overrides[key]
+		if ok && (o.UpdateTimestamp > arg.SetTimestamp || o.Cleared && o.UpdateTimestamp == arg.SetTimestamp) {
+			// NOTE: the override is set or cleared after this set, the clear wins on the same timestamp.
+			continue
+		}
+		if !ok || o.Cleared {
+			o = &model.Override{AppID: arg.AppID, Env: arg.Env, InstanceID: id}
+			if len(arg.Hostname) == len(ids) {
+				o.Hostname = arg.Hostname[n]
+			}
+		}
+		if o, err = o.Patch(arg, n); err != nil {
+			return
+		}
+		r.overrides[key] = o
+	}
+	return
+}
+
+// Overrides returns the overrides of appid and env sorted by key, all if empty. Tombstones of cleared overrides
+// are returned only if cleared is true.
+func (r *Registry) Overrides(appid, env string, cleared bool) (os []*model.Override) {
+	r.oLock.RLock()
+	keys := make([]string, 0, len(r.overrides))
+	for key, o := range r.overrides {
+		if (appid == "" || o.AppID == appid) && (env == "" || o.Env == env) && (cleared || !o.Cleared) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	os = make([]*model.Override, 0, len(keys))
+	for _, key := range keys {
+		os = append(os, r.overrides[key])
+	}
+	r.oLock.RUnlock()
+	return
+}
+
+// ClearOverride clears the override of instance id at ts, which restores the status and metadata registered
+// unless they are set after ts. A tombstone is kept for _overrideTTL, so that the override set before ts is
+// not taken again from peers. It returns whether the override is found.
+func (r *Registry) ClearOverride(appid, env, id string, ts int64) (ok bool) {
+	key := overrideKey(appid, env, id)
+	r.clock.Update(ts)
+	r.oLock.Lock()
+	o, exist := r.overrides[key]
+	if exist && o.UpdateTimestamp > ts {
+		// NOTE: the override is set again after this clear.
+		r.oLock.Unlock()
+		return
+	}
+	ok = exist && !o.Cleared
+	r.overrides[key] = &model.Override{AppID: appid, Env: env, InstanceID: id, UpdateTimestamp: ts, Cleared: true}
+	r.oLock.Unlock()
+	as, _, _ := r.apps(appid, env, "")
+	for _, a := range as {
+		if !a.Restore(id, ts) {
+			continue
+		}
+		if i, ok := a.Instance(id); ok {
+			r.feed.add(model.ChangeSet, i)
+		}
+		r.broadcast(env, appid)
+	}
+	return
+}
+
+// SyncOverrides stores the overrides and tombstones synced from peers, unless newer ones exist.
+func (r *Registry) SyncOverrides(os []*model.Override) {
+	r.oLock.Lock()
+	for _, o := range os {
+		key := overrideKey(o.AppID, o.Env, o.ID())
+		if old, ok := r.overrides[key]; !ok || old.UpdateTimestamp < o.UpdateTimestamp || old.UpdateTimestamp == o.UpdateTimestamp && o.Cleared {
+			r.overrides[key] = o
+		}
+	}
+	r.oLock.Unlock()
+}
+
+// gcOverrides removes the overrides of instances not registered for _overrideTTL, e.g. cancelled or evicted,
+// and the tombstones cleared before _overrideTTL.
+func (r *Registry) gcOverrides() {
+	now := r.clock.Now()
+	r.oLock.RLock()
+	os := make(map[string]*model.Override, len(r.overrides))
+	for key, o := range r.overrides {
+		os[key] = o
+	}
+	r.oLock.RUnlock()
+	var dels []string
+	for key, o := range os {
+		if o.Cleared {
+			if now-o.UpdateTimestamp > int64(_overrideTTL) {
+				dels = append(dels, key)
+			}
+			continue
+		}
+		if r.registered(o.AppID, o.Env, o.ID()) {
+			delete(r.orphans, key)
+			continue
+		}
+		if since, ok := r.orphans[key]; !ok {
+			r.orphans[key] = now
+		} else if now-since > int64(_overrideTTL) {
+			dels = append(dels, key)
+		}
+	}
+	r.oLock.Lock()
+	for _, key := range dels {
+		// NOTE: keep the override set or cleared again during gc.
+		if o, ok := r.overrides[key]; ok && o == os[key] {
+			delete(r.overrides, key)
+		}
+		delete(r.orphans, key)
+	}
+	r.oLock.Unlock()
+}
+
+// registered returns whether instance id of appid and env is registered in any zone.
+func (r *Registry) registered(appid, env, id string) bool {
+	as, _, _ := r.apps(appid, env, "")
+	for _, a := range as {
+		if _, ok := a.Instance(id); ok {
+			return true
+		}
+	}
+	return false
+}
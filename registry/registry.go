@@ -3,7 +3,9 @@ package registry
 import (
 	"fmt"
 	"math/rand"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bilibili/discovery/conf"
@@ -16,22 +18,32 @@ import (
 const (
 	_evictThreshold = int64(90 * time.Second)
 	_evictCeiling   = int64(3600 * time.Second)
+	_syncPageSize   = 500
 )
 
 // Registry handles replication of all operations to peer Discovery nodes to keep them all in sync.
 type Registry struct {
 	appm  map[string]*model.Apps // appid-env -> apps
 	aLock sync.RWMutex
+	// deleted is the latest timestamp of the apps deleted from appm.
+	deleted int64
 
 	conns     map[string]*hosts // region.zone.env.appid-> host
 	cLock     sync.RWMutex
 	scheduler *scheduler
 	gd        *Guard
+	clock     *clock
+	feed      *feed
+	limit     atomic.Value // *model.MetadataLimit
+
+	overrides map[string]*model.Override // appid-env/instance id -> override
+	oLock     sync.RWMutex
+	orphans   map[string]int64 // override key -> since when the instance is not registered, only used by gc
 }
 
 type hosts struct {
 	hclock sync.RWMutex
-	hosts  map[string]*conn // host name to conn
+	hosts  map[string]*conn // instance id to conn
 }
 
 // conn the poll chan contains consumer.
@@ -50,10 +62,16 @@ func newConn(ch chan map[string]*model.InstanceInfo, latestTime int64, arg *mode
 // NewRegistry new register.
 func NewRegistry(conf *conf.Config) (r *Registry) {
 	r = &Registry{
-		appm:  make(map[string]*model.Apps),
-		conns: make(map[string]*hosts),
-		gd:    new(Guard),
+		appm:      make(map[string]*model.Apps),
+		conns:     make(map[string]*hosts),
+		overrides: make(map[string]*model.Override),
+		orphans:   make(map[string]int64),
+		gd:        new(Guard),
+		clock:     newClock(),
 	}
+	r.feed = newFeed(conf.FeedSize, r.clock.Now())
+	r.gd.setThreshold(conf.ProtectThreshold)
+	r.SetMetadataLimit(conf.MetadataKeys, conf.MetadataSize)
 	r.scheduler = newScheduler(r)
 	r.scheduler.Load()
 	go r.scheduler.Reload()
@@ -87,19 +105,30 @@ func appsKey(appid, env string) string {
 	return fmt.Sprintf("%s-%s", appid, env)
 }
 
-func (r *Registry) newApp(ins *model.Instance) (a *model.App) {
+func (r *Registry) newApp(ins *model.Instance, latestTime int64) (a *model.App) {
 	as, _ := r.newapps(ins.AppID, ins.Env)
-	a, _ = as.NewApp(ins.Zone, ins.AppID, ins.LatestTimestamp)
+	a, _ = as.NewApp(ins.Zone, ins.AppID, latestTime)
 	return
 }
 
+// Now returns a timestamp of the hybrid logical clock of registry.
+func (r *Registry) Now() int64 {
+	return r.clock.Now()
+}
+
 // Register a new instance.
 func (r *Registry) Register(ins *model.Instance, latestTime int64) (err error) {
-	a := r.newApp(ins)
+	// NOTE: merge the timestamps carried by replication, then stamp this change by local clock.
+	r.clock.Update(ins.DirtyTimestamp)
+	r.clock.Update(latestTime)
+	latestTime = r.clock.Now()
+	r.override(ins)
+	a := r.newApp(ins, latestTime)
 	i, ok := a.NewInstance(ins, latestTime)
 	if ok {
 		r.gd.incrExp()
 	}
+	r.feed.add(model.ChangeRegister, i)
 	// NOTE: make sure free poll before update appid latest timestamp.
 	r.broadcast(i.Env, i.AppID)
 	return
@@ -111,7 +140,8 @@ func (r *Registry) Renew(arg *model.ArgRenew) (i *model.Instance, ok bool) {
 	if len(a) == 0 {
 		return
 	}
-	if i, ok = a[0].Renew(arg.Hostname); !ok {
+	r.clock.Update(arg.DirtyTimestamp)
+	if i, ok = a[0].Renew(arg.ID(), r.clock.Now()); !ok {
 		return
 	}
 	r.gd.incrFac()
@@ -120,20 +150,21 @@ func (r *Registry) Renew(arg *model.ArgRenew) (i *model.Instance, ok bool) {
 
 // Cancel cancels the registration of an instance.
 func (r *Registry) Cancel(arg *model.ArgCancel) (i *model.Instance, ok bool) {
-	if i, ok = r.cancel(arg.Zone, arg.Env, arg.AppID, arg.Hostname, arg.LatestTimestamp); !ok {
+	r.clock.Update(arg.LatestTimestamp)
+	if i, ok = r.cancel(arg.Zone, arg.Env, arg.AppID, arg.ID(), r.clock.Now(), model.ChangeCancel); !ok {
 		return
 	}
 	r.gd.decrExp()
 	return
 }
 
-func (r *Registry) cancel(zone, env, appid, hostname string, latestTime int64) (i *model.Instance, ok bool) {
+func (r *Registry) cancel(zone, env, appid, id string, latestTime int64, action string) (i *model.Instance, ok bool) {
 	var l int
 	a, as, _ := r.apps(appid, env, zone)
 	if len(a) == 0 {
 		return
 	}
-	if i, l, ok = a[0].Cancel(hostname, latestTime); !ok {
+	if i, l, ok = a[0].Cancel(id, latestTime); !ok {
 		return
 	}
 	as.UpdateLatest(latestTime)
@@ -145,8 +176,12 @@ func (r *Registry) cancel(zone, env, appid, hostname string, latestTime int64) (
 	if len(as.App("")) == 0 {
 		r.aLock.Lock()
 		delete(r.appm, appsKey(appid, env))
+		if lts := as.LatestTimestamp(); lts > r.deleted {
+			r.deleted = lts
+		}
 		r.aLock.Unlock()
 	}
+	r.feed.add(action, i)
 	r.broadcast(env, appid) // NOTE: make sure free poll before update appid latest timestamp.
 	return
 }
@@ -163,6 +198,115 @@ func (r *Registry) FetchAll() (im map[string][]*model.Instance) {
 	return
 }
 
+// Schedulers returns the scheduler info of all apps.
+func (r *Registry) Schedulers() []*model.Scheduler {
+	return r.scheduler.All()
+}
+
+// SyncApps returns the summaries of at most ps apps after cursor, used by peers to sync registry page by page.
+func (r *Registry) SyncApps(cursor string, ps int) (res *model.SyncApps) {
+	if ps <= 0 {
+		ps = _syncPageSize
+	}
+	r.aLock.RLock()
+	keys := make([]string, 0, len(r.appm))
+	for key := range r.appm {
+		keys = append(keys, key)
+	}
+	r.aLock.RUnlock()
+	sort.Strings(keys)
+	res = &model.SyncApps{Total: len(keys)}
+	idx := sort.SearchStrings(keys, cursor)
+	if idx < len(keys) && keys[idx] == cursor {
+		idx++
+	}
+	for ; idx < len(keys) && len(res.Apps) < ps; idx++ {
+		r.aLock.RLock()
+		as, ok := r.appm[keys[idx]]
+		r.aLock.RUnlock()
+		if !ok {
+			continue
+		}
+		is := appInstances(as)
+		if len(is) == 0 {
+			continue
+		}
+		res.Apps = append(res.Apps, &model.AppSummary{
+			AppID:    is[0].AppID,
+			Env:      is[0].Env,
+			Count:    len(is),
+			Checksum: model.Checksum(is),
+		})
+	}
+	if idx < len(keys) {
+		res.Cursor = keys[idx-1]
+	}
+	return
+}
+
+// SyncApp returns all instances of the app with their checksum.
+func (r *Registry) SyncApp(appid, env string) (res *model.SyncApp, err error) {
+	r.aLock.RLock()
+	as, ok := r.appm[appsKey(appid, env)]
+	r.aLock.RUnlock()
+	if !ok {
+		err = ecode.NothingFound
+		return
+	}
+	is := appInstances(as)
+	res = &model.SyncApp{
+		Instances: is,
+		Checksum:  model.Checksum(is),
+	}
+	return
+}
+
+// Services returns the instances of the apps in env and zone keyed by appid, zone is ignored if empty.
+// The latest timestamp of the apps, including the deleted ones, is returned for change detection.
+func (r *Registry) Services(env, zone string) (apps map[string][]*model.Instance, latest int64) {
+	apps = make(map[string][]*model.Instance)
+	r.aLock.RLock()
+	appm := make(map[string]*model.Apps, len(r.appm))
+	for key, as := range r.appm {
+		appm[key] = as
+	}
+	latest = r.deleted
+	r.aLock.RUnlock()
+	for key, as := range appm {
+		all := as.App("")
+		if len(all) == 0 || key != appsKey(all[0].AppID, env) {
+			continue
+		}
+		if lts := as.LatestTimestamp(); lts > latest {
+			latest = lts
+		}
+		for _, a := range as.App(zone) {
+			if is := a.Instances(); len(is) != 0 {
+				apps[a.AppID] = append(apps[a.AppID], is...)
+			}
+		}
+	}
+	return
+}
+
+// Removed returns the instances of env cancelled or evicted after ts, which are kept by the change feed.
+// NOTE: instances registered again are returned too, changes dropped by the feed are not.
+func (r *Registry) Removed(env string, ts int64) (is []*model.Instance) {
+	for _, i := range r.feed.removed(ts) {
+		if i.Env == env {
+			is = append(is, i)
+		}
+	}
+	return
+}
+
+func appInstances(as *model.Apps) (is []*model.Instance) {
+	for _, a := range as.App("") {
+		is = append(is, a.Instances()...)
+	}
+	return
+}
+
 // Fetch fetch all instances by appid.
 func (r *Registry) Fetch(zone, env, appid string, latestTime int64, status uint32) (info *model.InstanceInfo, err error) {
 	key := appsKey(appid, env)
@@ -220,21 +364,21 @@ func (r *Registry) Polls(arg *model.ArgPolls) (ch chan map[string]*model.Instanc
 		r.cLock.Unlock()
 
 		hosts.hclock.Lock()
-		connection, ok := hosts.hosts[arg.Hostname]
+		connection, ok := hosts.hosts[arg.ID()]
 		if !ok {
 			if ch == nil {
-				ch = make(chan map[string]*model.InstanceInfo, 5) // NOTE: there maybe have more than one connection on the same hostname!!!
+				ch = make(chan map[string]*model.InstanceInfo, 5) // NOTE: there maybe have more than one connection on the same instance id!!!
 			}
 			connection = newConn(ch, arg.LatestTimestamp[i], arg)
-			log.Info("Polls from(%s) new connection(%d)", arg.Hostname, connection.count)
+			log.Info("Polls from(%s) new connection(%d)", arg.ID(), connection.count)
 		} else {
-			connection.count++ // NOTE: there maybe have more than one connection on the same hostname!!!
+			connection.count++ // NOTE: there maybe have more than one connection on the same instance id!!!
 			if ch == nil {
 				ch = connection.ch
 			}
-			log.Info("Polls from(%s) reuse connection(%d)", arg.Hostname, connection.count)
+			log.Info("Polls from(%s) reuse connection(%d)", arg.ID(), connection.count)
 		}
-		hosts.hosts[arg.Hostname] = connection
+		hosts.hosts[arg.ID()] = connection
 		hosts.hclock.Unlock()
 	}
 	return
@@ -263,9 +407,9 @@ func (r *Registry) broadcast(env, appid string) {
 		for i := 0; i < conn.count; i++ {
 			select {
 			case conn.ch <- map[string]*model.InstanceInfo{appid: ii}: // NOTE: if chan is full, means no poller.
-				log.Info("broadcast to(%s) success(%d)", conn.arg.Hostname, i+1)
+				log.Info("broadcast to(%s) success(%d)", conn.arg.ID(), i+1)
 			case <-time.After(time.Millisecond * 500):
-				log.Info("broadcast to(%s) failed(%d) maybe chan full", conn.arg.Hostname, i+1)
+				log.Info("broadcast to(%s) failed(%d) maybe chan full", conn.arg.ID(), i+1)
 			}
 		}
 	}
@@ -276,19 +420,52 @@ func pollKey(env, appid string) string {
 	return fmt.Sprintf("%s.%s", env, appid)
 }
 
-// Set Set the metadata  of instance by hostnames.
-func (r *Registry) Set(arg *model.ArgSet) (ok bool) {
+// Set Set the metadata  of instance by instance ids, hostnames if ids are not given.
+// If arg is older than the instances, ecode.Conflict is returned with the current instances, see model.App.Set.
+func (r *Registry) Set(arg *model.ArgSet) (conflicts []*model.Instance, err error) {
 	a, _, _ := r.apps(arg.AppID, arg.Env, arg.Zone)
 	if len(a) == 0 {
+		err = ecode.NothingFound
 		return
 	}
-	if ok = a[0].Set(arg); !ok {
+	r.clock.Update(arg.SetTimestamp)
+	// NOTE: replications in conflict apply the fields which are not stale.
+	if conflicts, err = a[0].Set(arg, r.MetadataLimit()); err != nil && (err != ecode.Conflict || !arg.Replication) {
 		return
 	}
+	if arg.Override {
+		if e := r.setOverrides(arg); e != nil {
+			log.Error("set overrides appid(%s) env(%s) instance(%v) error(%v)", arg.AppID, arg.Env, arg.IDs(), e)
+		}
+	}
+	for _, id := range arg.IDs() {
+		if i, ok := a[0].Instance(id); ok {
+			r.feed.add(model.ChangeSet, i)
+		}
+	}
 	r.broadcast(arg.Env, arg.AppID)
 	return
 }
 
+// Resolve takes the status and metadata of instances which win over the local ones, e.g. the conflicts
+// returned by peers on replication of set.
+func (r *Registry) Resolve(is []*model.Instance) {
+	for _, i := range is {
+		a, _, _ := r.apps(i.AppID, i.Env, i.Zone)
+		if len(a) == 0 {
+			continue
+		}
+		r.clock.Update(i.DirtyTimestamp)
+		if !a[0].Resolve(i, r.clock.Now()) {
+			continue
+		}
+		if ni, ok := a[0].Instance(i.ID()); ok {
+			r.feed.add(model.ChangeSet, ni)
+		}
+		r.broadcast(i.Env, i.AppID)
+	}
+}
+
 func (r *Registry) allapp() (ass []*model.Apps) {
 	r.aLock.RLock()
 	ass = make([]*model.Apps, 0, len(r.appm))
@@ -299,6 +476,37 @@ func (r *Registry) allapp() (ass []*model.Apps) {
 	return
 }
 
+// Size returns the number of apps and instances in registry.
+func (r *Registry) Size() (apps, instances int) {
+	for _, p := range r.allapp() {
+		apps++
+		for _, a := range p.App("") {
+			instances += a.Len()
+		}
+	}
+	return
+}
+
+// SetProtectThreshold sets the percent of expected renews below which eviction stops.
+func (r *Registry) SetProtectThreshold(threshold float64) {
+	r.gd.setThreshold(threshold)
+}
+
+// SetMetadataLimit sets the max number of keys and total size of the metadata of an instance, no limit if zero.
+func (r *Registry) SetMetadataLimit(keys, size int) {
+	r.limit.Store(&model.MetadataLimit{Keys: keys, Size: size})
+}
+
+// MetadataLimit returns the limit of metadata.
+func (r *Registry) MetadataLimit() *model.MetadataLimit {
+	return r.limit.Load().(*model.MetadataLimit)
+}
+
+// SelfPreservation returns whether eviction is stopped because renews are less than expected.
+func (r *Registry) SelfPreservation() bool {
+	return r.gd.protected()
+}
+
 // reset expect renews, count the renew of all app, one app has two expect remews in minute.
 func (r *Registry) resetExp() {
 	cnt := int64(0)
@@ -318,6 +526,7 @@ func (r *Registry) proc() {
 		case <-tk:
 			r.gd.updateFac()
 			r.evict()
+			r.gcOverrides()
 		case <-tk2:
 			r.resetExp()
 		}
@@ -333,12 +542,13 @@ func (r *Registry) evict() {
 	var registrySize int
 	// all projects
 	ass := r.allapp()
+	now := r.clock.Now()
 	for _, as := range ass {
 		for _, a := range as.App("") {
 			registrySize += a.Len()
 			is := a.Instances()
 			for _, i := range is {
-				delta := time.Now().UnixNano() - i.RenewTimestamp
+				delta := now - i.RenewTimestamp
 				if (!protect && delta > _evictThreshold) || delta > _evictCeiling {
 					eis = append(eis, i)
 				}
@@ -361,10 +571,16 @@ func (r *Registry) evict() {
 		next := i + rand.Intn(len(eis)-i)
 		eis[i], eis[next] = eis[next], eis[i]
 		ei := eis[i]
-		r.cancel(ei.Zone, ei.Env, ei.AppID, ei.Hostname, time.Now().UnixNano())
+		r.cancel(ei.Zone, ei.Env, ei.AppID, ei.ID(), r.clock.Now(), model.ChangeEvict)
 	}
 }
 
+// Changes returns at most ps changes of registry after cursor, and a channel closed on the next change.
+// The current cursor is returned if cursor is negative, and ecode.NothingFound if changes after cursor are dropped.
+func (r *Registry) Changes(cursor int64, ps int) (cs *model.Changes, notify <-chan struct{}, err error) {
+	return r.feed.since(cursor, ps)
+}
+
 // DelConns delete conn of host in appid
 func (r *Registry) DelConns(arg *model.ArgPolls) {
 	for i := range arg.AppID {
@@ -377,13 +593,13 @@ func (r *Registry) DelConns(arg *model.ArgPolls) {
 			continue
 		}
 		conns.hclock.Lock()
-		if connection, ok := conns.hosts[arg.Hostname]; ok {
+		if connection, ok := conns.hosts[arg.ID()]; ok {
 			if connection.count > 1 {
-				log.Info("DelConns from(%s) count decr(%d)", arg.Hostname, connection.count)
+				log.Info("DelConns from(%s) count decr(%d)", arg.ID(), connection.count)
 				connection.count--
 			} else {
-				log.Info("DelConns from(%s) delete(%d)", arg.Hostname, connection.count)
-				delete(conns.hosts, arg.Hostname)
+				log.Info("DelConns from(%s) delete(%d)", arg.ID(), connection.count)
+				delete(conns.hosts, arg.ID())
 			}
 		}
 		conns.hclock.Unlock()
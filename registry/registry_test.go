@@ -132,6 +132,93 @@ func TestFetchAll(t *testing.T) {
 	})
 }
 
+func TestSyncApps(t *testing.T) {
+	r := register(t, model.NewInstance(reg), model.NewInstance(regH1), model.NewInstance(reg2))
+	Convey("test sync apps page by page", t, func() {
+		page := r.SyncApps("", 1)
+		So(page.Total, ShouldEqual, 2)
+		So(len(page.Apps), ShouldEqual, 1)
+		So(page.Apps[0].AppID, ShouldEqual, "main.arch.test")
+		So(page.Apps[0].Count, ShouldEqual, 2)
+		So(page.Cursor, ShouldNotBeEmpty)
+		app, err := r.SyncApp(page.Apps[0].AppID, page.Apps[0].Env)
+		So(err, ShouldBeNil)
+		So(len(app.Instances), ShouldEqual, 2)
+		So(model.Checksum(app.Instances), ShouldEqual, page.Apps[0].Checksum)
+		page = r.SyncApps(page.Cursor, 1)
+		So(len(page.Apps), ShouldEqual, 1)
+		So(page.Apps[0].AppID, ShouldEqual, "main.arch.test2")
+		So(page.Cursor, ShouldBeEmpty)
+		_, err = r.SyncApp("main.arch.none", "pre")
+		So(err, ShouldEqual, ecode.NothingFound)
+	})
+}
+
+func TestServices(t *testing.T) {
+	r := register(t, model.NewInstance(reg), model.NewInstance(regH1), model.NewInstance(reg2))
+	Convey("test services of env and zone", t, func() {
+		apps, latest := r.Services("pre", "")
+		So(len(apps), ShouldEqual, 2)
+		So(len(apps["main.arch.test"]), ShouldEqual, 2)
+		So(len(apps["main.arch.test2"]), ShouldEqual, 1)
+		So(latest, ShouldBeGreaterThan, 0)
+		apps, _ = r.Services("pre", "sh0002")
+		So(len(apps), ShouldEqual, 0)
+		apps, _ = r.Services("prod", "")
+		So(len(apps), ShouldEqual, 0)
+		r.Cancel(&model.ArgCancel{Zone: "sh0001", Env: "pre", AppID: "main.arch.test2", Hostname: "reg2"})
+		apps, latest2 := r.Services("pre", "")
+		So(len(apps), ShouldEqual, 1)
+		So(latest2, ShouldBeGreaterThan, latest)
+	})
+}
+
+func TestChanges(t *testing.T) {
+	Convey("test change feed", t, func() {
+		r := NewRegistry(&conf.Config{FeedSize: 3})
+		cs, notify, err := r.Changes(-1, 0)
+		So(err, ShouldBeNil)
+		So(len(cs.Changes), ShouldEqual, 0)
+		cursor := cs.Cursor
+		So(r.Register(model.NewInstance(reg), 0), ShouldBeNil)
+		select {
+		case <-notify:
+		default:
+			t.Fatal("notify not closed by change")
+		}
+		_, err = r.Set(&model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"reg"}, Status: []int64{2}, SetTimestamp: r.Now()})
+		So(err, ShouldBeNil)
+		r.Cancel(cancel)
+		cs, _, err = r.Changes(cursor, 2)
+		So(err, ShouldBeNil)
+		So(len(cs.Changes), ShouldEqual, 2)
+		So(cs.Changes[0].Action, ShouldEqual, model.ChangeRegister)
+		So(cs.Changes[1].Action, ShouldEqual, model.ChangeSet)
+		So(cs.Changes[1].Instance.Status, ShouldEqual, model.InstancestatusWating)
+		So(cs.More, ShouldBeTrue)
+		cs, _, err = r.Changes(cs.Cursor, 2)
+		So(err, ShouldBeNil)
+		So(len(cs.Changes), ShouldEqual, 1)
+		So(cs.Changes[0].Action, ShouldEqual, model.ChangeCancel)
+		So(cs.More, ShouldBeFalse)
+		removed := r.Removed("pre", 0)
+		So(len(removed), ShouldEqual, 1)
+		So(removed[0].ID(), ShouldEqual, "reg")
+		So(len(r.Removed("pre", removed[0].LatestTimestamp)), ShouldEqual, 0)
+		So(len(r.Removed("prod", 0)), ShouldEqual, 0)
+		last := cs.Cursor
+		cs, _, err = r.Changes(last, 0)
+		So(err, ShouldBeNil)
+		So(len(cs.Changes), ShouldEqual, 0)
+		So(cs.Cursor, ShouldEqual, last)
+		So(r.Register(model.NewInstance(reg), 0), ShouldBeNil)
+		_, _, err = r.Changes(cursor, 0)
+		So(err, ShouldEqual, ecode.NothingFound)
+		_, _, err = r.Changes(last+2, 0)
+		So(err, ShouldEqual, ecode.NothingFound)
+	})
+}
+
 func BenchmarkFetchAll(b *testing.B) {
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
@@ -323,12 +410,12 @@ func BenchmarkBroadcast(b *testing.B) {
 func TestSet(t *testing.T) {
 	i := model.NewInstance(reg)
 	r := register(t, i)
-	changes := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test"}
+	changes := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", SetTimestamp: time.Now().UnixNano()}
 	changes.Hostname = []string{"reg"}
 	changes.Status = []int64{1}
 	Convey("test setstatus to 1", t, func() {
-		ok := r.Set(changes)
-		So(ok, ShouldBeTrue)
+		_, err := r.Set(changes)
+		So(err, ShouldBeNil)
 		fetchArg := &model.ArgFetch{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Status: 3}
 		c, err := r.Fetch(fetchArg.Zone, fetchArg.Env, fetchArg.AppID, 0, fetchArg.Status)
 		So(err, ShouldBeNil)
@@ -336,12 +423,12 @@ func TestSet(t *testing.T) {
 	})
 	changes = &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test"}
 	changes.Hostname = []string{"reg"}
-	changes = &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test"}
+	changes = &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", SetTimestamp: time.Now().UnixNano()}
 	changes.Hostname = []string{"reg"}
 	changes.Metadata = []string{`{"weight":"11"}`}
 	Convey("test set metadata weight to 11", t, func() {
-		ok := r.Set(changes)
-		So(ok, ShouldBeTrue)
+		_, err := r.Set(changes)
+		So(err, ShouldBeNil)
 		fetchArg := &model.ArgFetch{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Status: 3}
 		c, err := r.Fetch(fetchArg.Zone, fetchArg.Env, fetchArg.AppID, 0, fetchArg.Status)
 		So(err, ShouldBeNil)
@@ -349,12 +436,12 @@ func TestSet(t *testing.T) {
 	})
 	i1 := model.NewInstance(regH1)
 	_ = r.Register(i1, 0)
-	changes = &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test"}
+	changes = &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", SetTimestamp: time.Now().UnixNano()}
 	changes.Hostname = []string{"reg", "regH1"}
 	changes.Metadata = []string{`{"weight":"12"}`, `{"weight":"13"}`}
 	Convey("test set multi instance's color to blue and metadata weight to 12", t, func() {
-		ok := r.Set(changes)
-		So(ok, ShouldBeTrue)
+		_, err := r.Set(changes)
+		So(err, ShouldBeNil)
 		fetchArg := &model.ArgFetch{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Status: 3}
 		c, err := r.Fetch(fetchArg.Zone, fetchArg.Env, fetchArg.AppID, 0, fetchArg.Status)
 		So(err, ShouldBeNil)
@@ -366,6 +453,295 @@ func TestSet(t *testing.T) {
 			}
 		}
 	})
+	stale := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", SetTimestamp: changes.SetTimestamp - 1}
+	stale.Hostname = []string{"reg"}
+	stale.Metadata = []string{`{"weight":"1"}`}
+	Convey("test set older than instance conflict", t, func() {
+		conflicts, err := r.Set(stale)
+		So(err, ShouldResemble, ecode.Conflict)
+		So(len(conflicts), ShouldEqual, 1)
+		So(conflicts[0].Metadata["weight"], ShouldResemble, "12")
+		So(conflicts[0].DirtyTimestamp, ShouldEqual, changes.SetTimestamp)
+	})
+	v2 := &model.ArgSetV2{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hosts: []*model.HostSetV2{
+		{Hostname: "reg", Status: 2},
+		{Hostname: "regH1", Metadata: map[string]string{"weight": "14"}},
+	}}
+	Convey("test set per host changes of v2, unset fields unchanged", t, func() {
+		changes := v2.ArgSet()
+		changes.SetTimestamp = time.Now().UnixNano()
+		So(changes.Status, ShouldResemble, []int64{2, 0})
+		So(changes.Metadata, ShouldResemble, []string{"", `{"weight":"14"}`})
+		_, err := r.Set(changes)
+		So(err, ShouldBeNil)
+		c, err := r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+		So(err, ShouldBeNil)
+		for _, ins := range c.Instances["sh0001"] {
+			if ins.Hostname == "reg" {
+				So(ins.Status, ShouldEqual, 2)
+				So(ins.Metadata["weight"], ShouldResemble, "12")
+			} else if ins.Hostname == "regH1" {
+				So(ins.Status, ShouldEqual, 1)
+				So(ins.Metadata["weight"], ShouldResemble, "14")
+			}
+		}
+	})
+}
+
+func TestSetConverge(t *testing.T) {
+	i1, i2 := model.NewInstance(reg), model.NewInstance(reg)
+	i2.DirtyTimestamp = i1.DirtyTimestamp
+	r1, r2 := register(t, i1), register(t, i2)
+	base := i1.DirtyTimestamp
+	set := func(r *Registry, ts int64, status int64, md string) (arg *model.ArgSet) {
+		arg = &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"reg"}, SetTimestamp: base + ts}
+		if status != 0 {
+			arg.Status = []int64{status}
+		}
+		if md != "" {
+			arg.Metadata = []string{md}
+		}
+		_, err := r.Set(arg)
+		So(err, ShouldBeNil)
+		return
+	}
+	replicate := func(r *Registry, arg *model.ArgSet) (conflicts []*model.Instance, err error) {
+		ra := *arg
+		ra.Replication = true
+		return r.Set(&ra)
+	}
+	get := func(r *Registry) *model.Instance {
+		c, err := r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+		So(err, ShouldBeNil)
+		return c.Instances["sh0001"][0]
+	}
+	Convey("test replicas converge whatever the order of sets", t, func() {
+		a1 := set(r1, 10, 0, `{"a":"1"}`)
+		a2 := set(r2, 20, 2, "")
+		a3 := set(r2, 30, 0, `{"b":"2"}`)
+		_, err := replicate(r1, a3)
+		So(err, ShouldBeNil)
+		_, err = replicate(r1, a2)
+		So(err, ShouldBeNil)
+		conflicts, err := replicate(r2, a1)
+		So(err, ShouldResemble, ecode.Conflict)
+		So(conflicts[0].Metadata, ShouldResemble, map[string]string{"b": "2"})
+		r1.Resolve(conflicts)
+		for _, r := range []*Registry{r1, r2} {
+			i := get(r)
+			So(i.Status, ShouldEqual, model.InstancestatusWating)
+			So(i.StatusTimestamp, ShouldEqual, base+20)
+			So(i.Metadata, ShouldResemble, map[string]string{"b": "2"})
+			So(i.MetadataTimestamp, ShouldEqual, base+30)
+		}
+	})
+	Convey("test sets of the same timestamp are broken by value", t, func() {
+		a4 := set(r1, 50, 1, "")
+		a5 := set(r2, 50, 2, "")
+		_, err := replicate(r1, a5)
+		So(err, ShouldBeNil)
+		_, err = replicate(r2, a4)
+		So(err, ShouldResemble, ecode.Conflict)
+		So(get(r1).Status, ShouldEqual, model.InstancestatusWating)
+		So(get(r2).Status, ShouldEqual, model.InstancestatusWating)
+	})
+	Convey("test conflicts of peers resolve lost replications", t, func() {
+		set(r2, 60, 0, `{"c":"3"}`)
+		a7 := set(r1, 40, 0, `{"d":"4"}`)
+		conflicts, err := replicate(r2, a7)
+		So(err, ShouldResemble, ecode.Conflict)
+		r1.Resolve(conflicts)
+		So(get(r1).Metadata, ShouldResemble, map[string]string{"b": "2", "c": "3"})
+		So(get(r1).Metadata, ShouldResemble, get(r2).Metadata)
+	})
+	Convey("test registration keeps the fields set after it", t, func() {
+		ni := model.NewInstance(reg)
+		ni.DirtyTimestamp = base + 55
+		So(r1.Register(ni, 0), ShouldBeNil)
+		i := get(r1)
+		So(i.Status, ShouldEqual, model.InstanceStatusUP)
+		So(i.Metadata, ShouldResemble, map[string]string{"b": "2", "c": "3"})
+	})
+}
+
+func TestOverride(t *testing.T) {
+	r := register(t, model.NewInstance(reg))
+	Convey("test override survives registration", t, func() {
+		arg := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"reg"},
+			Status: []int64{2}, Metadata: []string{`{"weight":"20"}`}, Override: true, SetTimestamp: r.Now()}
+		_, err := r.Set(arg)
+		So(err, ShouldBeNil)
+		os := r.Overrides("main.arch.test", "", false)
+		So(len(os), ShouldEqual, 1)
+		So(os[0].Status, ShouldEqual, model.InstancestatusWating)
+		So(os[0].Metadata, ShouldResemble, map[string]string{"weight": "20"})
+		ri := model.NewInstance(reg)
+		ri.Metadata = map[string]string{"weight": "5", "color": "red"}
+		So(r.Register(ri, 0), ShouldBeNil)
+		c, err := r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+		So(err, ShouldBeNil)
+		i := c.Instances["sh0001"][0]
+		So(i.Status, ShouldEqual, model.InstancestatusWating)
+		So(i.Metadata, ShouldResemble, map[string]string{"weight": "20", "color": "red"})
+		status, md := ri.Origin()
+		So(status, ShouldEqual, model.InstanceStatusUP)
+		So(md, ShouldResemble, map[string]string{"weight": "5", "color": "red"})
+		r.SyncOverrides([]*model.Override{{AppID: "main.arch.test", Env: "pre", Hostname: "reg", Status: 1, UpdateTimestamp: 1}})
+		So(r.Overrides("", "pre", false)[0].Status, ShouldEqual, model.InstancestatusWating)
+		So(r.ClearOverride("main.arch.test", "pre", "reg", r.Now()), ShouldBeTrue)
+		So(r.ClearOverride("main.arch.test", "pre", "reg", r.Now()), ShouldBeFalse)
+		So(len(r.Overrides("", "", false)), ShouldEqual, 0)
+		// NOTE: the status and metadata registered are restored on clear.
+		c, err = r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+		So(err, ShouldBeNil)
+		So(c.Instances["sh0001"][0].Status, ShouldEqual, model.InstanceStatusUP)
+		So(c.Instances["sh0001"][0].Metadata, ShouldResemble, map[string]string{"weight": "5", "color": "red"})
+		So(r.Register(model.NewInstance(reg), 0), ShouldBeNil)
+		c, err = r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+		So(err, ShouldBeNil)
+		So(c.Instances["sh0001"][0].Status, ShouldEqual, model.InstanceStatusUP)
+	})
+	Convey("test tombstone of cleared override", t, func() {
+		ts := r.Now()
+		arg := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"reg"},
+			Status: []int64{2}, Override: true, SetTimestamp: ts}
+		_, err := r.Set(arg)
+		So(err, ShouldBeNil)
+		stale := r.Overrides("main.arch.test", "pre", false)[0]
+		So(r.ClearOverride("main.arch.test", "pre", "reg", r.Now()), ShouldBeTrue)
+		// NOTE: overrides set before the clear, e.g. synced from a peer missed the clear, are not taken again.
+		r.SyncOverrides([]*model.Override{stale})
+		So(len(r.Overrides("", "", false)), ShouldEqual, 0)
+		arg.SetTimestamp = ts + 1
+		_, _ = r.Set(arg)
+		So(len(r.Overrides("", "", false)), ShouldEqual, 0)
+		os := r.Overrides("", "", true)
+		So(len(os), ShouldEqual, 1)
+		So(os[0].Cleared, ShouldBeTrue)
+		// NOTE: a clear older than the override takes no effect.
+		arg.SetTimestamp = r.Now()
+		_, err = r.Set(arg)
+		So(err, ShouldBeNil)
+		So(r.ClearOverride("main.arch.test", "pre", "reg", ts), ShouldBeFalse)
+		So(len(r.Overrides("", "", false)), ShouldEqual, 1)
+	})
+	Convey("test gc overrides", t, func() {
+		r.SyncOverrides([]*model.Override{
+			{AppID: "main.arch.test", Env: "pre", Hostname: "gone", Status: 2, UpdateTimestamp: r.Now()},
+			{AppID: "main.arch.test", Env: "pre", Hostname: "old", Cleared: true, UpdateTimestamp: r.Now() - int64(_overrideTTL) - 1},
+		})
+		So(len(r.Overrides("", "", true)), ShouldEqual, 3)
+		r.gcOverrides()
+		So(len(r.Overrides("", "", true)), ShouldEqual, 2)
+		r.orphans[overrideKey("main.arch.test", "pre", "gone")] -= int64(_overrideTTL)
+		r.gcOverrides()
+		os := r.Overrides("", "", true)
+		So(len(os), ShouldEqual, 1)
+		So(os[0].ID(), ShouldEqual, "reg")
+	})
+	Convey("test override of metadata op survives registration", t, func() {
+		set := func(op, md string) {
+			arg := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"reg"},
+				Metadata: []string{md}, MetadataOp: op, Override: true, SetTimestamp: r.Now()}
+			_, err := r.Set(arg)
+			So(err, ShouldBeNil)
+		}
+		registered := func() map[string]string {
+			ri := model.NewInstance(reg)
+			ri.Metadata = map[string]string{"weight": "5", "color": "red"}
+			So(r.Register(ri, 0), ShouldBeNil)
+			c, err := r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+			So(err, ShouldBeNil)
+			return c.Instances["sh0001"][0].Metadata
+		}
+		set(model.MetadataDelete, `["color"]`)
+		So(registered(), ShouldResemble, map[string]string{"weight": "5"})
+		set(model.MetadataMerge, `{"color":"blue"}`)
+		So(registered(), ShouldResemble, map[string]string{"weight": "5", "color": "blue"})
+		set(model.MetadataReplace, `{"tag":"a"}`)
+		So(registered(), ShouldResemble, map[string]string{"tag": "a"})
+		set(model.MetadataMerge, `{"color":"blue"}`)
+		So(registered(), ShouldResemble, map[string]string{"tag": "a", "color": "blue"})
+		So(r.ClearOverride("main.arch.test", "pre", "reg", r.Now()), ShouldBeTrue)
+		c, err := r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+		So(err, ShouldBeNil)
+		So(c.Instances["sh0001"][0].Metadata, ShouldResemble, map[string]string{"weight": "5", "color": "red"})
+	})
+}
+
+func TestSetMetadata(t *testing.T) {
+	r := register(t, model.NewInstance(reg))
+	r.SetMetadataLimit(3, 32)
+	Convey("test set metadata by op", t, func() {
+		set := func(op, md string) (map[string]string, error) {
+			arg := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"reg"},
+				Metadata: []string{md}, MetadataOp: op, SetTimestamp: r.Now()}
+			if _, err := r.Set(arg); err != nil {
+				return nil, err
+			}
+			c, err := r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+			So(err, ShouldBeNil)
+			return c.Instances["sh0001"][0].Metadata, nil
+		}
+		md, err := set("", `{"weight":10,"color":"red"}`)
+		So(err, ShouldBeNil)
+		So(md, ShouldResemble, map[string]string{"weight": "10", "color": "red"})
+		md, err = set(model.MetadataMerge, `{"cluster":"c1"}`)
+		So(err, ShouldBeNil)
+		So(len(md), ShouldEqual, 3)
+		md, err = set(model.MetadataDelete, `["color","cluster"]`)
+		So(err, ShouldBeNil)
+		So(md, ShouldResemble, map[string]string{"weight": "10"})
+		md, err = set(model.MetadataReplace, `{"k":"v"}`)
+		So(err, ShouldBeNil)
+		So(md, ShouldResemble, map[string]string{"k": "v"})
+		_, err = set(model.MetadataMerge, `{"a":"1","b":"2","c":"3"}`)
+		So(ecode.Cause(err).Code(), ShouldEqual, ecode.RequestErr.Code())
+		_, err = set(model.MetadataMerge, `{"big":"0123456789012345678901234567890123456789"}`)
+		So(ecode.Cause(err).Code(), ShouldEqual, ecode.RequestErr.Code())
+		_, err = set(model.MetadataMerge, `{"weight":"-1"}`)
+		So(ecode.Cause(err).Code(), ShouldEqual, ecode.RequestErr.Code())
+		_, err = set(model.MetadataMerge, `{"color":"a b"}`)
+		So(ecode.Cause(err).Code(), ShouldEqual, ecode.RequestErr.Code())
+		_, err = set(model.MetadataMerge, `{"nested":{"a":"b"}}`)
+		So(ecode.Cause(err).Code(), ShouldEqual, ecode.RequestErr.Code())
+		_, err = set("unknown", `{"k":"v"}`)
+		So(ecode.Cause(err).Code(), ShouldEqual, ecode.RequestErr.Code())
+		md, err = set(model.MetadataMerge, `{}`)
+		So(err, ShouldBeNil)
+		So(md, ShouldResemble, map[string]string{"k": "v"})
+		// NOTE: replications skip the size limit of this node but not the reserved keys.
+		arg := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: []string{"reg"},
+			Metadata: []string{`{"a":"1","b":"2","c":"3"}`}, SetTimestamp: r.Now(), Replication: true}
+		_, err = r.Set(arg)
+		So(err, ShouldBeNil)
+		arg.Metadata, arg.SetTimestamp = []string{`{"weight":"0"}`}, r.Now()
+		_, err = r.Set(arg)
+		So(ecode.Cause(err).Code(), ShouldEqual, ecode.RequestErr.Code())
+	})
+}
+
+func TestInstanceID(t *testing.T) {
+	regA := &model.ArgRegister{AppID: "main.arch.test", Hostname: "reg", InstanceID: "reg:8000", Zone: "sh0001", Env: "pre", Status: 1}
+	regB := &model.ArgRegister{AppID: "main.arch.test", Hostname: "reg", InstanceID: "reg:8001", Zone: "sh0001", Env: "pre", Status: 1}
+	r := register(t, model.NewInstance(regA), model.NewInstance(regB))
+	Convey("test instances on the same hostname", t, func() {
+		_, ok := r.Renew(&model.ArgRenew{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: "reg", InstanceID: "reg:8001"})
+		So(ok, ShouldBeTrue)
+		_, ok = r.Renew(&model.ArgRenew{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: "reg"})
+		So(ok, ShouldBeFalse)
+		_, err := r.Set(&model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", InstanceID: []string{"reg:8000"},
+			Status: []int64{2}, SetTimestamp: r.Now()})
+		So(err, ShouldBeNil)
+		i, ok := r.Cancel(&model.ArgCancel{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Hostname: "reg", InstanceID: "reg:8001"})
+		So(ok, ShouldBeTrue)
+		So(i.ID(), ShouldEqual, "reg:8001")
+		c, err := r.Fetch("sh0001", "pre", "main.arch.test", 0, 3)
+		So(err, ShouldBeNil)
+		So(len(c.Instances["sh0001"]), ShouldEqual, 1)
+		So(c.Instances["sh0001"][0].ID(), ShouldEqual, "reg:8000")
+		So(c.Instances["sh0001"][0].Status, ShouldEqual, model.InstancestatusWating)
+	})
 }
 
 func BenchmarkSet(b *testing.B) {
@@ -374,14 +750,13 @@ func BenchmarkSet(b *testing.B) {
 			var (
 				c   *model.InstanceInfo
 				err error
-				ok  bool
 			)
 			r, _ := benchRegister(b)
-			changes := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test"}
+			changes := &model.ArgSet{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", SetTimestamp: time.Now().UnixNano()}
 			changes.Hostname = []string{"reg"}
 			changes.Status = []int64{1}
 
-			if ok = r.Set(changes); !ok {
+			if _, err = r.Set(changes); err != nil {
 				b.Errorf("SetStatus(%v) error", arg.AppID)
 			}
 			fetchArg := &model.ArgFetch{Zone: "sh0001", Env: "pre", AppID: "main.arch.test", Status: 3}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"context"
+	"sort"
 	"strings"
 	"sync"
 
@@ -75,3 +76,16 @@ func (s *scheduler) Get(appid, env string) *model.Scheduler {
 	s.mutex.RUnlock()
 	return sch
 }
+
+// All returns all scheduler info ordered by appid and env.
+func (s *scheduler) All() (schs []*model.Scheduler) {
+	s.mutex.RLock()
+	for _, sch := range s.schedulers {
+		schs = append(schs, sch)
+	}
+	s.mutex.RUnlock()
+	sort.Slice(schs, func(i, j int) bool {
+		return appsKey(schs[i].AppID, schs[i].Env) < appsKey(schs[j].AppID, schs[j].Env)
+	})
+	return
+}
@@ -0,0 +1,47 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/model"
+)
+
+func init() {
+	Register("file", newFile)
+}
+
+// file appends changes to a file, a json object per line.
+type file struct {
+	f *os.File
+}
+
+func newFile(c *conf.SinkConfig) (Sink, error) {
+	if c.Path == "" {
+		return nil, errors.New("file sink path is empty")
+	}
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &file{f: f}, nil
+}
+
+func (s *file) Write(c context.Context, cs []*model.Change) (err error) {
+	w := bufio.NewWriter(s.f)
+	enc := json.NewEncoder(w)
+	for _, ch := range cs {
+		if err = enc.Encode(ch); err != nil {
+			return
+		}
+	}
+	return w.Flush()
+}
+
+func (s *file) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,63 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	xhttp "net/http"
+
+	"github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/model"
+)
+
+func init() {
+	Register("http", newHTTP)
+}
+
+// httpSink posts changes to an endpoint as a json array, any status but 2xx is an error.
+type httpSink struct {
+	url    string
+	header map[string]string
+	client *xhttp.Client
+}
+
+func newHTTP(c *conf.SinkConfig) (Sink, error) {
+	if c.URL == "" {
+		return nil, errors.New("http sink url is empty")
+	}
+	return &httpSink{url: c.URL, header: c.Header, client: &xhttp.Client{}}, nil
+}
+
+func (s *httpSink) Write(c context.Context, cs []*model.Change) (err error) {
+	b, err := json.Marshal(cs)
+	if err != nil {
+		return
+	}
+	req, err := xhttp.NewRequest(xhttp.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.header {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req.WithContext(c))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("http sink %s status(%d)", s.url, resp.StatusCode)
+	}
+	return
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
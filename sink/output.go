@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/model"
+
+	log "github.com/go-kratos/kratos/pkg/log"
+)
+
+// output queues the changes passing the filters of a sink, and writes them in batches.
+type output struct {
+	c       *conf.SinkConfig
+	sink    Sink
+	ch      chan *model.Change
+	appids  map[string]struct{}
+	envs    map[string]struct{}
+	actions map[string]struct{}
+	dropped int64
+}
+
+func newOutput(c *conf.SinkConfig, s Sink) *output {
+	return &output{
+		c:       c,
+		sink:    s,
+		ch:      make(chan *model.Change, c.Buffer),
+		appids:  set(c.AppID),
+		envs:    set(c.Env),
+		actions: set(c.Action),
+	}
+}
+
+func set(ss []string) (m map[string]struct{}) {
+	if len(ss) == 0 {
+		return
+	}
+	m = make(map[string]struct{}, len(ss))
+	for _, s := range ss {
+		m[s] = struct{}{}
+	}
+	return
+}
+
+func match(m map[string]struct{}, s string) (ok bool) {
+	if m == nil {
+		return true
+	}
+	_, ok = m[s]
+	return
+}
+
+// queue never blocks the dispatch, changes are dropped if the buffer is full.
+func (o *output) queue(cs []*model.Change) {
+	for _, c := range cs {
+		if !match(o.actions, c.Action) || !match(o.envs, c.Instance.Env) || !match(o.appids, c.Instance.AppID) {
+			continue
+		}
+		select {
+		case o.ch <- c:
+		default:
+			atomic.AddInt64(&o.dropped, 1)
+		}
+	}
+}
+
+// proc writes the queued changes until the channel is closed, then closes the sink.
+func (o *output) proc() {
+	batch := make([]*model.Change, 0, o.c.Batch)
+	for c := range o.ch {
+		batch = append(batch[:0], c)
+	fill:
+		for len(batch) < o.c.Batch {
+			select {
+			case c, ok := <-o.ch:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, c)
+			default:
+				break fill
+			}
+		}
+		if n := atomic.SwapInt64(&o.dropped, 0); n > 0 {
+			log.Error("sink(%s) buffer full, %d changes dropped", o.c.Name, n)
+		}
+		o.write(batch)
+	}
+	if err := o.sink.Close(); err != nil {
+		log.Error("sink(%s) close error(%v)", o.c.Name, err)
+	}
+}
+
+// write writes the batch, and retries with backoff if failed. The batch is dropped if all retries failed.
+func (o *output) write(batch []*model.Change) {
+	for n := 0; ; n++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.c.Timeout))
+		err := o.sink.Write(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if n >= o.c.Retry {
+			log.Error("sink(%s) write %d changes from seq(%d) error(%v), dropped after %d retries", o.c.Name, len(batch), batch[0].Seq, err, n)
+			return
+		}
+		log.Warn("sink(%s) write %d changes from seq(%d) error(%v), retry", o.c.Name, len(batch), batch[0].Seq, err)
+		time.Sleep(_retryWait << uint(n))
+	}
+}
@@ -0,0 +1,157 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/discovery"
+	"github.com/bilibili/discovery/model"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+	log "github.com/go-kratos/kratos/pkg/log"
+)
+
+const (
+	// _retryWait is the wait before reading the change feed again after an error.
+	_retryWait = time.Second
+)
+
+// Sink receives the changes of registry in order, Write is called by one goroutine at a time.
+// A failed Write is retried with the same changes, which may be written more than once.
+type Sink interface {
+	Write(c context.Context, cs []*model.Change) error
+	Close() error
+}
+
+// feed is the change feed of registry.
+type feed interface {
+	Changes(c context.Context, arg *model.ArgChanges) (*model.Changes, <-chan struct{}, error)
+}
+
+// NewFunc creates a sink by config.
+type NewFunc func(c *conf.SinkConfig) (Sink, error)
+
+var (
+	types = map[string]NewFunc{}
+
+	dis    feed
+	outs   []*output
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+)
+
+// Register makes a type of sink available by name, it should be called in init.
+func Register(typ string, f NewFunc) {
+	if _, ok := types[typ]; ok {
+		panic(fmt.Sprintf("sink type(%s) registered twice", typ))
+	}
+	types[typ] = f
+}
+
+// Init creates the sinks of config and starts exporting the changes after now.
+func Init(c *conf.Config, s *discovery.Discovery) {
+	if len(c.Sinks) == 0 {
+		return
+	}
+	dis = s
+	for _, sc := range c.Sinks {
+		f, ok := types[sc.Type]
+		if !ok {
+			panic(fmt.Sprintf("sink(%s) type(%s) unknown", sc.Name, sc.Type))
+		}
+		sk, err := f(sc)
+		if err != nil {
+			log.Error("new sink(%s) type(%s) error(%v)", sc.Name, sc.Type, err)
+			panic(err)
+		}
+		outs = append(outs, newOutput(sc, sk))
+	}
+	start()
+	log.Info("[Sink] exporting changes to %d sinks", len(outs))
+}
+
+// start writes the outputs and dispatches the changes to them.
+func start() {
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	for _, o := range outs {
+		wg.Add(1)
+		go func(o *output) {
+			defer wg.Done()
+			o.proc()
+		}(o)
+	}
+	go func() {
+		dispatch(ctx)
+		for _, o := range outs {
+			close(o.ch)
+		}
+	}()
+}
+
+// Shutdown stops reading changes, then flushes and closes the sinks until the deadline of ctx.
+func Shutdown(ctx context.Context) (err error) {
+	if cancel == nil {
+		return
+	}
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// dispatch reads the change feed from now on and queues the changes to sinks, until ctx is canceled.
+func dispatch(ctx context.Context) {
+	var (
+		arg     = &model.ArgChanges{Cursor: -1}
+		closing bool
+	)
+	for {
+		cs, notify, err := dis.Changes(ctx, arg)
+		if err != nil {
+			if closing {
+				return
+			}
+			if ecode.Cause(err) == ecode.NothingFound {
+				// NOTE: sinks fell behind the feed, changes between are lost.
+				log.Error("sink dispatch cursor(%d) out of the change feed, changes lost", arg.Cursor)
+				arg.Cursor = -1
+				continue
+			}
+			log.Error("sink dispatch cursor(%d) error(%v)", arg.Cursor, err)
+			select {
+			case <-time.After(_retryWait):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		arg.Cursor = cs.Cursor
+		for _, o := range outs {
+			o.queue(cs.Changes)
+		}
+		if cs.More {
+			continue
+		}
+		if closing {
+			return
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			// NOTE: read the changes till now before exit, like the cancel of self registration.
+			closing = true
+		}
+	}
+}
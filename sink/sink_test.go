@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bilibili/discovery/conf"
+	"github.com/bilibili/discovery/model"
+
+	"github.com/go-kratos/kratos/pkg/ecode"
+	xtime "github.com/go-kratos/kratos/pkg/time"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeSink records the seqs of batches written, the first fails writes return error.
+type fakeSink struct {
+	mu      sync.Mutex
+	batches [][]int64
+	writes  int
+	fails   int
+	closed  bool
+}
+
+func (s *fakeSink) Write(c context.Context, cs []*model.Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writes++; s.writes <= s.fails {
+		return errors.New("write failed")
+	}
+	seqs := make([]int64, 0, len(cs))
+	for _, c := range cs {
+		seqs = append(seqs, c.Seq)
+	}
+	s.batches = append(s.batches, seqs)
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+// fakeFeed answers the changes in order, and blocks until canceled after all are answered,
+// then answers final the changes till shutdown.
+type fakeFeed struct {
+	mu      sync.Mutex
+	pages   []*model.Changes
+	errs    []error
+	final   *model.Changes
+	cursors []int64
+	idle    chan struct{}
+}
+
+func (f *fakeFeed) Changes(c context.Context, arg *model.ArgChanges) (cs *model.Changes, notify <-chan struct{}, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cursors = append(f.cursors, arg.Cursor)
+	if c.Err() != nil && f.final != nil {
+		cs, f.final = f.final, nil
+		return cs, f.idle, nil
+	}
+	if len(f.pages) == 0 {
+		return &model.Changes{Cursor: arg.Cursor}, f.idle, nil
+	}
+	cs, err = f.pages[0], f.errs[0]
+	f.pages, f.errs = f.pages[1:], f.errs[1:]
+	if len(f.pages) != 0 {
+		ch := make(chan struct{})
+		close(ch)
+		return cs, ch, err
+	}
+	return cs, f.idle, err
+}
+
+func change(seq int64, action, env, appid string) *model.Change {
+	return &model.Change{Seq: seq, Action: action, Instance: &model.Instance{Env: env, AppID: appid}}
+}
+
+func newConfig(buffer, batch, retry int) *conf.SinkConfig {
+	return &conf.SinkConfig{Name: "fake", Type: "fake", Buffer: buffer, Batch: batch, Retry: retry, Timeout: xtime.Duration(time.Second)}
+}
+
+func TestOutput(t *testing.T) {
+	Convey("test output filter and batch", t, func() {
+		c := newConfig(10, 2, -1)
+		c.Env, c.Action = []string{"prod"}, []string{model.ChangeRegister, model.ChangeCancel}
+		s := &fakeSink{}
+		o := newOutput(c, s)
+		o.queue([]*model.Change{
+			change(1, model.ChangeRegister, "prod", "a"),
+			change(2, model.ChangeSet, "prod", "a"),
+			change(3, model.ChangeRegister, "pre", "a"),
+			change(4, model.ChangeCancel, "prod", "b"),
+			change(5, model.ChangeRegister, "prod", "c"),
+		})
+		close(o.ch)
+		o.proc()
+		So(s.batches, ShouldResemble, [][]int64{{1, 4}, {5}})
+		So(s.closed, ShouldBeTrue)
+	})
+	Convey("test output drops changes if full", t, func() {
+		s := &fakeSink{}
+		o := newOutput(newConfig(2, 10, -1), s)
+		o.queue([]*model.Change{change(1, model.ChangeRegister, "prod", "a"), change(2, model.ChangeRegister, "prod", "a"), change(3, model.ChangeRegister, "prod", "a")})
+		So(o.dropped, ShouldEqual, 1)
+		close(o.ch)
+		o.proc()
+		So(s.batches, ShouldResemble, [][]int64{{1, 2}})
+		So(o.dropped, ShouldEqual, 0)
+	})
+	Convey("test output retries failed writes", t, func() {
+		s := &fakeSink{fails: 1}
+		o := newOutput(newConfig(10, 10, 1), s)
+		o.queue([]*model.Change{change(1, model.ChangeRegister, "prod", "a")})
+		o.queue([]*model.Change{change(2, model.ChangeRegister, "prod", "a")})
+		close(o.ch)
+		o.proc()
+		So(s.writes, ShouldEqual, 2)
+		So(s.batches, ShouldResemble, [][]int64{{1, 2}})
+		s = &fakeSink{fails: 2}
+		o = newOutput(newConfig(10, 10, -1), s)
+		o.queue([]*model.Change{change(1, model.ChangeRegister, "prod", "a")})
+		close(o.ch)
+		o.proc()
+		So(s.writes, ShouldEqual, 1)
+		So(len(s.batches), ShouldEqual, 0)
+	})
+}
+
+func TestDispatch(t *testing.T) {
+	Convey("test dispatch resyncs the feed and flushes on shutdown", t, func() {
+		f := &fakeFeed{
+			pages: []*model.Changes{
+				{Cursor: 10},
+				{Changes: []*model.Change{change(11, model.ChangeRegister, "prod", "a"), change(12, model.ChangeSet, "prod", "a")}, Cursor: 12, More: true},
+				nil,
+				{Cursor: 20},
+				{Changes: []*model.Change{change(21, model.ChangeCancel, "prod", "a")}, Cursor: 21},
+			},
+			errs:  []error{nil, nil, ecode.NothingFound, nil, nil},
+			final: &model.Changes{Changes: []*model.Change{change(22, model.ChangeEvict, "prod", "a")}, Cursor: 22},
+			idle:  make(chan struct{}),
+		}
+		s := &fakeSink{}
+		dis, outs = f, []*output{newOutput(newConfig(10, 10, -1), s)}
+		start()
+		time.Sleep(100 * time.Millisecond)
+		So(Shutdown(context.Background()), ShouldBeNil)
+		So(f.cursors, ShouldResemble, []int64{-1, 10, 12, -1, 20, 21})
+		So(s.closed, ShouldBeTrue)
+		var seqs []int64
+		for _, b := range s.batches {
+			seqs = append(seqs, b...)
+		}
+		So(seqs, ShouldResemble, []int64{11, 12, 21, 22})
+	})
+}